@@ -7,11 +7,28 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	// sendAt in the timezone of the user needs the zone database, which
+	// the container may not have
+	_ "time/tzdata"
 
+	"notif/implementation/bounce"
+	"notif/implementation/callback"
+	"notif/implementation/channel"
+	"notif/implementation/chat"
+	"notif/implementation/cron"
+	"notif/implementation/deadletter"
 	"notif/implementation/email"
 	"notif/implementation/message"
+	"notif/implementation/push"
+	"notif/implementation/schedule"
+	"notif/implementation/sms"
+	"notif/implementation/status"
+	"notif/implementation/suppression"
+	"notif/implementation/template"
+	"notif/implementation/webhook"
 	"notif/pkg/config"
 	"notif/transport/endpoints"
 	httpTransport "notif/transport/http"
@@ -77,20 +94,151 @@ func main() {
 		zapLogger.Fatalf("nats connection failed: %v", err.Error())
 	}
 
-	// creating jetStream from natsConn
-	js, err := natsConn.JetStream()
+	// notifications and their attachments must fit in a msg
+	config.NatsMaxPayload = natsConn.MaxPayload()
+
+	// creating jetStream from natsConn, with room for the async publishes
+	// of several batches at once
+	js, err := natsConn.JetStream(nats.PublishAsyncMaxPending(config.NatsAsyncMaxPending))
 	if err != nil {
 		zapLogger.Fatalf("nats-js connection failed: %v", err.Error())
 	}
 
 	// creating the notification stream for event processing
-	if err := natshelper.CreateStream(js, zapLogger); err != nil {
+	if err := natshelper.CreateStream(js, cfg.NatsDuplicateWindow, zapLogger); err != nil {
 		zapLogger.Fatalf("nats-js stream creation failed: %v", err.Error())
 	}
 
-	emailSvc := email.NewEmailService(zapLogger, cfg, tracer)
-	svc := message.NewMessageService(zapLogger, js, emailSvc, tracer, propagator)
-	end := endpoints.MakeEndpoints(svc, tracer)
+	// notifications which cannot be delivered are kept for inspection
+	if err := natshelper.CreateDeadLetterStream(js, zapLogger); err != nil {
+		zapLogger.Fatalf("nats-js dead-letter stream creation failed: %v", err.Error())
+	}
+
+	// notifications due later are held in their own stream
+	if err := natshelper.CreateScheduleStream(js, zapLogger); err != nil {
+		zapLogger.Fatalf("nats-js schedule stream creation failed: %v", err.Error())
+	}
+
+	schedulesKV, err := natshelper.CreateKeyValue(js, config.ScheduleBucket, "notification schedules", 0, zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv schedule bucket creation failed: %v", err.Error())
+	}
+
+	// the delivery status of the notifications is kept as long as their
+	// dead letters
+	statusKV, err := natshelper.CreateKeyValue(js, config.StatusBucket, "notification delivery status",
+		config.StatusMaxAge, zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv status bucket creation failed: %v", err.Error())
+	}
+
+	// the callbacks the tenants registered for the status changes
+	callbacksKV, err := natshelper.CreateKeyValue(js, config.CallbackBucket, "status callbacks of the tenants", 0,
+		zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv callbacks bucket creation failed: %v", err.Error())
+	}
+
+	// recurring jobs are shared by the instances, which take turns to run
+	// them through a lease
+	jobsKV, err := natshelper.CreateKeyValue(js, config.CronBucket, "recurring notification jobs", 0, zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv jobs bucket creation failed: %v", err.Error())
+	}
+
+	locksKV, err := natshelper.CreateKeyValue(js, config.LockBucket, "leases of the instances", 0, zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv locks bucket creation failed: %v", err.Error())
+	}
+
+	// the addresses which hard-bounced or complained are not sent to anymore
+	suppressionsKV, err := natshelper.CreateKeyValue(js, config.SuppressionBucket, "suppressed email addresses", 0,
+		zapLogger)
+	if err != nil {
+		zapLogger.Fatalf("nats-kv suppressions bucket creation failed: %v", err.Error())
+	}
+
+	suppressionSvc := suppression.NewSuppressionService(zapLogger, suppressionsKV, tracer)
+
+	// templates are kept in a key-value bucket to share them between instances
+	templateStore := template.NewMemoryStore()
+	if cfg.TemplateStore == config.NatsStore {
+		kv, err := natshelper.CreateKeyValue(js, config.TemplateBucket, "notification templates", 0, zapLogger)
+		if err != nil {
+			zapLogger.Fatalf("nats-kv template bucket creation failed: %v", err.Error())
+		}
+
+		templateStore = template.NewNatsStore(kv)
+	}
+
+	// email goes through the api of EMAIL_PROVIDER when it is not smtp
+	emailProvider, err := email.NewAPIProvider(cfg)
+	if err != nil {
+		zapLogger.Fatalf("email provider setup failed: %v", err.Error())
+	}
+
+	var emailSvc email.Service
+	if emailProvider != nil {
+		emailSvc, err = email.NewAPIService(zapLogger, cfg, emailProvider, suppressionSvc, tracer)
+	} else {
+		emailSvc, err = email.NewEmailService(zapLogger, cfg, suppressionSvc, tracer)
+	}
+
+	if err != nil {
+		zapLogger.Fatalf("email service setup failed: %v", err.Error())
+	}
+
+	templateSvc := template.NewTemplateService(zapLogger, templateStore, tracer)
+	webhookSecrets, err := webhook.ParseSecrets(cfg.WebhookSecrets)
+	if err != nil {
+		zapLogger.Fatalf("webhook secrets parsing failed: %v", err.Error())
+	}
+
+	webhookSvc := webhook.NewWebhookService(zapLogger, webhookSecrets, tracer)
+	// chat webhooks get the trace of the notification like nats msgs do
+	chatSvc := chat.NewChatService(zapLogger, tracer, propagator)
+
+	channels := channel.NewRegistry(
+		email.NewChannel(emailSvc, templateSvc),
+		webhook.NewChannel(webhookSvc),
+		chat.NewChannel(chatSvc, strings.Split(cfg.ChatAllowedHosts, ",")),
+	)
+
+	// sms is only available when a provider is configured
+	smsProvider, err := sms.NewProvider(cfg)
+	if err != nil {
+		zapLogger.Fatalf("sms provider setup failed: %v", err.Error())
+	}
+
+	if smsProvider != nil {
+		channels.Register(sms.NewChannel(sms.NewSMSService(zapLogger, smsProvider, cfg.SmsFrom, tracer)))
+	}
+
+	// push is only available when fcm or apns credentials are configured
+	pushProviders, err := push.NewProviders(cfg)
+	if err != nil {
+		zapLogger.Fatalf("push providers setup failed: %v", err.Error())
+	}
+
+	if len(pushProviders) > 0 {
+		channels.Register(push.NewChannel(push.NewPushService(zapLogger, pushProviders, tracer)))
+	}
+
+	deadLetterSvc := deadletter.NewDeadLetterService(zapLogger, js, tracer)
+	scheduleSvc := schedule.NewScheduleService(zapLogger, js, schedulesKV, tracer)
+	statusSvc := status.NewStatusService(zapLogger, statusKV, tracer)
+	callbackSvc := callback.NewCallbackService(zapLogger, callbacksKV, tracer)
+	svc := message.NewMessageService(zapLogger, js, channels, deadLetterSvc, scheduleSvc, statusSvc,
+		callbackSvc, cfg.WorkerConcurrency, tracer, propagator)
+	cronSvc := cron.NewCronService(zapLogger, jobsKV, locksKV, svc, tracer)
+
+	bounceSvc, err := bounce.NewBounceService(zapLogger, cfg, suppressionSvc, statusSvc, svc, locksKV, tracer)
+	if err != nil {
+		zapLogger.Fatalf("bounce service setup failed: %v", err.Error())
+	}
+
+	end := endpoints.MakeEndpoints(svc, channels, templateSvc, deadLetterSvc, scheduleSvc, statusSvc,
+		cronSvc, callbackSvc, bounceSvc, suppressionSvc, tracer)
 	h := httpTransport.NewHTTPService(end, zapLogger, tracer)
 
 	// creating server with timeout and assigning the routes
@@ -106,14 +254,34 @@ func main() {
 		),
 	}
 
+	// the runners publish and ack on the nats connection, which is closed
+	// once every one of them returned
+	runners := sync.WaitGroup{}
+
 	// start subscribing for notif events
-	go func(svc message.Service, ctx context.Context, conn *nats.Conn, wg *sync.WaitGroup) {
-		svc.RecvEmailRequest(ctx, wg)
+	runners.Add(1)
 
+	go func(svc message.Service, ctx context.Context, runners *sync.WaitGroup) {
+		defer runners.Done()
+
+		svc.RecvRequest(ctx, runners)
 		zapLogger.Info("subscriber returned")
-		// closing the connection because subscriber returned
-		conn.Close()
-	}(svc, ctx, natsConn, &wg)
+	}(svc, ctx, &runners)
+
+	// start publishing the held notifications once due
+	runners.Add(1)
+
+	go scheduleSvc.Run(ctx, &runners)
+
+	// start running the recurring jobs while holding the cron lease
+	runners.Add(1)
+
+	go cronSvc.Run(ctx, &runners)
+
+	// start receiving and polling the bounces mailed back
+	runners.Add(1)
+
+	go bounceSvc.Run(ctx, &runners)
 
 	// start listening and serving http server
 	go func() {
@@ -143,10 +311,14 @@ func main() {
 		zapLogger.Warn(err)
 	}
 
-	// cancel the ctx to stop the pullSubscriber close the nats connection
+	// cancel the ctx to stop the pullSubscriber and the runners
 	cancelCtx()
 
-	// wait till the nats connection is closed and pullSubscriber returned
+	// closing the connection once nothing uses it anymore
+	runners.Wait()
+	natsConn.Close()
+
+	// wait till the nats connection is closed
 	wg.Wait()
 
 	zapLogger.Info("application exited")
@@ -3,11 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"notif/implementation/email"
-	"strings"
 
 	"github.com/matcornic/hermes/v2"
 )
@@ -24,9 +22,8 @@ func main() {
 		Subject:  "thanks for choosing notif",
 	}
 
-	// prepare html body
+	// prepare html body, notif builds the mime message around it
 	e.Body = prepareCustomBeatifulHtmlBody(e)
-	e.Body = buildReqBody(e)
 
 	body, err := json.Marshal(&e)
 	if err != nil {
@@ -47,21 +44,6 @@ func main() {
 	}
 }
 
-func buildReqBody(e email.Entity) string {
-	tolist := make([]string, len(e.ToList))
-	for i := range e.ToList {
-		tolist = append(tolist, e.ToList[i].EmailAddr)
-	}
-
-	msg := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\r\n"
-	msg += fmt.Sprintf("From: %s\r\n", e.FromName)
-	msg += fmt.Sprintf("To: %s\r\n", strings.Join(tolist, ";"))
-	msg += fmt.Sprintf("Subject: %s\r\n", e.Subject)
-	msg += fmt.Sprintf("\r\n%s\r\n", e.Body)
-
-	return msg
-}
-
 func prepareCustomBeatifulHtmlBody(e email.Entity) string {
 	h := hermes.Hermes{
 		Theme: new(hermes.Default),
@@ -0,0 +1,57 @@
+// sms-standin is a local stand-in for an sms gateway. Point notif at it
+// with SMS_PROVIDER=http, SMS_HTTP_URL=http://localhost:6970/sms and an SMS_FROM to try
+// the sms channel without a real provider. Numbers ending in 0 are
+// rejected and the ones ending in 9 fail with a 503 to exercise retries.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	var seq int64
+
+	http.HandleFunc("/sms", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		to := r.FormValue("to")
+
+		switch {
+		case strings.HasSuffix(to, "0"):
+			log.Printf("rejecting sms to %s", to)
+			http.Error(w, "unknown subscriber", http.StatusBadRequest)
+
+			return
+
+		case strings.HasSuffix(to, "9"):
+			log.Printf("failing sms to %s", to)
+			http.Error(w, "gateway busy", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		id := "standin-" + strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+		log.Printf("sms %s from %s to %s: %s", id, r.FormValue("from"), to, r.FormValue("body"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": id})
+	})
+
+	server := &http.Server{
+		Addr:         ":6970",
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	log.Println("sms stand-in listening on :6970")
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,221 @@
+package bounce
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"notif/implementation/email"
+)
+
+// report is what the parts of a multipart/report tell.
+type report struct {
+	// recipients are the per-recipient fields of a delivery status.
+	recipients []textproto.MIMEHeader
+	// feedback are the fields of a feedback report.
+	feedback textproto.MIMEHeader
+	// original are the headers of the mail the report is about.
+	original textproto.MIMEHeader
+}
+
+// ParseReport returns the bounces of a delivery status notification (RFC
+// 3464) or the complaint of a feedback report (RFC 5965) read from r. The
+// notification is told by the X-Notif-Id header of the original mail the
+// report gives back. Mails which are no report fail with ErrNotReport,
+// the delayed recipients of a report are left out.
+func ParseReport(r io.Reader, now time.Time) ([]Bounce, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["boundary"] == "" {
+		return nil, ErrNotReport
+	}
+
+	var rep report
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = rep.read(part); err != nil {
+			return nil, err
+		}
+	}
+
+	notifID := rep.original.Get(email.IDHeader)
+
+	if rep.feedback != nil {
+		return rep.complaint(notifID, now), nil
+	}
+
+	if rep.recipients == nil {
+		return nil, ErrNotReport
+	}
+
+	bounces := make([]Bounce, 0, len(rep.recipients))
+
+	for _, fields := range rep.recipients {
+		if !strings.EqualFold(fields.Get("Action"), "failed") {
+			continue
+		}
+
+		rcpt := address(fields.Get("Final-Recipient"))
+		if rcpt == "" {
+			rcpt = address(fields.Get("Original-Recipient"))
+		}
+
+		if rcpt == "" {
+			continue
+		}
+
+		code := strings.TrimSpace(fields.Get("Status"))
+
+		b := Bounce{
+			Recipient: rcpt,
+			NotifID:   notifID,
+			Type:      Soft,
+			Reason:    code,
+			At:        date(fields.Get("Last-Attempt-Date"), now),
+		}
+
+		// 5.x.x codes are permanent failures, 4.x.x ones were given up on
+		if strings.HasPrefix(code, "5") {
+			b.Type = Hard
+		}
+
+		if diag := value(fields.Get("Diagnostic-Code")); diag != "" {
+			b.Reason = diag
+		}
+
+		bounces = append(bounces, b)
+	}
+
+	return bounces, nil
+}
+
+// read keeps what part tells of the report.
+func (rep *report) read(part *multipart.Part) error {
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		// parts without a valid type are text, of no use
+		return nil
+	}
+
+	var body io.Reader = part
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, part)
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(body))
+
+	switch mediaType {
+	case "message/delivery-status":
+		// the per-message fields come first, then a group of fields per
+		// recipient
+		for {
+			fields, err := tp.ReadMIMEHeader()
+			if fields.Get("Final-Recipient") != "" || fields.Get("Original-Recipient") != "" {
+				rep.recipients = append(rep.recipients, fields)
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+	case "message/feedback-report":
+		fields, err := tp.ReadMIMEHeader()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		rep.feedback = fields
+
+	case "text/rfc822-headers", "message/rfc822":
+		headers, err := tp.ReadMIMEHeader()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		rep.original = headers
+	}
+
+	return nil
+}
+
+// complaint returns the complaint of a feedback report, about its original
+// recipient or else the recipient of the original mail. Reports telling a
+// mail is no spam are no complaint.
+func (rep *report) complaint(notifID string, now time.Time) []Bounce {
+	kind := strings.ToLower(strings.TrimSpace(rep.feedback.Get("Feedback-Type")))
+	if kind == "not-spam" {
+		return []Bounce{}
+	}
+
+	rcpt := address(rep.feedback.Get("Original-Rcpt-To"))
+	if rcpt == "" {
+		if to, err := mail.ParseAddressList(rep.original.Get("To")); err == nil && len(to) > 0 {
+			rcpt = to[0].Address
+		}
+	}
+
+	if rcpt == "" {
+		return []Bounce{}
+	}
+
+	return []Bounce{{
+		Recipient: rcpt,
+		NotifID:   notifID,
+		Type:      Complaint,
+		Reason:    "complaint: " + kind,
+		At:        date(rep.feedback.Get("Arrival-Date"), now),
+	}}
+}
+
+// value returns the value of a typed field like "smtp; 550 5.1.1 unknown
+// user" without its type.
+func value(field string) string {
+	if i := strings.IndexByte(field, ';'); i >= 0 {
+		field = field[i+1:]
+	}
+
+	return strings.TrimSpace(field)
+}
+
+// address returns the address of a typed field like
+// "rfc822; <jane@example.com>".
+func address(field string) string {
+	return strings.Trim(value(field), "<>")
+}
+
+// date parses the date field, now when it is missing or invalid.
+func date(field string, now time.Time) time.Time {
+	t, err := mail.ParseDate(field)
+	if err != nil {
+		return now
+	}
+
+	return t.UTC()
+}
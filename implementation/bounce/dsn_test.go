@@ -0,0 +1,108 @@
+package bounce
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const dsn = "From: MAILER-DAEMON@mx.example.com\r\n" +
+	"To: notif@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your message could not be delivered.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Tue, 1 Mar 2022 10:00:00 +0000\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; Jane@example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 <jane@example.com>: user unknown\r\n" +
+	"Last-Attempt-Date: Tue, 1 Mar 2022 10:00:05 +0000\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; full@example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 4.2.2\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; slow@example.com\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.4.1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: notif@example.com\r\n" +
+	"To: Jane@example.com\r\n" +
+	"X-Notif-Id: 0123456789abcdef012345\r\n" +
+	"\r\n" +
+	"--b1--\r\n"
+
+const arf = "From: fbl@isp.example.net\r\n" +
+	"To: notif@example.com\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=feedback-report; boundary=\"b2\"\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"This is an abuse report.\r\n" +
+	"--b2\r\n" +
+	"Content-Type: message/feedback-report\r\n" +
+	"\r\n" +
+	"Feedback-Type: abuse\r\n" +
+	"Version: 1\r\n" +
+	"Arrival-Date: Tue, 1 Mar 2022 11:00:00 +0000\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: notif@example.com\r\n" +
+	"To: Joe <joe@example.net>\r\n" +
+	"X-Notif-Id: fedcba9876543210fedcba\r\n" +
+	"Subject: hi\r\n" +
+	"\r\n" +
+	"hello\r\n" +
+	"--b2--\r\n"
+
+func TestParseReport(t *testing.T) {
+	now := time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	bounces, err := ParseReport(strings.NewReader(dsn), now)
+	require.NoError(t, err)
+	require.Equal(t, []Bounce{{
+		Recipient: "Jane@example.com",
+		NotifID:   "0123456789abcdef012345",
+		Type:      Hard,
+		Reason:    "550 5.1.1 <jane@example.com>: user unknown",
+		At:        time.Date(2022, 3, 1, 10, 0, 5, 0, time.UTC),
+	}, {
+		Recipient: "full@example.com",
+		NotifID:   "0123456789abcdef012345",
+		Type:      Soft,
+		Reason:    "4.2.2",
+		At:        now,
+	}}, bounces)
+
+	bounces, err = ParseReport(strings.NewReader(arf), now)
+	require.NoError(t, err)
+	require.Equal(t, []Bounce{{
+		Recipient: "joe@example.net",
+		NotifID:   "fedcba9876543210fedcba",
+		Type:      Complaint,
+		Reason:    "complaint: abuse",
+		At:        time.Date(2022, 3, 1, 11, 0, 0, 0, time.UTC),
+	}}, bounces)
+
+	_, err = ParseReport(strings.NewReader("Subject: hi\r\nContent-Type: text/plain\r\n\r\nhello\r\n"), now)
+	require.ErrorIs(t, err, ErrNotReport)
+}
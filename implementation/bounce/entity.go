@@ -0,0 +1,44 @@
+package bounce
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotReport       = errors.New("message is no delivery status nor feedback report")
+	ErrUnknownProvider = errors.New("no bounce webhook is configured for the provider")
+	ErrSignature       = errors.New("bounce webhook signature is invalid")
+	ErrReplay          = errors.New("bounce webhook is stale or was already received")
+)
+
+// Type tells a bounce which will not go away apart from one which may.
+type Type string
+
+const (
+	// Hard bounces were rejected for good, like an unknown mailbox.
+	Hard Type = "hard"
+	// Soft bounces were given up for now, like a full mailbox.
+	Soft Type = "soft"
+	// Complaint is a notification the recipient reported as spam.
+	Complaint Type = "complaint"
+)
+
+// Bounce is a mail which did not make it to Recipient, or which Recipient
+// complained about.
+type Bounce struct {
+	Recipient string
+	// NotifID is the notification of the mail, empty when the report did
+	// not give it back.
+	NotifID string
+	Type    Type
+	// Reason is the diagnostic of the mail server or of the provider.
+	Reason string
+	At     time.Time
+}
+
+// suppresses tells whether the recipient of a bounce of type t must not
+// be sent to anymore.
+func (t Type) suppresses() bool {
+	return t == Hard || t == Complaint
+}
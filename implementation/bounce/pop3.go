@@ -0,0 +1,224 @@
+package bounce
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"notif/pkg/config"
+)
+
+// Mailbox is the pop3 mailbox the bounces are polled from.
+type Mailbox struct {
+	Addr     string
+	Username string
+	Password string
+	// TLS tells whether to connect over implicit tls.
+	TLS bool
+}
+
+// pop3 is a pop3 session, just enough of it to read and delete mails.
+type pop3 struct {
+	conn net.Conn
+	tp   *textproto.Conn
+}
+
+// dialPOP3 connects and logs in to mb.
+func dialPOP3(mb Mailbox) (*pop3, error) {
+	dialer := &net.Dialer{Timeout: config.SmtpDialTimeOut}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if mb.TLS {
+		host, _, _ := net.SplitHostPort(mb.Addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", mb.Addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", mb.Addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &pop3{conn: conn, tp: textproto.NewConn(conn)}
+
+	// the greeting
+	if _, err = c.cmd(""); err != nil {
+		c.tp.Close()
+		return nil, err
+	}
+
+	if _, err = c.cmd("USER " + mb.Username); err == nil {
+		_, err = c.cmd("PASS " + mb.Password)
+	}
+
+	if err != nil {
+		c.tp.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// cmd sends the command line, unless empty, and returns the text of the
+// +OK reply to it.
+func (c *pop3) cmd(line string) (string, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(config.BounceTimeOut))
+
+	if line != "" {
+		if err := c.tp.PrintfLine("%s", line); err != nil {
+			return "", err
+		}
+	}
+
+	reply, err := c.tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(reply, "+OK") {
+		return "", errors.New("pop3 command failed: " + reply)
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(reply, "+OK")), nil
+}
+
+// list returns the size of every mail by its number.
+func (c *pop3) list() (map[int]int, error) {
+	if _, err := c.cmd("LIST"); err != nil {
+		return nil, err
+	}
+
+	lines, err := c.tp.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[int]int, len(lines))
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		if sizes[n], err = strconv.Atoi(fields[1]); err != nil {
+			delete(sizes, n)
+		}
+	}
+
+	return sizes, nil
+}
+
+// isReport tells whether the mail n is a report, from its headers alone.
+func (c *pop3) isReport(n int) (bool, error) {
+	if _, err := c.cmd("TOP " + strconv.Itoa(n) + " 0"); err != nil {
+		return false, err
+	}
+
+	lines, err := c.tp.ReadDotLines()
+	if err != nil {
+		return false, err
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(strings.Join(lines, "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		return false, nil
+	}
+
+	return strings.HasPrefix(strings.ToLower(msg.Header.Get("Content-Type")), "multipart/report"), nil
+}
+
+// retr returns the mail n.
+func (c *pop3) retr(n int) ([]byte, error) {
+	if _, err := c.cmd("RETR " + strconv.Itoa(n)); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(c.tp.DotReader())
+}
+
+// poll processes the reports of the mailbox, deleting them once done. The
+// other mails are left as the mailbox may be the one of the sender, and
+// so are the reports failing to be processed, till the next poll.
+func (s *service) poll(ctx context.Context) error {
+	c, err := dialPOP3(s.mailbox)
+	if err != nil {
+		return err
+	}
+	defer c.tp.Close()
+
+	sizes, err := c.list()
+	if err != nil {
+		return err
+	}
+
+	err = s.drain(ctx, c, sizes)
+
+	// the deletions are only committed by quitting, the reports deleted
+	// before a failure are done with as well
+	if _, qErr := c.cmd("QUIT"); err == nil {
+		err = qErr
+	}
+
+	return err
+}
+
+// drain processes and deletes the reports of sizes.
+func (s *service) drain(ctx context.Context, c *pop3, sizes map[int]int) error {
+	for n, size := range sizes {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if size > config.BounceMaxSize {
+			continue
+		}
+
+		report, err := c.isReport(n)
+		if err != nil {
+			return err
+		}
+
+		if !report {
+			continue
+		}
+
+		raw, err := c.retr(n)
+		if err != nil {
+			return err
+		}
+
+		bounces, err := ParseReport(bytes.NewReader(raw), time.Now().UTC())
+		if err != nil {
+			s.log.Warnf("parsing report %d of the bounce mailbox failed: %v", n, err)
+			continue
+		}
+
+		if err = s.process(ctx, bounces, false); err != nil {
+			return err
+		}
+
+		if _, err = c.cmd("DELE " + strconv.Itoa(n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
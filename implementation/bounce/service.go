@@ -0,0 +1,258 @@
+// Package bounce processes the bounces and complaints of the email
+// notifications: the delivery status notifications mailed back, received
+// over smtp or polled from a pop3 mailbox, and the events of the webhooks
+// of the email providers. The recipients which bounced are failed in the
+// status of their notification, the ones which hard-bounced or complained
+// are suppressed.
+package bounce
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"notif/implementation/email"
+	"notif/implementation/message"
+	"notif/implementation/status"
+	"notif/implementation/suppression"
+	"notif/pkg"
+	"notif/pkg/config"
+	natshelper "notif/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// leaseKey is the key of the lease of the instance polling the mailbox.
+const leaseKey = "bounces"
+
+type Service interface {
+	// Webhook processes the bounce and complaint events posted by the
+	// webhook of provider, once their signature is verified.
+	Webhook(ctx context.Context, provider string, header http.Header, body []byte) error
+	// Run receives the bounces mailed to BOUNCE_SMTP_ADDR and polls the
+	// BOUNCE_POP3_ADDR mailbox while holding the bounce lease, till ctx is
+	// done, and marks wg done once returned. It is added to wg before it
+	// is started.
+	Run(ctx context.Context, wg *sync.WaitGroup)
+}
+
+type service struct {
+	suppressions suppression.Service
+	statuses     status.Service
+	notifs       message.Service
+	hooks        *webhooks
+	smtpAddr     string
+	mailbox      Mailbox
+	lease        *natshelper.Lease
+	log          *zap.SugaredLogger
+	tracer       trace.Tracer
+}
+
+// NewBounceService returns a Service suppressing the addresses which
+// bounced in suppressions and failing their notifications in statuses,
+// pushing the change to their callback through notifs. The mailbox lease
+// is kept in locks.
+func NewBounceService(l *zap.SugaredLogger, cfg *config.NotifConfig, suppressions suppression.Service,
+	statuses status.Service, notifs message.Service, locks nats.KeyValue, t trace.Tracer) (Service, error) {
+	hooks, err := newWebhooks(cfg.EmailSendGridWebhookKey, cfg.EmailMailgunWebhookKey, cfg.EmailSesTopicARN,
+		&http.Client{Timeout: config.EmailApiTimeOut})
+	if err != nil {
+		return nil, err
+	}
+
+	return &service{
+		suppressions: suppressions,
+		statuses:     statuses,
+		notifs:       notifs,
+		hooks:        hooks,
+		smtpAddr:     cfg.BounceSmtpAddr,
+		mailbox: Mailbox{
+			Addr:     cfg.BouncePop3Addr,
+			Username: cfg.BouncePop3Username,
+			Password: cfg.BouncePop3Password,
+			TLS:      cfg.BouncePop3TLS,
+		},
+		lease:  natshelper.NewLease(locks, leaseKey, nuid.Next(), config.BounceLeaseTTL),
+		log:    l,
+		tracer: t,
+	}, nil
+}
+
+func (s *service) Webhook(ctx context.Context, provider string, header http.Header, body []byte) error {
+	ctx, span := s.tracer.Start(ctx, "bounce.svc-webhook")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.email_provider", provider))
+
+	bounces, err := s.hooks.parse(ctx, provider, header, body, time.Now().UTC())
+	if err != nil {
+		return s.fail(span, err)
+	}
+
+	if err = s.process(ctx, bounces, true); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+func (s *service) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if s.smtpAddr != "" {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			s.listen(ctx, s.smtpAddr)
+		}()
+	}
+
+	if s.mailbox.Addr == "" {
+		return
+	}
+
+	ticker := time.NewTicker(config.BouncePollInterval)
+	defer ticker.Stop()
+
+	leader := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			if leader {
+				if err := s.lease.Release(); err != nil {
+					s.log.Warnf("releasing bounce lease failed: %v", err)
+				}
+			}
+
+			return
+
+		case now := <-ticker.C:
+			held, err := s.lease.Acquire(now)
+			if err != nil {
+				s.log.Errorf("acquiring bounce lease failed: %v", err)
+			}
+
+			if held != leader {
+				s.log.Infof("bounce lease held: %t", held)
+				leader = held
+			}
+
+			if !held {
+				continue
+			}
+
+			if err = s.poll(ctx); err != nil {
+				s.log.Errorf("polling bounce mailbox failed: %v", err)
+			}
+		}
+	}
+}
+
+// process suppresses the recipients of the hard bounces and complaints of
+// bounces, and fails them in the status of their notification. The mailed
+// reports are not signed, so they are only trusted when verified tells
+// so or when they are about a recipient of their notification.
+func (s *service) process(ctx context.Context, bounces []Bounce, verified bool) error {
+	ctx, span := s.tracer.Start(ctx, "bounce.svc-process")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("notif.bounces", len(bounces)))
+
+	for _, b := range bounces {
+		addr, err := suppression.Normalize(b.Recipient)
+		if err != nil {
+			s.log.Warnf("ignoring bounce of invalid address %q", b.Recipient)
+			continue
+		}
+
+		r, err := s.record(ctx, b.NotifID, addr)
+		if err != nil {
+			return s.fail(span, err)
+		}
+
+		if !verified && r == nil {
+			s.log.Infow("ignoring bounce of unknown notification", "notifID", b.NotifID, "type", b.Type)
+			continue
+		}
+
+		reason := b.Reason
+		if reason == "" {
+			reason = string(b.Type) + " bounce"
+		}
+
+		if b.Type.suppresses() {
+			entry := suppression.Entry{Address: addr, Reason: suppression.Bounce, Detail: reason, NotifID: b.NotifID,
+				CreatedAt: b.At}
+			if b.Type == Complaint {
+				entry.Reason = suppression.Complaint
+			}
+
+			if _, err = s.suppressions.Add(ctx, entry); err != nil {
+				return s.fail(span, err)
+			}
+		}
+
+		s.log.Infow("bounce processed", "notifID", b.NotifID, "type", b.Type, "reason", reason)
+
+		if r == nil {
+			continue
+		}
+
+		failed := false
+
+		rec, err := s.statuses.Update(ctx, r.ID, func(r *status.Record) {
+			failed = r.Fail(addr, reason, time.Now())
+		})
+		if err != nil {
+			return s.fail(span, err)
+		}
+
+		if failed {
+			s.notifs.Notify(ctx, rec)
+		}
+	}
+
+	return nil
+}
+
+// record returns the status of the email notification id when addr is one
+// of its recipients, nil otherwise.
+func (s *service) record(ctx context.Context, id, addr string) (*status.Record, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	r, err := s.statuses.Get(ctx, id)
+
+	var pErr pkg.Error
+	if errors.As(err, &pErr) && pErr.Status() == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Channel != email.ChannelName || !r.HasRecipient(addr) {
+		return nil, nil
+	}
+
+	return &r, nil
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,135 @@
+package bounce
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"notif/pkg/config"
+)
+
+// listen receives the bounces mailed to addr over smtp till ctx is done.
+// It only accepts mail, relaying none, and is meant to be the mx of the
+// domain of the return path of the notifications.
+func (s *service) listen(ctx context.Context, addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.log.Errorf("listening for bounces on %s failed: %v", addr, err)
+		return
+	}
+
+	s.log.Infof("receiving bounces on %s", addr)
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			s.log.Warnf("accepting bounce connection failed: %v", err)
+			continue
+		}
+
+		go s.session(ctx, conn)
+	}
+}
+
+// session serves a single smtp connection. Mails which are no report are
+// accepted and dropped, so the sender does not bounce them in turn, the
+// ones failing to be processed are refused for now to be sent again.
+func (s *service) session(ctx context.Context, conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	reply := func(code int, msg string) error {
+		_ = conn.SetDeadline(time.Now().Add(config.BounceTimeOut))
+		return tp.PrintfLine("%d %s", code, msg)
+	}
+
+	if reply(220, "notif bounce receiver ready") != nil {
+		return
+	}
+
+	var from, rcpt bool
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch {
+		case verb == "HELO" || verb == "EHLO":
+			err = reply(250, "notif")
+		case verb == "MAIL":
+			from, rcpt = true, false
+			err = reply(250, "OK")
+		case verb == "RCPT" && !from:
+			err = reply(503, "need MAIL first")
+		case verb == "RCPT":
+			rcpt = true
+			err = reply(250, "OK")
+		case verb == "DATA" && !rcpt:
+			err = reply(503, "need RCPT first")
+		case verb == "DATA":
+			if err = reply(354, "end data with <CR><LF>.<CR><LF>"); err == nil {
+				err = reply(s.receive(ctx, tp.DotReader()))
+			}
+
+			from, rcpt = false, false
+		case verb == "RSET":
+			from, rcpt = false, false
+			err = reply(250, "OK")
+		case verb == "NOOP":
+			err = reply(250, "OK")
+		case verb == "QUIT":
+			_ = reply(221, "bye")
+			return
+		default:
+			err = reply(502, "command not implemented")
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// receive processes the mail read from data, returning the reply to it.
+func (s *service) receive(ctx context.Context, data io.Reader) (int, string) {
+	raw, err := ioutil.ReadAll(io.LimitReader(data, int64(config.BounceMaxSize)+1))
+	if err != nil {
+		return 451, "reading message failed"
+	}
+
+	// the rest of the message must be read all the same
+	if _, err = io.Copy(ioutil.Discard, data); err != nil || len(raw) > config.BounceMaxSize {
+		return 552, "message too large"
+	}
+
+	bounces, err := ParseReport(bytes.NewReader(raw), time.Now().UTC())
+	if err != nil {
+		s.log.Debugf("dropping received mail: %v", err)
+		return 250, "OK"
+	}
+
+	if err = s.process(ctx, bounces, false); err != nil {
+		return 451, "processing bounce failed, try again later"
+	}
+
+	return 250, "OK"
+}
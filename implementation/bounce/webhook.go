@@ -0,0 +1,600 @@
+package bounce
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // sns signs its version 1 messages with sha1
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"notif/implementation/email"
+	"notif/pkg"
+	"notif/pkg/config"
+)
+
+const (
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// maxCertSize bounds how much of an sns signing certificate is read.
+const maxCertSize = 64 << 10
+
+// snsHost is the host of the sns signing certificates and subscribe urls.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+var (
+	errInvalidKey = errors.New("sendgrid webhook key must be a base64 or pem encoded ecdsa public key")
+	errSNSURL     = errors.New("sns url must be https on an sns host")
+)
+
+// webhooks parses the bounce and complaint events of the providers, once
+// their signature is verified with the key of the provider. The providers
+// without a key are disabled.
+type webhooks struct {
+	sendGridKey *ecdsa.PublicKey
+	mailgunKey  []byte
+	sesTopicARN string
+	client      *http.Client
+	// tokens are the mailgun tokens and sns message ids seen within the
+	// tolerance.
+	tokens *tokenCache
+	// cert returns the sns signing certificate at url.
+	cert func(ctx context.Context, url string) (*x509.Certificate, error)
+}
+
+func newWebhooks(sendGridKey, mailgunKey, sesTopicARN string, client *http.Client) (*webhooks, error) {
+	w := &webhooks{
+		mailgunKey:  []byte(mailgunKey),
+		sesTopicARN: sesTopicARN,
+		client:      client,
+		tokens:      &tokenCache{seen: make(map[string]time.Time)},
+	}
+
+	if sendGridKey != "" {
+		key, err := parseECDSAKey(sendGridKey)
+		if err != nil {
+			return nil, err
+		}
+
+		w.sendGridKey = key
+	}
+
+	certs := &certCache{client: client, certs: make(map[string]*x509.Certificate)}
+	w.cert = certs.get
+
+	return w, nil
+}
+
+// parseECDSAKey parses the public key the sendgrid settings show, the
+// base64 of its der, or its pem.
+func parseECDSAKey(s string) (*ecdsa.PublicKey, error) {
+	der := []byte(s)
+
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	} else if d, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s)); err == nil {
+		der = d
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errInvalidKey
+	}
+
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errInvalidKey
+	}
+
+	return ecKey, nil
+}
+
+// parse returns the bounces of the webhook of provider.
+func (w *webhooks) parse(ctx context.Context, provider string, header http.Header, body []byte,
+	now time.Time) ([]Bounce, error) {
+	switch {
+	case provider == email.SendGrid && w.sendGridKey != nil:
+		return w.sendGrid(header, body, now)
+
+	case provider == email.Mailgun && len(w.mailgunKey) > 0:
+		return w.mailgun(body, now)
+
+	case provider == email.SES && w.sesTopicARN != "":
+		return w.ses(ctx, body, now)
+
+	default:
+		return nil, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  ErrUnknownProvider,
+		}
+	}
+}
+
+type sendGridEvent struct {
+	Email     string `json:"email"`
+	Event     string `json:"event"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Status    string `json:"status"`
+	Timestamp int64  `json:"timestamp"`
+	// NotifID is the custom arg of the message.
+	NotifID string `json:"notif_id"`
+}
+
+// sendGrid parses the events of the sendgrid event webhook, signed with
+// ecdsa over the timestamp followed by the body. Bounces are hard, blocks
+// soft and spam reports are complaints.
+func (w *webhooks) sendGrid(header http.Header, body []byte, now time.Time) ([]Bounce, error) {
+	sig, err := base64.StdEncoding.DecodeString(header.Get(sendGridSignatureHeader))
+	if err != nil {
+		return nil, unauthorized()
+	}
+
+	digest := sha256.Sum256(append([]byte(header.Get(sendGridTimestampHeader)), body...))
+	if !ecdsa.VerifyASN1(w.sendGridKey, digest[:], sig) {
+		return nil, unauthorized()
+	}
+
+	if _, ok := fresh(header.Get(sendGridTimestampHeader), now); !ok {
+		return nil, replayed()
+	}
+
+	var events []sendGridEvent
+	if err = json.Unmarshal(body, &events); err != nil {
+		return nil, badRequest(err)
+	}
+
+	bounces := make([]Bounce, 0, len(events))
+
+	for _, e := range events {
+		b := Bounce{
+			Recipient: e.Email,
+			NotifID:   e.NotifID,
+			Reason:    e.Reason,
+			At:        time.Unix(e.Timestamp, 0).UTC(),
+		}
+
+		switch {
+		case e.Event == "bounce" && e.Type == "blocked":
+			b.Type = Soft
+		case e.Event == "bounce":
+			b.Type = Hard
+		case e.Event == "spamreport":
+			b.Type, b.Reason = Complaint, "complaint: spam report"
+		default:
+			continue
+		}
+
+		bounces = append(bounces, b)
+	}
+
+	return bounces, nil
+}
+
+type mailgunWebhook struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event          string                 `json:"event"`
+		Severity       string                 `json:"severity"`
+		Reason         string                 `json:"reason"`
+		Recipient      string                 `json:"recipient"`
+		Timestamp      float64                `json:"timestamp"`
+		UserVariables  map[string]interface{} `json:"user-variables"`
+		DeliveryStatus struct {
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// mailgun parses an event of the mailgun webhooks, signed with the hmac
+// of the timestamp followed by the token. A token is accepted once.
+// Permanent failures are hard bounces unless mailgun gave up on a mail it
+// kept retrying, temporary failures are retried by mailgun and left out.
+func (w *webhooks) mailgun(body []byte, now time.Time) ([]Bounce, error) {
+	var hook mailgunWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return nil, badRequest(err)
+	}
+
+	mac := hmac.New(sha256.New, w.mailgunKey)
+	_, _ = mac.Write([]byte(hook.Signature.Timestamp + hook.Signature.Token))
+
+	sig, err := hex.DecodeString(hook.Signature.Signature)
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, unauthorized()
+	}
+
+	signedAt, ok := fresh(hook.Signature.Timestamp, now)
+	if !ok || !w.tokens.add(hook.Signature.Token, signedAt, now) {
+		return nil, replayed()
+	}
+
+	e := hook.EventData
+	notifID, _ := e.UserVariables[email.NotifIDVariable].(string)
+
+	b := Bounce{
+		Recipient: e.Recipient,
+		NotifID:   notifID,
+		Reason:    e.DeliveryStatus.Message,
+		At:        time.Unix(int64(e.Timestamp), 0).UTC(),
+	}
+
+	if b.Reason == "" {
+		b.Reason = e.DeliveryStatus.Description
+	}
+
+	switch {
+	case e.Event == "complained":
+		b.Type, b.Reason = Complaint, "complaint: spam report"
+	case e.Event == "failed" && e.Severity == "permanent" && strings.HasSuffix(e.Reason, "bounce"):
+		b.Type = Hard
+	case e.Event == "failed" && e.Severity == "permanent":
+		b.Type = Soft
+	default:
+		return []Bounce{}, nil
+	}
+
+	if b.Reason == "" {
+		b.Reason = e.Reason
+	}
+
+	return []Bounce{b}, nil
+}
+
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Token            string `json:"Token"`
+}
+
+type sesRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	// EventType replaces NotificationType in the events of configuration
+	// sets.
+	EventType string `json:"eventType"`
+	Bounce    struct {
+		BounceType        string         `json:"bounceType"`
+		BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+		Timestamp         time.Time      `json:"timestamp"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+		ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+		Timestamp             time.Time      `json:"timestamp"`
+	} `json:"complaint"`
+	Mail struct {
+		Headers []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+	} `json:"mail"`
+}
+
+// ses parses the bounce and complaint notifications of ses published to
+// the EMAIL_SES_TOPIC_ARN sns topic, confirming the subscription of the
+// webhook to it. The notification is told by the X-Notif-Id header of the
+// mail, given back when ses includes the original headers.
+func (w *webhooks) ses(ctx context.Context, body []byte, now time.Time) ([]Bounce, error) {
+	var m snsMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, badRequest(err)
+	}
+
+	if m.TopicArn != w.sesTopicARN {
+		return nil, unauthorized()
+	}
+
+	if err := w.verifySNS(ctx, &m); err != nil {
+		return nil, err
+	}
+
+	// a message is accepted once, while the timestamp sns signed is fresh
+	signedAt, err := time.Parse(time.RFC3339, m.Timestamp)
+	if err != nil || !within(signedAt, now) || !w.tokens.add(m.MessageID, signedAt, now) {
+		return nil, replayed()
+	}
+
+	if m.Type == "SubscriptionConfirmation" {
+		return []Bounce{}, w.confirm(ctx, m.SubscribeURL)
+	}
+
+	if m.Type != "Notification" {
+		return []Bounce{}, nil
+	}
+
+	var n sesNotification
+	if err = json.Unmarshal([]byte(m.Message), &n); err != nil {
+		return nil, badRequest(err)
+	}
+
+	var notifID string
+
+	for _, h := range n.Mail.Headers {
+		if strings.EqualFold(h.Name, email.IDHeader) {
+			notifID = h.Value
+		}
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	var bounces []Bounce
+
+	switch kind {
+	case "Bounce":
+		t := Soft
+		if n.Bounce.BounceType == "Permanent" {
+			t = Hard
+		}
+
+		for _, r := range n.Bounce.BouncedRecipients {
+			b := Bounce{Recipient: r.EmailAddress, NotifID: notifID, Type: t, Reason: value(r.DiagnosticCode),
+				At: orNow(n.Bounce.Timestamp, now)}
+			if b.Reason == "" {
+				b.Reason = r.Status
+			}
+
+			bounces = append(bounces, b)
+		}
+
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			bounces = append(bounces, Bounce{Recipient: r.EmailAddress, NotifID: notifID, Type: Complaint,
+				Reason: "complaint: " + n.Complaint.ComplaintFeedbackType, At: orNow(n.Complaint.Timestamp, now)})
+		}
+	}
+
+	return bounces, nil
+}
+
+// verifySNS checks the signature of m with the certificate of the sns
+// host it names.
+func (w *webhooks) verifySNS(ctx context.Context, m *snsMessage) error {
+	fields := []string{"Message", m.Message, "MessageId", m.MessageID}
+
+	switch m.Type {
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = append(fields, "SubscribeURL", m.SubscribeURL, "Timestamp", m.Timestamp, "Token", m.Token)
+	default:
+		if m.Subject != "" {
+			fields = append(fields, "Subject", m.Subject)
+		}
+
+		fields = append(fields, "Timestamp", m.Timestamp)
+	}
+
+	fields = append(fields, "TopicArn", m.TopicArn, "Type", m.Type)
+	signed := []byte(strings.Join(fields, "\n") + "\n")
+
+	var (
+		hash   crypto.Hash
+		digest []byte
+	)
+
+	switch m.SignatureVersion {
+	case "1":
+		sum := sha1.Sum(signed) //nolint:gosec // sns signs its version 1 messages with sha1
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256(signed)
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return unauthorized()
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return unauthorized()
+	}
+
+	if !validSNSURL(m.SigningCertURL) {
+		return unauthorized()
+	}
+
+	cert, err := w.cert(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+		return unauthorized()
+	}
+
+	return nil
+}
+
+// confirm subscribes the webhook to the topic by visiting subscribeURL.
+func (w *webhooks) confirm(ctx context.Context, subscribeURL string) error {
+	if !validSNSURL(subscribeURL) {
+		return badRequest(errSNSURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subscribeURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxCertSize))
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("confirming sns subscription failed with status " + resp.Status)
+	}
+
+	return nil
+}
+
+// validSNSURL tells whether rawURL is served by sns over https.
+func validSNSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+
+	return err == nil && u.Scheme == "https" && snsHost.MatchString(u.Hostname())
+}
+
+// certCache fetches the sns signing certificates once.
+type certCache struct {
+	client *http.Client
+	mu     sync.Mutex
+	certs  map[string]*x509.Certificate
+}
+
+func (c *certCache) get(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	c.mu.Lock()
+	cert, ok := c.certs[certURL]
+	c.mu.Unlock()
+
+	if ok {
+		return cert, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCertSize))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if resp.StatusCode != http.StatusOK || block == nil {
+		return nil, errors.New("fetching sns signing certificate failed with status " + resp.Status)
+	}
+
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.certs[certURL] = cert
+	c.mu.Unlock()
+
+	return cert, nil
+}
+
+// fresh parses the unix timestamp a webhook was signed at, and tells
+// whether it is within the tolerance of now.
+func fresh(timestamp string, now time.Time) (time.Time, bool) {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	at := time.Unix(sec, 0)
+
+	return at, within(at, now)
+}
+
+// within tells whether at is within the tolerance of now.
+func within(at, now time.Time) bool {
+	d := now.Sub(at)
+	return d <= config.BounceWebhookTolerance && d >= -config.BounceWebhookTolerance
+}
+
+// tokenCache keeps the mailgun tokens and sns message ids signed within
+// the tolerance, older ones are refused by their timestamp anyway.
+type tokenCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// add records token signed at, it returns false when token was seen.
+func (c *tokenCache) add(token string, at, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for t, signedAt := range c.seen {
+		if now.Sub(signedAt) > config.BounceWebhookTolerance {
+			delete(c.seen, t)
+		}
+	}
+
+	if _, ok := c.seen[token]; ok {
+		return false
+	}
+
+	c.seen[token] = at
+
+	return true
+}
+
+func orNow(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+
+	return t.UTC()
+}
+
+func badRequest(err error) error {
+	return pkg.NotifErr{
+		Code: http.StatusBadRequest,
+		Err:  err,
+	}
+}
+
+func unauthorized() error {
+	return pkg.NotifErr{
+		Code: http.StatusUnauthorized,
+		Err:  ErrSignature,
+	}
+}
+
+func replayed() error {
+	return pkg.NotifErr{
+		Code: http.StatusUnauthorized,
+		Err:  ErrReplay,
+	}
+}
@@ -0,0 +1,240 @@
+package bounce
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"notif/implementation/email"
+	"notif/pkg"
+
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)
+
+// requireStatus checks err is a pkg.Error of code.
+func requireStatus(t *testing.T, code int, err error) {
+	var pErr pkg.Error
+	require.True(t, errors.As(err, &pErr), err)
+	require.Equal(t, code, pErr.Status())
+}
+
+func TestSendGridWebhook(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	w, err := newWebhooks(base64.StdEncoding.EncodeToString(der), "", "", http.DefaultClient)
+	require.NoError(t, err)
+
+	body := []byte(`[
+		{"email":"jane@example.com","event":"bounce","type":"bounce","reason":"550 5.1.1 unknown","timestamp":1646128800,"notif_id":"n1"},
+		{"email":"full@example.com","event":"bounce","type":"blocked","reason":"452 4.2.2 full","timestamp":1646128800},
+		{"email":"joe@example.com","event":"spamreport","timestamp":1646128800,"notif_id":"n2"},
+		{"email":"jane@example.com","event":"delivered","timestamp":1646128800}
+	]`)
+
+	digest := sha256.Sum256(append([]byte("1646128800"), body...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set(sendGridTimestampHeader, "1646128800")
+	header.Set(sendGridSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+
+	received := time.Unix(1646128860, 0)
+
+	bounces, err := w.parse(context.Background(), email.SendGrid, header, body, received)
+	require.NoError(t, err)
+	require.Equal(t, []Bounce{
+		{Recipient: "jane@example.com", NotifID: "n1", Type: Hard, Reason: "550 5.1.1 unknown", At: time.Unix(1646128800, 0).UTC()},
+		{Recipient: "full@example.com", Type: Soft, Reason: "452 4.2.2 full", At: time.Unix(1646128800, 0).UTC()},
+		{Recipient: "joe@example.com", NotifID: "n2", Type: Complaint, Reason: "complaint: spam report", At: time.Unix(1646128800, 0).UTC()},
+	}, bounces)
+
+	// a captured webhook is refused once stale
+	_, err = w.parse(context.Background(), email.SendGrid, header, body, now)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrReplay)
+
+	header.Set(sendGridTimestampHeader, "1646128801")
+	_, err = w.parse(context.Background(), email.SendGrid, header, body, received)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrSignature)
+
+	// the providers without a key are disabled
+	_, err = w.parse(context.Background(), email.Mailgun, header, body, now)
+	requireStatus(t, http.StatusNotFound, err)
+}
+
+func TestMailgunWebhook(t *testing.T) {
+	w, err := newWebhooks("", "signing-key", "", http.DefaultClient)
+	require.NoError(t, err)
+
+	received := time.Unix(1646128860, 0)
+
+	sign := func(token, event, severity, reason string) []byte {
+		mac := hmac.New(sha256.New, []byte("signing-key"))
+		_, _ = mac.Write([]byte("1646128800" + token))
+
+		hook := mailgunWebhook{}
+		hook.Signature.Timestamp, hook.Signature.Token = "1646128800", token
+		hook.Signature.Signature = hex.EncodeToString(mac.Sum(nil))
+		hook.EventData.Event, hook.EventData.Severity, hook.EventData.Reason = event, severity, reason
+		hook.EventData.Recipient, hook.EventData.Timestamp = "jane@example.com", 1646128800.5
+		hook.EventData.UserVariables = map[string]interface{}{email.NotifIDVariable: "n1"}
+		hook.EventData.DeliveryStatus.Message = "550 5.1.1 unknown"
+
+		body, err := json.Marshal(hook)
+		require.NoError(t, err)
+
+		return body
+	}
+
+	post := func(event, severity, reason string) ([]Bounce, error) {
+		return w.parse(context.Background(), email.Mailgun, http.Header{},
+			sign(event+severity+reason, event, severity, reason), received)
+	}
+
+	bounces, err := post("failed", "permanent", "bounce")
+	require.NoError(t, err)
+	require.Equal(t, []Bounce{{Recipient: "jane@example.com", NotifID: "n1", Type: Hard, Reason: "550 5.1.1 unknown",
+		At: time.Unix(1646128800, 0).UTC()}}, bounces)
+
+	bounces, err = post("failed", "permanent", "old")
+	require.NoError(t, err)
+	require.Equal(t, Soft, bounces[0].Type)
+
+	bounces, err = post("failed", "temporary", "generic")
+	require.NoError(t, err)
+	require.Empty(t, bounces)
+
+	bounces, err = post("complained", "", "")
+	require.NoError(t, err)
+	require.Equal(t, Complaint, bounces[0].Type)
+
+	_, err = w.parse(context.Background(), email.Mailgun, http.Header{},
+		[]byte(`{"signature":{"timestamp":"1","token":"t","signature":"00"}}`), received)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrSignature)
+
+	// a token is accepted once, and a stale one not at all
+	_, err = w.parse(context.Background(), email.Mailgun, http.Header{},
+		sign("failedpermanentbounce", "failed", "permanent", "bounce"), received)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrReplay)
+
+	_, err = w.parse(context.Background(), email.Mailgun, http.Header{},
+		sign("new", "failed", "permanent", "bounce"), now)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrReplay)
+}
+
+func TestSESWebhook(t *testing.T) {
+	const topic = "arn:aws:sns:eu-west-1:123456789012:bounces"
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: now.Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	w, err := newWebhooks("", "", topic, http.DefaultClient)
+	require.NoError(t, err)
+
+	w.cert = func(_ context.Context, url string) (*x509.Certificate, error) {
+		require.Equal(t, "https://sns.eu-west-1.amazonaws.com/cert.pem", url)
+		return cert, nil
+	}
+
+	notification := `{"notificationType":"Bounce","bounce":{"bounceType":"Permanent","timestamp":"2022-03-01T10:00:00Z",` +
+		`"bouncedRecipients":[{"emailAddress":"jane@example.com","status":"5.1.1","diagnosticCode":"smtp; 550 5.1.1 unknown"}]},` +
+		`"mail":{"headers":[{"name":"X-Notif-Id","value":"n1"}]}}`
+
+	// sign returns the body of m signed
+	sign := func(m snsMessage) []byte {
+		signed := strings.Join([]string{"Message", m.Message, "MessageId", m.MessageID, "Timestamp", m.Timestamp,
+			"TopicArn", m.TopicArn, "Type", m.Type}, "\n") + "\n"
+		digest := sha256.Sum256([]byte(signed))
+
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+
+		m.Signature = base64.StdEncoding.EncodeToString(sig)
+
+		body, err := json.Marshal(m)
+		require.NoError(t, err)
+
+		return body
+	}
+
+	m := snsMessage{
+		Type:             "Notification",
+		MessageID:        "m1",
+		TopicArn:         topic,
+		Message:          notification,
+		Timestamp:        "2022-03-01T10:00:01.000Z",
+		SignatureVersion: "2",
+		SigningCertURL:   "https://sns.eu-west-1.amazonaws.com/cert.pem",
+	}
+	received := time.Date(2022, 3, 1, 10, 1, 0, 0, time.UTC)
+
+	body := sign(m)
+
+	bounces, err := w.parse(context.Background(), email.SES, http.Header{}, body, received)
+	require.NoError(t, err)
+	require.Equal(t, []Bounce{{Recipient: "jane@example.com", NotifID: "n1", Type: Hard, Reason: "550 5.1.1 unknown",
+		At: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)}}, bounces)
+
+	// a message is accepted once, and a stale one not at all
+	_, err = w.parse(context.Background(), email.SES, http.Header{}, body, received)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrReplay)
+
+	m.MessageID = "m2"
+	_, err = w.parse(context.Background(), email.SES, http.Header{}, sign(m), now)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrReplay)
+
+	// a tampered message fails its signature
+	m.MessageID = "m3"
+	require.NoError(t, json.Unmarshal(sign(m), &m))
+
+	m.Message = strings.Replace(notification, "Permanent", "Transient", 1)
+	body, err = json.Marshal(m)
+	require.NoError(t, err)
+
+	_, err = w.parse(context.Background(), email.SES, http.Header{}, body, received)
+	requireStatus(t, http.StatusUnauthorized, err)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrSignature)
+
+	// the certificate must be served by sns
+	m.SigningCertURL = "https://example.com/cert.pem"
+	body, err = json.Marshal(m)
+	require.NoError(t, err)
+
+	_, err = w.parse(context.Background(), email.SES, http.Header{}, body, received)
+	requireStatus(t, http.StatusUnauthorized, err)
+}
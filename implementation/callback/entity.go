@@ -0,0 +1,103 @@
+package callback
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"notif/implementation/status"
+)
+
+// EventHeader carries the status of the notification a callback is about.
+const EventHeader = "X-Notif-Event"
+
+var (
+	ErrNotFound      = errors.New("no callback is registered for the tenant")
+	ErrInvalidTenant = errors.New("tenant must be 1 to 64 letters, digits, '-' or '_'")
+	ErrInvalidEvent  = errors.New("callback events must be statuses a notification is moved to by its delivery")
+)
+
+// DefaultEvents are the statuses pushed to a callback not telling its
+// events, the ones a notification ends in.
+var DefaultEvents = []status.Status{status.Sent, status.Failed, status.DeadLettered}
+
+// events are the statuses a callback may be registered for.
+var events = map[status.Status]bool{
+	status.Processing:   true,
+	status.Sent:         true,
+	status.Retrying:     true,
+	status.Failed:       true,
+	status.DeadLettered: true,
+}
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Callback is the url the status changes of the notifications of a tenant
+// are pushed to, kept in the NOTIF_CALLBACKS bucket under the tenant.
+type Callback struct {
+	Tenant string `json:"tenant"`
+	URL    string `json:"url" validate:"required,url"`
+	// Events are the statuses pushed, DefaultEvents when empty.
+	Events    []status.Status `json:"events,omitempty"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// EventsValidation checks the callback is only registered for the
+// statuses set by the delivery of a notification.
+func (c *Callback) EventsValidation() error {
+	for i := range c.Events {
+		if !events[c.Events[i]] {
+			return ErrInvalidEvent
+		}
+	}
+
+	return nil
+}
+
+// Wants tells whether st is one of events, or of DefaultEvents when
+// events is empty.
+func Wants(events []status.Status, st status.Status) bool {
+	if len(events) == 0 {
+		events = DefaultEvents
+	}
+
+	for i := range events {
+		if events[i] == st {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidTenant tells whether tenant can key a callback.
+func ValidTenant(tenant string) bool {
+	return tenantPattern.MatchString(tenant)
+}
+
+// Event is the payload pushed to a callback when a notification moved to
+// Status.
+type Event struct {
+	ID         string                       `json:"id"`
+	Tenant     string                       `json:"tenant,omitempty"`
+	Channel    string                       `json:"channel"`
+	Status     status.Status                `json:"status"`
+	Error      string                       `json:"error,omitempty"`
+	Deliveries uint64                       `json:"deliveries"`
+	Recipients map[string]*status.Recipient `json:"recipients,omitempty"`
+	At         time.Time                    `json:"at"`
+}
+
+// NewEvent returns the event of the status r moved to.
+func NewEvent(r status.Record) Event {
+	return Event{
+		ID:         r.ID,
+		Tenant:     r.Tenant,
+		Channel:    r.Channel,
+		Status:     r.Status,
+		Error:      r.Error,
+		Deliveries: r.Deliveries,
+		Recipients: r.Recipients,
+		At:         r.UpdatedAt,
+	}
+}
@@ -0,0 +1,34 @@
+package callback
+
+import (
+	"testing"
+
+	"notif/implementation/status"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWants(t *testing.T) {
+	require.True(t, Wants(nil, status.Sent))
+	require.True(t, Wants(nil, status.DeadLettered))
+	require.False(t, Wants(nil, status.Processing))
+
+	events := []status.Status{status.Processing}
+	require.True(t, Wants(events, status.Processing))
+	require.False(t, Wants(events, status.Sent))
+}
+
+func TestEventsValidation(t *testing.T) {
+	c := Callback{Events: []status.Status{status.Sent, status.Retrying}}
+	require.NoError(t, c.EventsValidation())
+
+	c.Events = append(c.Events, status.Queued)
+	require.ErrorIs(t, c.EventsValidation(), ErrInvalidEvent)
+}
+
+func TestValidTenant(t *testing.T) {
+	require.True(t, ValidTenant("acme_eu-1"))
+	require.False(t, ValidTenant(""))
+	require.False(t, ValidTenant("acme.eu"))
+	require.False(t, ValidTenant("acme/eu"))
+}
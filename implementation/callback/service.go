@@ -0,0 +1,152 @@
+// Package callback keeps the url every tenant wants the status changes of
+// its notifications pushed to, in the NOTIF_CALLBACKS bucket.
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	// Register saves the callback c of its tenant, replacing the one
+	// registered before.
+	Register(ctx context.Context, c Callback) (Callback, error)
+	// Get returns the callback of tenant.
+	Get(ctx context.Context, tenant string) (Callback, error)
+	// Delete removes the callback of tenant.
+	Delete(ctx context.Context, tenant string) error
+}
+
+type service struct {
+	kv       nats.KeyValue
+	validate *validator.Validate
+	log      *zap.SugaredLogger
+	tracer   trace.Tracer
+}
+
+// NewCallbackService returns a Service over the callbacks of kv.
+func NewCallbackService(l *zap.SugaredLogger, kv nats.KeyValue, t trace.Tracer) Service {
+	return &service{
+		kv:       kv,
+		validate: validator.New(),
+		log:      l,
+		tracer:   t,
+	}
+}
+
+func (s *service) Register(ctx context.Context, c Callback) (Callback, error) {
+	_, span := s.tracer.Start(ctx, "callback.svc-register")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.tenant", c.Tenant))
+
+	if !ValidTenant(c.Tenant) {
+		return Callback{}, s.fail(span, badRequest(ErrInvalidTenant))
+	}
+
+	if err := s.validate.Struct(c); err != nil {
+		return Callback{}, s.fail(span, badRequest(err))
+	}
+
+	if err := c.EventsValidation(); err != nil {
+		return Callback{}, s.fail(span, badRequest(err))
+	}
+
+	c.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return Callback{}, s.fail(span, err)
+	}
+
+	if _, err = s.kv.Put(c.Tenant, data); err != nil {
+		return Callback{}, s.fail(span, err)
+	}
+
+	return c, nil
+}
+
+func (s *service) Get(ctx context.Context, tenant string) (Callback, error) {
+	_, span := s.tracer.Start(ctx, "callback.svc-get")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.tenant", tenant))
+
+	c, err := s.get(tenant)
+	if err != nil {
+		return Callback{}, s.fail(span, err)
+	}
+
+	return c, nil
+}
+
+func (s *service) Delete(ctx context.Context, tenant string) error {
+	_, span := s.tracer.Start(ctx, "callback.svc-delete")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.tenant", tenant))
+
+	if _, err := s.get(tenant); err != nil {
+		return s.fail(span, err)
+	}
+
+	if err := s.kv.Delete(tenant); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+// get returns the callback of tenant, failing with a 404 when none is
+// registered.
+func (s *service) get(tenant string) (Callback, error) {
+	if !ValidTenant(tenant) {
+		return Callback{}, badRequest(ErrInvalidTenant)
+	}
+
+	kve, err := s.kv.Get(tenant)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Callback{}, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  ErrNotFound,
+		}
+	}
+
+	if err != nil {
+		return Callback{}, err
+	}
+
+	var c Callback
+	if err = json.Unmarshal(kve.Value(), &c); err != nil {
+		return Callback{}, err
+	}
+
+	return c, nil
+}
+
+func badRequest(err error) error {
+	return pkg.NotifErr{
+		Code: http.StatusBadRequest,
+		Err:  err,
+	}
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,130 @@
+// Package channel abstracts the kinds of notification notif can deliver,
+// so the consumer loop routes every event to its channel without knowing
+// about email, sms or any other transport.
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"notif/pkg/config"
+)
+
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Channel delivers one kind of notification. Notifications are passed
+// around as interface{} and every channel asserts its own type.
+type Channel interface {
+	// Name is the token of the NOTIFS.<name>.send subject of the channel.
+	Name() string
+	// Decode unmarshals a payload into the notification of the channel.
+	Decode(data []byte) (interface{}, error)
+	// Validate checks a decoded notification before it is published.
+	Validate(n interface{}) error
+	// Render expands a notification in the messages to send, e.g. one
+	// per recipient when it uses a template.
+	Render(ctx context.Context, n interface{}) ([]interface{}, error)
+	// Send delivers a rendered message.
+	Send(ctx context.Context, n interface{}) error
+}
+
+// Addressed is implemented by the channels whose notifications have
+// recipients, so their delivery status is tracked per recipient.
+type Addressed interface {
+	// Recipients returns the recipients of a notification or of a
+	// rendered message.
+	Recipients(n interface{}) []string
+}
+
+// Recipients returns the recipients of n when c is Addressed.
+func Recipients(c Channel, n interface{}) []string {
+	if a, ok := c.(Addressed); ok {
+		return a.Recipients(n)
+	}
+
+	return nil
+}
+
+type idKey struct{}
+
+// WithID returns ctx carrying the id of the notification being sent, so
+// the channels can tag what they send with it.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// ID returns the id of the notification sent with ctx, empty when none.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Registry holds the channels by name.
+type Registry struct {
+	mu       sync.RWMutex
+	channels map[string]Channel
+}
+
+func NewRegistry(channels ...Channel) *Registry {
+	r := &Registry{channels: make(map[string]Channel)}
+	for i := range channels {
+		r.Register(channels[i])
+	}
+
+	return r
+}
+
+// Register adds a channel, replacing the one registered with its name.
+func (r *Registry) Register(c Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.channels[c.Name()] = c
+}
+
+// Get returns the channel registered with name.
+func (r *Registry) Get(name string) (Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.channels[name]
+	if !ok {
+		return nil, ErrUnknownChannel
+	}
+
+	return c, nil
+}
+
+// Names returns the names of the registered channels in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.channels))
+	for name := range r.channels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Subject returns the subject notifications of a channel are published on.
+func Subject(name string) string {
+	return fmt.Sprintf("%s.%s.send", config.StreamName, name)
+}
+
+// NameFromSubject returns the channel a notification was published for.
+func NameFromSubject(subj string) (string, error) {
+	parts := strings.Split(subj, ".")
+	if len(parts) != 3 || parts[0] != config.StreamName || parts[2] != "send" {
+		return "", ErrUnknownChannel
+	}
+
+	return parts[1], nil
+}
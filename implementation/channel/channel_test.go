@@ -0,0 +1,52 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nopChannel string
+
+func (n nopChannel) Name() string                                             { return string(n) }
+func (nopChannel) Decode([]byte) (interface{}, error)                         { return nil, nil }
+func (nopChannel) Validate(interface{}) error                                 { return nil }
+func (nopChannel) Render(context.Context, interface{}) ([]interface{}, error) { return nil, nil }
+func (nopChannel) Send(context.Context, interface{}) error                    { return nil }
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(nopChannel("sms"), nopChannel("email"))
+
+	ch, err := r.Get("sms")
+	require.NoError(t, err)
+	require.Equal(t, "sms", ch.Name())
+
+	_, err = r.Get("fax")
+	require.ErrorIs(t, err, ErrUnknownChannel)
+
+	require.Equal(t, []string{"email", "sms"}, r.Names())
+}
+
+func TestSubject(t *testing.T) {
+	require.Equal(t, "NOTIFS.sms.send", Subject("sms"))
+
+	name, err := NameFromSubject(Subject("push"))
+	require.NoError(t, err)
+	require.Equal(t, "push", name)
+
+	for _, subj := range []string{"NOTIFS.send", "OTHER.sms.send", "NOTIFS.sms.recv"} {
+		_, err = NameFromSubject(subj)
+		require.ErrorIs(t, err, ErrUnknownChannel, subj)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("rejected")
+
+	require.True(t, IsPermanent(Permanent(base)))
+	require.True(t, IsPermanent(&PartialError{Err: Permanent(base)}))
+	require.False(t, IsPermanent(base))
+	require.ErrorIs(t, Permanent(base), base)
+}
@@ -0,0 +1,116 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DeliveryStatus is the outcome of a send for a single recipient.
+type DeliveryStatus string
+
+const (
+	// Delivered means the provider accepted the recipient.
+	Delivered DeliveryStatus = "delivered"
+	// Rejected means the provider refused the recipient for good.
+	Rejected DeliveryStatus = "rejected"
+	// Unregistered means the provider no longer knows the recipient, like
+	// a device token of an uninstalled app. It must not be used again.
+	Unregistered DeliveryStatus = "unregistered"
+	// Deferred means the send failed but may succeed later.
+	Deferred DeliveryStatus = "deferred"
+)
+
+// Result is the delivery outcome for one recipient.
+type Result struct {
+	Recipient string
+	Status    DeliveryStatus
+	Err       error
+	// Via names what took the recipient, like the smtp transport of the
+	// last attempt.
+	Via string
+	// MessageID is the id the provider gave to the delivery, if any.
+	MessageID string
+}
+
+// DeliveryError is returned when one or more recipients of a message were
+// not delivered. It carries the result of every recipient so callers can
+// retry only the deferred ones.
+type DeliveryError struct {
+	Results []Result
+}
+
+func (d *DeliveryError) Error() string {
+	failed := make([]string, 0, len(d.Results))
+	for i := range d.Results {
+		if d.Results[i].Status != Delivered {
+			failed = append(failed, fmt.Sprintf("%s %s: %v",
+				d.Results[i].Recipient, d.Results[i].Status, d.Results[i].Err))
+		}
+	}
+
+	return "delivery failed for " + strings.Join(failed, "; ")
+}
+
+// Deferred returns the recipients that may succeed on a later attempt.
+func (d *DeliveryError) Deferred() []string {
+	return d.recipients(Deferred)
+}
+
+// Unregistered returns the recipients the provider no longer knows.
+func (d *DeliveryError) Unregistered() []string {
+	return d.recipients(Unregistered)
+}
+
+// Failures returns the error of every recipient not delivered, only the
+// deferred ones are not permanent.
+func (d *DeliveryError) Failures() map[string]error {
+	failures := make(map[string]error)
+
+	for i := range d.Results {
+		switch d.Results[i].Status {
+		case Deferred:
+			failures[d.Results[i].Recipient] = d.Results[i].Err
+		case Rejected:
+			failures[d.Results[i].Recipient] = Permanent(d.Results[i].Err)
+		case Unregistered:
+			failures[d.Results[i].Recipient] = Permanent(&UnregisteredError{Err: d.Results[i].Err})
+		case Delivered:
+		}
+	}
+
+	return failures
+}
+
+func (d *DeliveryError) recipients(status DeliveryStatus) []string {
+	var rcpts []string
+
+	for i := range d.Results {
+		if d.Results[i].Status == status {
+			rcpts = append(rcpts, d.Results[i].Recipient)
+		}
+	}
+
+	return rcpts
+}
+
+// UnregisteredError is the failure of a recipient the provider no longer
+// knows.
+type UnregisteredError struct {
+	Err error
+}
+
+func (u *UnregisteredError) Error() string {
+	return u.Err.Error()
+}
+
+func (u *UnregisteredError) Unwrap() error {
+	return u.Err
+}
+
+// IsUnregistered tells whether err, or an error it wraps, is the failure
+// of an unregistered recipient.
+func IsUnregistered(err error) bool {
+	var uErr *UnregisteredError
+	return errors.As(err, &uErr)
+}
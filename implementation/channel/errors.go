@@ -0,0 +1,91 @@
+package channel
+
+import (
+	"errors"
+	"time"
+)
+
+// PermanentError marks a failure that retrying will not fix, such as a
+// rejected recipient or an invalid payload.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps err as a PermanentError.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (p *PermanentError) Error() string {
+	return p.Err.Error()
+}
+
+func (p *PermanentError) Unwrap() error {
+	return p.Err
+}
+
+// IsPermanent tells whether err, or an error it wraps, is permanent.
+func IsPermanent(err error) bool {
+	var pErr *PermanentError
+	return errors.As(err, &pErr)
+}
+
+// PartialError is returned by Send when part of a message was delivered.
+// Next is what is left to send, so a retry does not deliver twice.
+type PartialError struct {
+	Err  error
+	Next interface{}
+}
+
+func (p *PartialError) Error() string {
+	return p.Err.Error()
+}
+
+func (p *PartialError) Unwrap() error {
+	return p.Err
+}
+
+// RetryAfterError asks the retry loop to wait After before the next
+// attempt, as a rate limited api tells with Retry-After.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (r *RetryAfterError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *RetryAfterError) Unwrap() error {
+	return r.Err
+}
+
+// RetryAfter returns the delay asked by err, if any.
+func RetryAfter(err error) (time.Duration, bool) {
+	var rErr *RetryAfterError
+	if errors.As(err, &rErr) && rErr.After > 0 {
+		return rErr.After, true
+	}
+
+	return 0, false
+}
+
+// RecipientsError is returned by Send when some recipients of a message
+// were not delivered, the ones left out of Failures were.
+type RecipientsError interface {
+	error
+	// Failures returns the error of every recipient not delivered, made
+	// Permanent when retrying will not fix it.
+	Failures() map[string]error
+}
+
+// Failures returns the error of every recipient err tells about, nil
+// when err does not tell apart the recipients.
+func Failures(err error) map[string]error {
+	var rErr RecipientsError
+	if errors.As(err, &rErr) {
+		return rErr.Failures()
+	}
+
+	return nil
+}
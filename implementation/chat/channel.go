@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ChannelName is the channel token of chat notifications.
+const ChannelName = "chat"
+
+var ErrNotAnEntity = errors.New("notification is not a chat entity")
+
+type chatChannel struct {
+	svc          Service
+	allowedHosts []string
+	validate     *validator.Validate
+}
+
+// NewChannel returns the chat notification channel sending through svc to
+// the webhooks of the allowed hosts.
+func NewChannel(svc Service, allowedHosts []string) channel.Channel {
+	hosts := make([]string, 0, len(allowedHosts))
+	for i := range allowedHosts {
+		if h := strings.ToLower(strings.TrimSpace(allowedHosts[i])); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return &chatChannel{
+		svc:          svc,
+		allowedHosts: hosts,
+		validate:     validator.New(),
+	}
+}
+
+func (c *chatChannel) Name() string {
+	return ChannelName
+}
+
+func (c *chatChannel) Decode(data []byte) (interface{}, error) {
+	var e Entity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return e, nil
+}
+
+func (c *chatChannel) Validate(n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return ErrNotAnEntity
+	}
+
+	if err := c.validate.Struct(e); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	if err := e.HostValidation(c.allowedHosts); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
+
+func (c *chatChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+// Send posts the message. A 429 is retried after its Retry-After, server
+// errors and timeouts are retried with the default delay and any other
+// status is permanent.
+func (c *chatChannel) Send(ctx context.Context, n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return channel.Permanent(ErrNotAnEntity)
+	}
+
+	err := c.svc.SendChat(ctx, e)
+
+	var sErr *StatusError
+	if !errors.As(err, &sErr) {
+		return err
+	}
+
+	switch {
+	case sErr.Code == http.StatusTooManyRequests:
+		return &channel.RetryAfterError{Err: err, After: sErr.RetryAfter}
+
+	case sErr.Code >= http.StatusInternalServerError:
+		return err
+
+	default:
+		return channel.Permanent(err)
+	}
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrHostNotAllowed = errors.New("chat webhook host is not allowed")
+
+const (
+	// Slack posts Block Kit messages to slack incoming webhooks.
+	Slack = "slack"
+	// Teams posts MessageCards to microsoft teams incoming webhooks.
+	Teams = "teams"
+)
+
+// Entity is a chat message posted to an incoming-webhook url.
+type Entity struct {
+	Platform string  `json:"platform" validate:"required,oneof=slack teams"`
+	URL      string  `json:"url" validate:"required,url"`
+	Title    string  `json:"title,omitempty" validate:"max=150"`
+	Text     string  `json:"text" validate:"required,max=3000"`
+	Color    string  `json:"color,omitempty" validate:"omitempty,hexcolor"`
+	Fields   []Field `json:"fields,omitempty" validate:"max=10,dive"`
+	Link     *Link   `json:"link,omitempty"`
+}
+
+// Field is a label and value pair shown under the text.
+type Field struct {
+	Name  string `json:"name" validate:"required"`
+	Value string `json:"value" validate:"required"`
+}
+
+// Link is rendered as a button opening URL.
+type Link struct {
+	Text string `json:"text" validate:"required"`
+	URL  string `json:"url" validate:"required,url"`
+}
+
+// HostValidation checks the webhook url points to one of the allowed
+// hosts or a subdomain of them, so notif cannot be used to reach any
+// other server.
+func (e *Entity) HostValidation(allowed []string) error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return err
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for i := range allowed {
+		if host == allowed[i] || strings.HasSuffix(host, "."+allowed[i]) {
+			return nil
+		}
+	}
+
+	return ErrHostNotAllowed
+}
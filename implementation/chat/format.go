@@ -0,0 +1,98 @@
+package chat
+
+import "encoding/json"
+
+// slackMessage builds the Block Kit payload, text is the fallback shown
+// in notifications.
+func slackMessage(e Entity) ([]byte, error) {
+	blocks := make([]interface{}, 0, 4)
+
+	if e.Title != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": e.Title},
+		})
+	}
+
+	blocks = append(blocks, map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": e.Text},
+	})
+
+	if len(e.Fields) > 0 {
+		fields := make([]interface{}, len(e.Fields))
+		for i := range e.Fields {
+			fields[i] = map[string]interface{}{"type": "mrkdwn", "text": "*" + e.Fields[i].Name + "*\n" + e.Fields[i].Value}
+		}
+
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+
+	if e.Link != nil {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []interface{}{map[string]interface{}{
+				"type": "button",
+				"text": map[string]interface{}{"type": "plain_text", "text": e.Link.Text},
+				"url":  e.Link.URL,
+			}},
+		})
+	}
+
+	msg := map[string]interface{}{"text": fallback(e), "blocks": blocks}
+
+	// slack only colors the legacy attachments, so the blocks move in one
+	if e.Color != "" {
+		msg = map[string]interface{}{
+			"text":        fallback(e),
+			"attachments": []interface{}{map[string]interface{}{"color": e.Color, "blocks": blocks}},
+		}
+	}
+
+	return json.Marshal(msg)
+}
+
+// teamsMessage builds the MessageCard payload.
+func teamsMessage(e Entity) ([]byte, error) {
+	card := map[string]interface{}{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  fallback(e),
+		"text":     e.Text,
+	}
+
+	if e.Title != "" {
+		card["title"] = e.Title
+	}
+
+	if e.Color != "" {
+		card["themeColor"] = e.Color
+	}
+
+	if len(e.Fields) > 0 {
+		facts := make([]interface{}, len(e.Fields))
+		for i := range e.Fields {
+			facts[i] = map[string]interface{}{"name": e.Fields[i].Name, "value": e.Fields[i].Value}
+		}
+
+		card["sections"] = []interface{}{map[string]interface{}{"facts": facts}}
+	}
+
+	if e.Link != nil {
+		card["potentialAction"] = []interface{}{map[string]interface{}{
+			"@type":   "OpenUri",
+			"name":    e.Link.Text,
+			"targets": []interface{}{map[string]interface{}{"os": "default", "uri": e.Link.URL}},
+		}}
+	}
+
+	return json.Marshal(card)
+}
+
+func fallback(e Entity) string {
+	if e.Title != "" {
+		return e.Title
+	}
+
+	return e.Text
+}
@@ -0,0 +1,142 @@
+// Package chat posts chat-ops messages to slack and microsoft teams
+// incoming webhooks.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"notif/pkg/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxErrBody bounds how much of an error response is kept for the logs.
+const maxErrBody = 1 << 10
+
+type Service interface {
+	// SendChat posts the message and fails with a *StatusError when the
+	// webhook does not answer with a 2xx.
+	SendChat(ctx context.Context, e Entity) error
+}
+
+// StatusError is returned when the webhook answers with a non 2xx status.
+// RetryAfter is set from the Retry-After header of a 429.
+type StatusError struct {
+	Code       int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("chat webhook responded with status %d: %s", e.Code, e.Body)
+}
+
+type service struct {
+	log         *zap.SugaredLogger
+	client      *http.Client
+	tracer      trace.Tracer
+	propagators propagation.TextMapPropagator
+}
+
+// NewChatService returns a Service which propagates the trace of the
+// notification to the webhook with p, like messageSvc does through nats.
+func NewChatService(logger *zap.SugaredLogger, t trace.Tracer, p propagation.TextMapPropagator) Service {
+	return &service{
+		log:         logger,
+		client:      &http.Client{Timeout: config.ChatTimeOut},
+		tracer:      t,
+		propagators: p,
+	}
+}
+
+func (s *service) SendChat(ctx context.Context, e Entity) error {
+	ctx, span := s.tracer.Start(ctx, "sendChat-func")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	span.SetAttributes(attribute.String("chat.platform", e.Platform))
+
+	payload, err := format(e)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(payload))
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	s.propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrBody))
+
+		return s.fail(span, traceID, &StatusError{
+			Code:       resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		})
+	}
+
+	// draining the body lets the connection be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	s.log.Debugw("chat message posted", "platform", e.Platform, "traceID", traceID)
+
+	return nil
+}
+
+func format(e Entity) ([]byte, error) {
+	if e.Platform == Teams {
+		return teamsMessage(e)
+	}
+
+	return slackMessage(e)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as http date.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+func (s *service) fail(span trace.Span, traceID string, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
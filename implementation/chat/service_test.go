@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+func TestSendChat(t *testing.T) {
+	var (
+		got     map[string]interface{}
+		traceID string
+		status  = http.StatusOK
+		after   = ""
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &got))
+
+		traceID = r.Header.Get("X-B3-TraceId")
+
+		if after != "" {
+			w.Header().Set("Retry-After", after)
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	svc := NewChatService(zap.NewNop().Sugar(), tracer, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+	ch := NewChannel(svc, []string{" 127.0.0.1 "})
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	defer span.End()
+
+	slack := Entity{
+		Platform: Slack,
+		URL:      srv.URL,
+		Title:    "Deploy",
+		Text:     "notif v2 is live",
+		Color:    "#36a64f",
+		Fields:   []Field{{Name: "env", Value: "prod"}},
+		Link:     &Link{Text: "Open", URL: "https://example.com"},
+	}
+
+	require.NoError(t, ch.Validate(slack))
+	require.NoError(t, ch.Send(ctx, slack))
+	require.Equal(t, span.SpanContext().TraceID().String(), traceID)
+	require.Equal(t, "Deploy", got["text"])
+	require.Contains(t, got, "attachments")
+
+	teams := slack
+	teams.Platform = Teams
+
+	require.NoError(t, ch.Send(ctx, teams))
+	require.Equal(t, "MessageCard", got["@type"])
+	require.Equal(t, "#36a64f", got["themeColor"])
+
+	status, after = http.StatusTooManyRequests, "7"
+	err := ch.Send(ctx, slack)
+	d, ok := channel.RetryAfter(err)
+	require.True(t, ok)
+	require.Equal(t, 7*time.Second, d)
+	require.False(t, channel.IsPermanent(err))
+
+	status, after = http.StatusNotFound, ""
+	require.True(t, channel.IsPermanent(ch.Send(ctx, slack)))
+
+	other := slack
+	other.URL = "https://evil.example.com/hook"
+	require.Error(t, ch.Validate(other))
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, 3*time.Second, retryAfter("3"))
+	require.Zero(t, retryAfter(""))
+	require.Zero(t, retryAfter("soon"))
+
+	d := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	require.InDelta(t, time.Hour.Seconds(), d.Seconds(), 2)
+}
@@ -0,0 +1,54 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobChanged      = errors.New("job changed meanwhile, try again")
+	ErrUnknownTimezone = errors.New("timezone is not a known IANA time zone")
+	ErrNeverRuns       = errors.New("spec matches no time within 5 years")
+)
+
+// Job sends its notification to its channel at every time matching its
+// cron spec in its timezone.
+type Job struct {
+	ID string `json:"id"`
+	// Channel is email when empty, like on the original create route.
+	Channel string `json:"channel"`
+	Spec    string `json:"spec"`
+	// Timezone is the IANA time zone of the spec, UTC when empty.
+	Timezone string `json:"timezone,omitempty"`
+	// Notification is the body of a create request of Channel, like a
+	// templated email.
+	Notification json.RawMessage `json:"notification"`
+	Paused       bool            `json:"paused"`
+	// NextRun is the time the job runs next at, it is not run while
+	// paused.
+	NextRun   time.Time  `json:"nextRun"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// next returns the first time after t matching the spec of j.
+func (j Job) next(t time.Time) (time.Time, error) {
+	s, err := Parse(j.Spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	loc, err := time.LoadLocation(j.Timezone)
+	if err != nil {
+		return time.Time{}, ErrUnknownTimezone
+	}
+
+	next := s.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, ErrNeverRuns
+	}
+
+	return next.UTC(), nil
+}
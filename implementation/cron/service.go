@@ -0,0 +1,407 @@
+// Package cron runs the recurring notification jobs kept in the NOTIF_JOBS
+// bucket. The jobs are fired by the single instance holding the cron lease
+// of the NOTIF_LOCKS bucket, however many instances of notif run.
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"notif/implementation/message"
+	"notif/pkg"
+	"notif/pkg/config"
+	natshelper "notif/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// leaseKey is the key of the lease of the instance firing the jobs.
+const leaseKey = "cron"
+
+type Service interface {
+	// Create saves the job j and schedules its first run.
+	Create(ctx context.Context, j Job) (Job, error)
+	// List returns every job.
+	List(ctx context.Context) ([]Job, error)
+	// Get returns the job id.
+	Get(ctx context.Context, id string) (Job, error)
+	// Pause stops running the job id till resumed.
+	Pause(ctx context.Context, id string) (Job, error)
+	// Resume runs the job id again from its next time on, the runs missed
+	// while paused are skipped.
+	Resume(ctx context.Context, id string) (Job, error)
+	// Delete removes the job id.
+	Delete(ctx context.Context, id string) error
+	// Run fires the due jobs while holding the cron lease till ctx is done,
+	// and marks wg done once returned. It is added to wg before it is
+	// started.
+	Run(ctx context.Context, wg *sync.WaitGroup)
+}
+
+type service struct {
+	jobs   nats.KeyValue
+	lease  *natshelper.Lease
+	notifs message.Service
+	log    *zap.SugaredLogger
+	tracer trace.Tracer
+}
+
+// NewCronService returns a Service over the jobs of the jobs bucket,
+// sending their notifications through notifs, with the cron lease kept in
+// locks.
+func NewCronService(l *zap.SugaredLogger, jobs, locks nats.KeyValue, notifs message.Service, t trace.Tracer) Service {
+	return &service{
+		jobs:   jobs,
+		lease:  natshelper.NewLease(locks, leaseKey, nuid.Next(), config.CronLeaseTTL),
+		notifs: notifs,
+		log:    l,
+		tracer: t,
+	}
+}
+
+func (s *service) Create(ctx context.Context, j Job) (Job, error) {
+	_, span := s.tracer.Start(ctx, "cron.svc-create")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	next, err := j.next(now)
+	if err != nil {
+		return Job{}, s.fail(span, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		})
+	}
+
+	j.ID = nuid.Next()
+	j.NextRun, j.LastRun, j.CreatedAt = next, nil, now
+
+	span.SetAttributes(
+		attribute.String("cron.job_id", j.ID),
+		attribute.String("notif.channel", j.Channel),
+	)
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return Job{}, s.fail(span, err)
+	}
+
+	if _, err = s.jobs.Create(j.ID, data); err != nil {
+		return Job{}, s.fail(span, err)
+	}
+
+	return j, nil
+}
+
+func (s *service) List(ctx context.Context) ([]Job, error) {
+	_, span := s.tracer.Start(ctx, "cron.svc-list")
+	defer span.End()
+
+	keys, err := s.jobs.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return []Job{}, nil
+	}
+
+	if err != nil {
+		return nil, s.fail(span, err)
+	}
+
+	jobs := make([]Job, 0, len(keys))
+
+	for i := range keys {
+		j, _, err := s.get(keys[i])
+		if errors.Is(err, ErrJobNotFound) {
+			// deleted meanwhile
+			continue
+		}
+
+		if err != nil {
+			return nil, s.fail(span, err)
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	return jobs, nil
+}
+
+func (s *service) Get(ctx context.Context, id string) (Job, error) {
+	_, span := s.tracer.Start(ctx, "cron.svc-get")
+	defer span.End()
+
+	j, _, err := s.get(id)
+	if err != nil {
+		return Job{}, s.fail(span, notFound(err))
+	}
+
+	return j, nil
+}
+
+func (s *service) Pause(ctx context.Context, id string) (Job, error) {
+	_, span := s.tracer.Start(ctx, "cron.svc-pause")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("cron.job_id", id))
+
+	j, err := s.update(id, func(j *Job) error {
+		j.Paused = true
+		return nil
+	})
+	if err != nil {
+		return Job{}, s.fail(span, err)
+	}
+
+	return j, nil
+}
+
+func (s *service) Resume(ctx context.Context, id string) (Job, error) {
+	_, span := s.tracer.Start(ctx, "cron.svc-resume")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("cron.job_id", id))
+
+	j, err := s.update(id, func(j *Job) error {
+		if !j.Paused {
+			return nil
+		}
+
+		next, err := j.next(time.Now())
+		if err != nil {
+			return err
+		}
+
+		j.Paused, j.NextRun = false, next
+
+		return nil
+	})
+	if err != nil {
+		return Job{}, s.fail(span, err)
+	}
+
+	return j, nil
+}
+
+func (s *service) Delete(ctx context.Context, id string) error {
+	_, span := s.tracer.Start(ctx, "cron.svc-delete")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("cron.job_id", id))
+
+	if _, _, err := s.get(id); err != nil {
+		return s.fail(span, notFound(err))
+	}
+
+	if err := s.jobs.Delete(id); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+func (s *service) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(config.CronTick)
+	defer ticker.Stop()
+
+	leader := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			if leader {
+				if err := s.lease.Release(); err != nil {
+					s.log.Warnf("releasing cron lease failed: %v", err)
+				}
+			}
+
+			return
+
+		case now := <-ticker.C:
+			held, err := s.lease.Acquire(now)
+			if err != nil {
+				s.log.Errorf("acquiring cron lease failed: %v", err)
+			}
+
+			if held != leader {
+				s.log.Infof("cron lease held: %t", held)
+				leader = held
+			}
+
+			if held {
+				s.fire(ctx, now)
+			}
+		}
+	}
+}
+
+// fire sends the notification of every job due at now.
+func (s *service) fire(ctx context.Context, now time.Time) {
+	keys, err := s.jobs.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return
+	}
+
+	if err != nil {
+		s.log.Errorf("listing jobs failed: %v", err)
+		return
+	}
+
+	for i := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+
+		j, rev, err := s.get(keys[i])
+		if err != nil {
+			if !errors.Is(err, ErrJobNotFound) {
+				s.log.Errorf("getting job %s failed: %v", keys[i], err)
+			}
+
+			continue
+		}
+
+		if !j.Paused && !now.Before(j.NextRun) {
+			s.run(ctx, j, rev, now)
+		}
+	}
+}
+
+// run claims the due run of j by moving it to its next run, so it is sent
+// once even when the lease moved on meanwhile, and sends its notification.
+// The runs missed while no instance held the lease are sent only once.
+func (s *service) run(ctx context.Context, j Job, rev uint64, now time.Time) {
+	ctx, span := s.tracer.Start(ctx, "cron.svc-run")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("cron.job_id", j.ID),
+		attribute.String("notif.channel", j.Channel),
+	)
+
+	due, last := j.NextRun, j.LastRun
+
+	next, err := j.next(now)
+	if err != nil {
+		// the spec matches no time anymore, the job is kept for its
+		// history but paused
+		j.Paused = true
+		s.log.Warnf("pausing job %s: %v", j.ID, err)
+	}
+
+	j.NextRun, j.LastRun = next, &due
+
+	if rev, err = s.put(j, rev); err != nil {
+		// paused, deleted or run by another instance meanwhile
+		s.log.Warnf("claiming run of job %s failed: %v", j.ID, err)
+		return
+	}
+
+	receipt, err := s.notifs.SendRequest(ctx, message.Notification{
+		Channel: j.Channel,
+		Body:    j.Notification,
+	})
+	if err != nil {
+		_ = s.fail(span, err)
+
+		// the run is tried again on the next tick
+		j.NextRun, j.LastRun = due, last
+		if _, err = s.put(j, rev); err != nil {
+			s.log.Errorf("rolling back run of job %s failed: %v", j.ID, err)
+		}
+
+		return
+	}
+
+	span.SetAttributes(attribute.String("notif.id", receipt.ID))
+	s.log.Infow("job run", "jobID", j.ID, "notifID", receipt.ID, "nextRun", j.NextRun)
+}
+
+// update applies change to the job id, failing when it changed meanwhile.
+func (s *service) update(id string, change func(j *Job) error) (Job, error) {
+	j, rev, err := s.get(id)
+	if err != nil {
+		return Job{}, notFound(err)
+	}
+
+	if err = change(&j); err != nil {
+		return Job{}, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	if _, err = s.put(j, rev); err != nil {
+		if kve, gErr := s.jobs.Get(id); gErr == nil && kve.Revision() != rev {
+			return Job{}, pkg.NotifErr{
+				Code: http.StatusConflict,
+				Err:  ErrJobChanged,
+			}
+		}
+
+		return Job{}, err
+	}
+
+	return j, nil
+}
+
+// get returns the job id with its revision.
+func (s *service) get(id string) (Job, uint64, error) {
+	kve, err := s.jobs.Get(id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Job{}, 0, ErrJobNotFound
+	}
+
+	if err != nil {
+		return Job{}, 0, err
+	}
+
+	var j Job
+	if err = json.Unmarshal(kve.Value(), &j); err != nil {
+		return Job{}, 0, err
+	}
+
+	return j, kve.Revision(), nil
+}
+
+// put writes j over revision rev of the job.
+func (s *service) put(j Job, rev uint64) (uint64, error) {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.jobs.Update(j.ID, data, rev)
+}
+
+// notFound tells a missing job apart with its status.
+func notFound(err error) error {
+	if errors.Is(err, ErrJobNotFound) {
+		return pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		}
+	}
+
+	return err
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,221 @@
+package cron
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSpec = errors.New("spec must be 5 cron fields (minute hour day-of-month month day-of-week) or a @descriptor")
+
+// descriptors are the shorthands of common specs.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	months = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	days   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// field is the range of a spec field, names start at min.
+type field struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: months}
+	// 7 is sunday as well
+	dowField = field{min: 0, max: 7, names: days}
+)
+
+// Schedule is a parsed cron spec, every field is the set of its values.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// a restricted day of month and day of week match either one
+	domStar, dowStar bool
+}
+
+// Parse parses a standard 5 field cron spec. Fields take *, values,
+// ranges, lists and /steps, months and days of week their english
+// abbreviations.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ErrInvalidSpec
+	}
+
+	s := &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+
+	var err error
+
+	for _, f := range []struct {
+		set   *uint64
+		spec  string
+		field field
+	}{
+		{&s.minute, fields[0], minuteField},
+		{&s.hour, fields[1], hourField},
+		{&s.dom, fields[2], domField},
+		{&s.month, fields[3], monthField},
+		{&s.dow, fields[4], dowField},
+	} {
+		if *f.set, err = f.field.parse(f.spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+// parse returns the set of values of a comma separated list.
+func (f field) parse(spec string) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(spec, ",") {
+		expr, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, ErrInvalidSpec
+			}
+
+			expr = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+
+		switch {
+		case expr == "*" || expr == "?":
+		case strings.Contains(expr, "-"):
+			bounds := strings.SplitN(expr, "-", 2)
+
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+
+		default:
+			var err error
+			if lo, err = f.value(expr); err != nil {
+				return 0, err
+			}
+
+			// a value with a step runs till the end of the range
+			if !strings.Contains(part, "/") {
+				hi = lo
+			}
+		}
+
+		if lo > hi {
+			return 0, ErrInvalidSpec
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, ErrInvalidSpec
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after t matching s, in the location of t.
+// Times skipped by a daylight saving change are not matched. The zero
+// time is returned when nothing matches within 5 years, like for
+// february 30th.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = after(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = after(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = after(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// after returns next when it is after t. A wall clock time skipped by a
+// daylight saving change, like midnight in some zones, may be normalized
+// back to t or before it, the start of the hour after t is returned then.
+func after(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+
+	return t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
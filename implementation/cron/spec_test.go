@@ -0,0 +1,79 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every 5m",
+	} {
+		_, err := Parse(spec)
+		require.ErrorIs(t, err, ErrInvalidSpec, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	santiago, err := time.LoadLocation("America/Santiago")
+	require.NoError(t, err)
+
+	// a tuesday
+	from := time.Date(2022, 3, 1, 8, 30, 15, 0, time.UTC)
+
+	for _, tc := range []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2022, 3, 1, 8, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2022, 3, 1, 8, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", from, time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 8 * * *", from, time.Date(2022, 3, 2, 8, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2022, 3, 4, 10, 0, 0, 0, time.UTC), time.Date(2022, 3, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2022, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"30 6 1,15 * *", from, time.Date(2022, 3, 15, 6, 30, 0, 0, time.UTC)},
+		// a restricted day of month and day of week match either one
+		{"0 0 13 * fri", from, time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", from, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"10-20/5 3 * jan,jun *", from, time.Date(2022, 6, 1, 3, 10, 0, 0, time.UTC)},
+		// 9:00 in paris is 8:00 utc in winter and 7:00 in summer
+		{"0 9 * * *", from.In(paris), time.Date(2022, 3, 2, 8, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2022, 3, 27, 12, 0, 0, 0, paris), time.Date(2022, 3, 28, 7, 0, 0, 0, time.UTC)},
+		// 2:30 does not exist on the day clocks move forward
+		{"30 2 * * *", time.Date(2022, 3, 26, 12, 0, 0, 0, paris), time.Date(2022, 3, 28, 0, 30, 0, 0, time.UTC)},
+		// midnight does not exist on the day clocks move forward in santiago
+		{"0 12 * * *", time.Date(2022, 9, 10, 12, 30, 0, 0, santiago), time.Date(2022, 9, 11, 15, 0, 0, 0, time.UTC)},
+		{"0 12 12 * *", time.Date(2022, 9, 10, 12, 30, 0, 0, santiago), time.Date(2022, 9, 12, 15, 0, 0, 0, time.UTC)},
+		{"30 0 * * *", time.Date(2022, 9, 10, 12, 30, 0, 0, santiago), time.Date(2022, 9, 12, 3, 30, 0, 0, time.UTC)},
+	} {
+		s, err := Parse(tc.spec)
+		require.NoError(t, err, tc.spec)
+		require.True(t, tc.want.Equal(s.Next(tc.from)), "%s: got %v", tc.spec, s.Next(tc.from).UTC())
+	}
+
+	s, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, s.Next(from).IsZero())
+}
+
+func TestJobNext(t *testing.T) {
+	j := Job{Spec: "0 9 * * *", Timezone: "Asia/Kolkata"}
+
+	next, err := j.next(time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 3, 2, 3, 30, 0, 0, time.UTC), next)
+
+	_, err = Job{Spec: "0 9 * * *", Timezone: "Mars/Olympus"}.next(time.Now())
+	require.ErrorIs(t, err, ErrUnknownTimezone)
+
+	_, err = Job{Spec: "0 0 31 feb *"}.next(time.Now())
+	require.ErrorIs(t, err, ErrNeverRuns)
+}
@@ -0,0 +1,142 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Headers added to a dead-lettered msg next to its original ones.
+const (
+	SubjectHeader    = "Notif-Dlq-Subject"
+	StreamSeqHeader  = "Notif-Dlq-Stream-Seq"
+	ReasonHeader     = "Notif-Dlq-Reason"
+	ErrorHeader      = "Notif-Dlq-Error"
+	AttemptsHeader   = "Notif-Dlq-Attempts"
+	DeliveriesHeader = "Notif-Dlq-Deliveries"
+	FailedAtHeader   = "Notif-Dlq-Failed-At"
+
+	headerPrefix = "Notif-Dlq-"
+	// maxErrLen bounds every error kept in the headers.
+	maxErrLen = 512
+)
+
+// Reason tells why a notification was dead-lettered.
+type Reason string
+
+const (
+	// Permanent means the notification failed with an error no retry
+	// would fix.
+	Permanent Reason = "permanent"
+	// Exhausted means the notification was delivered MaxDeliver times
+	// without success.
+	Exhausted Reason = "exhausted"
+)
+
+// Failure describes the last delivery of a dead-lettered notification.
+type Failure struct {
+	Reason Reason
+	// Errors holds the error of every send attempt, in order.
+	Errors     []string
+	Deliveries uint64
+}
+
+// Entry is a dead-lettered notification.
+type Entry struct {
+	Seq          uint64              `json:"seq"`
+	Subject      string              `json:"subject"`
+	StreamSeq    uint64              `json:"streamSeq,omitempty"`
+	Reason       Reason              `json:"reason"`
+	Errors       []string            `json:"errors"`
+	Attempts     int                 `json:"attempts"`
+	Deliveries   uint64              `json:"deliveries"`
+	FailedAt     time.Time           `json:"failedAt"`
+	Headers      map[string][]string `json:"headers,omitempty"`
+	Notification json.RawMessage     `json:"notification,omitempty"`
+}
+
+// deadLetter builds the msg published to subj for the original msg,
+// keeping its headers so the trace and any metadata survive a replay. Its
+// Nats-Msg-Id is dropped, jetstream would drop a replay or a msg
+// dead-lettered again within the duplicate window.
+func deadLetter(subj string, msg *nats.Msg, streamSeq uint64, f Failure, now time.Time) *nats.Msg {
+	header := make(nats.Header, len(msg.Header)+7)
+	for k, v := range msg.Header {
+		if k != nats.MsgIdHdr {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+
+	header.Set(SubjectHeader, msg.Subject)
+	header.Set(ReasonHeader, string(f.Reason))
+	header.Set(AttemptsHeader, strconv.Itoa(len(f.Errors)))
+	header.Set(DeliveriesHeader, strconv.FormatUint(f.Deliveries, 10))
+	header.Set(FailedAtHeader, now.UTC().Format(time.RFC3339Nano))
+
+	if streamSeq > 0 {
+		header.Set(StreamSeqHeader, strconv.FormatUint(streamSeq, 10))
+	}
+
+	for i := range f.Errors {
+		header.Add(ErrorHeader, headerValue(f.Errors[i]))
+	}
+
+	return &nats.Msg{
+		Subject: subj,
+		Header:  header,
+		Data:    msg.Data,
+	}
+}
+
+// headerValue keeps an error on a single line, as nats headers require,
+// and bounds its length.
+func headerValue(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxErrLen {
+		s = s[:maxErrLen]
+	}
+
+	return s
+}
+
+// newEntry reads a dead-lettered msg back.
+func newEntry(m *nats.RawStreamMsg) Entry {
+	e := Entry{
+		Seq:          m.Sequence,
+		Subject:      m.Header.Get(SubjectHeader),
+		Reason:       Reason(m.Header.Get(ReasonHeader)),
+		Errors:       m.Header.Values(ErrorHeader),
+		Headers:      original(m.Header),
+		Notification: json.RawMessage(m.Data),
+	}
+
+	e.StreamSeq, _ = strconv.ParseUint(m.Header.Get(StreamSeqHeader), 10, 64)
+	e.Attempts, _ = strconv.Atoi(m.Header.Get(AttemptsHeader))
+	e.Deliveries, _ = strconv.ParseUint(m.Header.Get(DeliveriesHeader), 10, 64)
+
+	e.FailedAt, _ = time.Parse(time.RFC3339Nano, m.Header.Get(FailedAtHeader))
+	if e.FailedAt.IsZero() {
+		e.FailedAt = m.Time
+	}
+
+	if !json.Valid(m.Data) {
+		e.Notification, _ = json.Marshal(m.Data)
+	}
+
+	return e
+}
+
+// original returns the headers of the msg before it was dead-lettered.
+func original(h nats.Header) nats.Header {
+	header := make(nats.Header, len(h))
+	for k, v := range h {
+		if !strings.HasPrefix(k, headerPrefix) {
+			header[k] = v
+		}
+	}
+
+	return header
+}
@@ -0,0 +1,48 @@
+package deadletter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	msg := &nats.Msg{
+		Subject: "NOTIFS.email.send",
+		Header: nats.Header{
+			"X-B3-Traceid": []string{"463ac35c9f6413ad48485a3953bb6124"},
+			nats.MsgIdHdr:  []string{"order-42"},
+		},
+		Data: []byte(`{"subject":"hi"}`),
+	}
+
+	dl := deadLetter("NOTIFS_DLQ.email", msg, 42, Failure{
+		Reason:     Exhausted,
+		Errors:     []string{"All attempts fail:\n#1: 421 try later", "dial tcp: timeout"},
+		Deliveries: 5,
+	}, now)
+
+	require.Equal(t, "NOTIFS_DLQ.email", dl.Subject)
+	require.Equal(t, []string{"All attempts fail: #1: 421 try later", "dial tcp: timeout"},
+		dl.Header.Values(ErrorHeader), "errors are kept on a single line")
+
+	e := newEntry(&nats.RawStreamMsg{Subject: dl.Subject, Sequence: 7, Header: dl.Header, Data: dl.Data})
+	require.Equal(t, Entry{
+		Seq:          7,
+		Subject:      "NOTIFS.email.send",
+		StreamSeq:    42,
+		Reason:       Exhausted,
+		Errors:       dl.Header.Values(ErrorHeader),
+		Attempts:     2,
+		Deliveries:   5,
+		FailedAt:     now,
+		Headers:      map[string][]string{"X-B3-Traceid": {"463ac35c9f6413ad48485a3953bb6124"}},
+		Notification: []byte(`{"subject":"hi"}`),
+	}, e)
+
+	require.Empty(t, msg.Header.Get(SubjectHeader), "the original msg is left untouched")
+	require.Equal(t, "order-42", msg.Header.Get(nats.MsgIdHdr))
+}
@@ -0,0 +1,220 @@
+// Package deadletter keeps the notifications which could not be delivered
+// in the NOTIFS_DLQ stream, to inspect and replay them.
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var ErrNotDeadLettered = errors.New("msg is not a dead-lettered notification")
+
+type Service interface {
+	// Publish dead-letters msg with the failure of its last delivery.
+	Publish(ctx context.Context, msg *nats.Msg, f Failure) error
+	// List returns up to limit entries from sequence from on, without
+	// their notification.
+	List(ctx context.Context, from uint64, limit int) ([]Entry, error)
+	// Get returns the entry of sequence seq.
+	Get(ctx context.Context, seq uint64) (Entry, error)
+	// Replay publishes the notification again on its original subject
+	// and removes it from the dead letters.
+	Replay(ctx context.Context, seq uint64) (*nats.PubAck, error)
+	// Delete removes the entry of sequence seq.
+	Delete(ctx context.Context, seq uint64) error
+	// Purge removes every entry.
+	Purge(ctx context.Context) error
+}
+
+type service struct {
+	js     nats.JetStreamContext
+	log    *zap.SugaredLogger
+	tracer trace.Tracer
+}
+
+// NewDeadLetterService returns a Service over the NOTIFS_DLQ stream.
+func NewDeadLetterService(l *zap.SugaredLogger, js nats.JetStreamContext, t trace.Tracer) Service {
+	return &service{
+		js:     js,
+		log:    l,
+		tracer: t,
+	}
+}
+
+func (s *service) Publish(ctx context.Context, msg *nats.Msg, f Failure) error {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-publish")
+	defer span.End()
+
+	// the subject keeps the channel so dead letters can be told apart
+	name, err := channel.NameFromSubject(msg.Subject)
+	if err != nil {
+		name = "unknown"
+	}
+
+	var streamSeq uint64
+	if meta, mErr := msg.Metadata(); mErr == nil {
+		streamSeq = meta.Sequence.Stream
+	}
+
+	span.SetAttributes(
+		attribute.String("notif.channel", name),
+		attribute.String("deadletter.reason", string(f.Reason)),
+	)
+
+	dl := deadLetter(config.DeadLetterStreamName+"."+name, msg, streamSeq, f, time.Now())
+	if _, err = s.js.PublishMsg(dl); err != nil {
+		return s.fail(span, err)
+	}
+
+	s.log.Warnw("notification dead-lettered", "subject", msg.Subject,
+		"reason", f.Reason, "deliveries", f.Deliveries, "traceID", span.SpanContext().TraceID().String())
+
+	return nil
+}
+
+func (s *service) List(ctx context.Context, from uint64, limit int) ([]Entry, error) {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-list")
+	defer span.End()
+
+	info, err := s.js.StreamInfo(config.DeadLetterStreamName)
+	if err != nil {
+		return nil, s.fail(span, err)
+	}
+
+	// an empty stream has its first sequence at 0, which GetMsg refuses
+	if from < info.State.FirstSeq {
+		from = info.State.FirstSeq
+	}
+
+	if from == 0 {
+		from = 1
+	}
+
+	entries := make([]Entry, 0)
+	if info.State.LastSeq == 0 || from > info.State.LastSeq {
+		return entries, nil
+	}
+
+	// deleted msgs leave gaps in the sequences which are skipped
+	for seq := from; seq <= info.State.LastSeq && len(entries) < limit; seq++ {
+		m, err := s.js.GetMsg(config.DeadLetterStreamName, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, s.fail(span, err)
+		}
+
+		e := newEntry(m)
+		e.Notification = nil
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (s *service) Get(ctx context.Context, seq uint64) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-get")
+	defer span.End()
+
+	m, err := s.get(seq)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	return newEntry(m), nil
+}
+
+func (s *service) Replay(ctx context.Context, seq uint64) (*nats.PubAck, error) {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-replay")
+	defer span.End()
+
+	m, err := s.get(seq)
+	if err != nil {
+		return nil, s.fail(span, err)
+	}
+
+	subj := m.Header.Get(SubjectHeader)
+	if subj == "" {
+		return nil, s.fail(span, ErrNotDeadLettered)
+	}
+
+	span.SetAttributes(attribute.String("deadletter.subject", subj))
+
+	pubAck, err := s.js.PublishMsg(&nats.Msg{
+		Subject: subj,
+		Header:  original(m.Header),
+		Data:    m.Data,
+	})
+	if err != nil {
+		return nil, s.fail(span, err)
+	}
+
+	// the notification is back in the work queue, a failure to remove it
+	// here only leaves a stale dead letter behind
+	if err = s.js.DeleteMsg(config.DeadLetterStreamName, seq); err != nil {
+		s.log.Warnf("deleting replayed dead letter %d failed: %v", seq, err)
+	}
+
+	return pubAck, nil
+}
+
+func (s *service) Delete(ctx context.Context, seq uint64) error {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-delete")
+	defer span.End()
+
+	if _, err := s.get(seq); err != nil {
+		return s.fail(span, err)
+	}
+
+	if err := s.js.DeleteMsg(config.DeadLetterStreamName, seq); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+func (s *service) Purge(ctx context.Context) error {
+	_, span := s.tracer.Start(ctx, "deadletter.svc-purge")
+	defer span.End()
+
+	if err := s.js.PurgeStream(config.DeadLetterStreamName); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+// get fetches the msg of seq, failing with a not found for a missing one.
+func (s *service) get(seq uint64) (*nats.RawStreamMsg, error) {
+	m, err := s.js.GetMsg(config.DeadLetterStreamName, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return nil, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		}
+	}
+
+	return m, err
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
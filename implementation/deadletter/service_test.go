@@ -0,0 +1,47 @@
+package deadletter
+
+import (
+	"context"
+	"testing"
+
+	natshelper "notif/pkg/nats"
+	"notif/pkg/nats/natstest"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestList(t *testing.T) {
+	_, js := natstest.RunJetStream(t)
+	log := zap.NewNop().Sugar()
+	require.NoError(t, natshelper.CreateDeadLetterStream(js, log))
+
+	ctx := context.Background()
+	svc := NewDeadLetterService(log, js, trace.NewNoopTracerProvider().Tracer(""))
+
+	entries, err := svc.List(ctx, 0, 10)
+	require.NoError(t, err, "an empty stream lists nothing")
+	require.Empty(t, entries)
+
+	for i := 0; i < 3; i++ {
+		msg := &nats.Msg{Subject: "NOTIFS.email.send", Header: nats.Header{}, Data: []byte(`{}`)}
+		require.NoError(t, svc.Publish(ctx, msg, Failure{Reason: Exhausted, Deliveries: 5}))
+	}
+
+	entries, err = svc.List(ctx, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, uint64(1), entries[0].Seq)
+
+	entries, err = svc.List(ctx, 4, 10)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, svc.Purge(ctx))
+
+	entries, err = svc.List(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,122 @@
+package email
+
+import (
+	"context"
+	"strings"
+
+	"notif/implementation/channel"
+	"notif/pkg/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type apiService struct {
+	log          *zap.SugaredLogger
+	cfg          *config.NotifConfig
+	provider     APIProvider
+	dkim         dkimSigners
+	domains      map[string]bool
+	suppressions Suppressions
+	tracer       trace.Tracer
+}
+
+// NewAPIService returns a Service sending through the http api of
+// provider instead of smtp, and skipping the addresses of suppressions
+// when it is not nil.
+func NewAPIService(logger *zap.SugaredLogger, config *config.NotifConfig, provider APIProvider,
+	suppressions Suppressions, t trace.Tracer) (Service, error) {
+	dkim, err := newDKIMSigners(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiService{
+		log:          logger,
+		cfg:          config,
+		provider:     provider,
+		dkim:         dkim,
+		domains:      senderDomains(config, dkim, nil),
+		suppressions: suppressions,
+		tracer:       t,
+	}, nil
+}
+
+func (s *apiService) SendsFrom(addr string) bool {
+	return s.domains[strings.ToLower(domainOf(addr))]
+}
+
+func (s *apiService) SendEmail(ctx context.Context, e Entity) error {
+	ctx, span := s.tracer.Start(ctx, "sendEmail-func")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+
+	from := sender(s.cfg, e)
+
+	msg, err := newMessage(from, e)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	msg.notifID = channel.ID(ctx)
+
+	span.SetAttributes(
+		attribute.String("email.provider", s.provider.Name()),
+		attribute.String("email.message_id", msg.msgID),
+	)
+
+	m, err := newMail(msg)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	// the suppressed recipients are left out of the mail
+	rcpts, suppressed, err := suppress(ctx, s.suppressions, m.Recipients())
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	if len(rcpts) == 0 {
+		return s.fail(span, traceID, &channel.DeliveryError{Results: suppressed})
+	}
+
+	if len(suppressed) > 0 {
+		m.To, m.Cc, m.Bcc = without(m.To, rcpts), without(m.Cc, rcpts), without(m.Bcc, rcpts)
+	}
+
+	// only the providers sending the raw message keep the signature
+	if m.Raw, err = s.dkim.sign(m.Raw, from, msg.date); err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	id, err := s.provider.Send(ctx, m)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	span.SetAttributes(attribute.String("email.provider_message_id", id))
+	s.log.Debugw("email sent", "provider", s.provider.Name(), "messageID", msg.msgID,
+		"providerMessageID", id, "traceID", traceID)
+
+	if len(suppressed) > 0 {
+		results := newResults(rcpts)
+		for i := range results {
+			results[i].Status = channel.Delivered
+		}
+
+		return s.fail(span, traceID, &channel.DeliveryError{Results: append(results, suppressed...)})
+	}
+
+	return nil
+}
+
+func (s *apiService) fail(span trace.Span, traceID string, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
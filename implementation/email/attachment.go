@@ -0,0 +1,106 @@
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+	"mime"
+	"strings"
+
+	"notif/pkg/config"
+)
+
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the maximum size")
+var ErrAttachmentsTooLarge = errors.New("attachments exceed the maximum total size")
+var ErrInvalidContentType = errors.New("attachment content type is invalid")
+var ErrInvalidContentID = errors.New("attachment content id must not hold white space, '<' or '>'")
+
+// Attachment is a file sent along with the email. When ContentID is set
+// the attachment is sent inline, so the html body can show it with
+// <img src="cid:ContentID">.
+type Attachment struct {
+	Filename    string `json:"filename" validate:"required"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     string `json:"content" validate:"required,base64"`
+	ContentID   string `json:"contentId,omitempty"`
+}
+
+func (a *Attachment) decode() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(a.Content)
+}
+
+// size is the decoded length of the content without decoding it.
+func (a *Attachment) size() int {
+	return base64.StdEncoding.DecodedLen(len(a.Content)) -
+		(len(a.Content) - len(strings.TrimRight(a.Content, "=")))
+}
+
+// contentType falls back to a generic binary type when none is given.
+func (a *Attachment) contentType() string {
+	if a.ContentType == "" {
+		return "application/octet-stream"
+	}
+
+	return a.ContentType
+}
+
+// attachmentLimits returns the maximum decoded size of an attachment and
+// of all of them, the configured limits bounded by what fits base64
+// encoded in a nats msg.
+func attachmentLimits() (each, total int) {
+	each, total = config.MaxAttachmentSize, config.MaxAttachmentsSize
+
+	fits := int(config.NatsMaxPayload) / 4 * 3
+	if fits < each {
+		each = fits
+	}
+
+	if fits < total {
+		total = fits
+	}
+
+	return each, total
+}
+
+// AttachmentValidation checks the content type, the content id and the
+// decoded size of every attachment against the limits.
+func (e *Entity) AttachmentValidation() error {
+	maxEach, maxTotal := attachmentLimits()
+	total := 0
+
+	for i := range e.Attachments {
+		if _, _, err := mime.ParseMediaType(e.Attachments[i].contentType()); err != nil {
+			return ErrInvalidContentType
+		}
+
+		// the content id is written as is in its header
+		if strings.ContainsAny(e.Attachments[i].ContentID, "<> \t\r\n\v\f") {
+			return ErrInvalidContentID
+		}
+
+		size := e.Attachments[i].size()
+		if size > maxEach {
+			return ErrAttachmentTooLarge
+		}
+
+		total += size
+	}
+
+	if total > maxTotal {
+		return ErrAttachmentsTooLarge
+	}
+
+	return nil
+}
+
+// splitAttachments separates the inline attachments from the regular ones.
+func (e *Entity) splitAttachments() (inline, attached []Attachment) {
+	for i := range e.Attachments {
+		if e.Attachments[i].ContentID != "" {
+			inline = append(inline, e.Attachments[i])
+		} else {
+			attached = append(attached, e.Attachments[i])
+		}
+	}
+
+	return inline, attached
+}
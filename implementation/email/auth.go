@@ -0,0 +1,287 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"notif/pkg/config"
+)
+
+const (
+	// AuthPlain, AuthLogin and AuthCRAMMD5 authenticate with the username
+	// and password of the relay.
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	// AuthXOAUTH2 authenticates with an oauth2 access token of the
+	// TokenSource of the relay.
+	AuthXOAUTH2 = "xoauth2"
+	// AuthNone never authenticates.
+	AuthNone = "none"
+
+	// tokenLeeway renews an access token a bit before it expires.
+	tokenLeeway = time.Minute
+	// maxTokenResponse bounds how much of a token response is read.
+	maxTokenResponse = 64 << 10
+)
+
+var (
+	ErrUnknownAuth     = errors.New("unknown smtp auth mechanism")
+	ErrUnencryptedAuth = errors.New("smtp auth refused over an unencrypted connection")
+	ErrUnexpectedAuth  = errors.New("unexpected smtp auth challenge")
+	ErrNoTokenSource   = errors.New("xoauth2 requires a token source")
+	ErrNoAccessToken   = errors.New("oauth2 token endpoint returned no access token")
+)
+
+// TokenSource returns a valid oauth2 access token, refreshing it when it
+// expired.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticTokenSource always returns the same token.
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+type refreshTokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	refreshToken string
+	client       *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewRefreshTokenSource returns a TokenSource exchanging refreshToken for
+// access tokens at the oauth2 tokenURL, and caching them till they expire.
+func NewRefreshTokenSource(tokenURL, clientID, clientSecret, refreshToken string, client *http.Client) TokenSource {
+	return &refreshTokenSource{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		refreshToken: refreshToken,
+		client:       client,
+	}
+}
+
+func (r *refreshTokenSource) Token(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token != "" && time.Now().Before(r.expiresAt) {
+		return r.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", r.refreshToken)
+	form.Set("client_id", r.clientID)
+	form.Set("client_secret", r.clientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponse))
+	if err != nil {
+		return "", err
+	}
+
+	if err = json.Unmarshal(data, &body); err != nil {
+		return "", err
+	}
+
+	if body.Error != "" {
+		return "", errors.New("oauth2 token refresh failed: " + body.Error + " " + body.Description)
+	}
+
+	if body.AccessToken == "" {
+		return "", ErrNoAccessToken
+	}
+
+	r.token = body.AccessToken
+	r.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - tokenLeeway)
+
+	return r.token, nil
+}
+
+// tokenSourceFromConfig returns the refresh token source of the
+// EMAIL_SMTP_OAUTH_* config, or the password as a static token when no
+// token url is set.
+func tokenSourceFromConfig(cfg *config.NotifConfig) TokenSource {
+	if cfg.EmailSmtpOAuthTokenURL == "" {
+		return StaticTokenSource(cfg.EmailSmtpPassword)
+	}
+
+	return NewRefreshTokenSource(cfg.EmailSmtpOAuthTokenURL, cfg.EmailSmtpOAuthClientID,
+		cfg.EmailSmtpOAuthClientSecret, cfg.EmailSmtpOAuthRefreshToken,
+		&http.Client{Timeout: config.SmtpDialTimeOut})
+}
+
+// auth returns the smtp.Auth of the relay mechanism, or of the first one
+// the server advertises in mechs when none is set. It is nil when the
+// relay does not authenticate.
+func (r Relay) auth(ctx context.Context, mechs string) (smtp.Auth, error) {
+	mech := r.Auth
+	if mech == "" {
+		mech = preferredAuth(mechs)
+	}
+
+	switch mech {
+	case AuthPlain:
+		return smtp.PlainAuth("", r.Username, r.Password, r.Host), nil
+
+	case AuthLogin:
+		return &loginAuth{username: r.Username, password: r.Password, host: r.Host}, nil
+
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(r.Username, r.Password), nil
+
+	case AuthXOAUTH2:
+		if r.TokenSource == nil {
+			return nil, ErrNoTokenSource
+		}
+
+		token, err := r.TokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &xoauth2Auth{username: r.Username, token: token, host: r.Host}, nil
+
+	case AuthNone:
+		return nil, nil
+
+	default:
+		return nil, ErrUnknownAuth
+	}
+}
+
+func (r Relay) validAuth() error {
+	switch r.Auth {
+	case "", AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone:
+		return nil
+
+	case AuthXOAUTH2:
+		if r.TokenSource == nil {
+			return ErrNoTokenSource
+		}
+
+		return nil
+
+	default:
+		return ErrUnknownAuth
+	}
+}
+
+// preferredAuth picks PLAIN when advertised, as notif always did, then
+// the other mechanisms which only need a password.
+func preferredAuth(mechs string) string {
+	advertised := make(map[string]bool)
+	for _, m := range strings.Fields(strings.ToUpper(mechs)) {
+		advertised[m] = true
+	}
+
+	for _, mech := range []string{AuthPlain, AuthLogin, AuthCRAMMD5} {
+		if advertised[strings.ToUpper(mech)] {
+			return mech
+		}
+	}
+
+	return AuthPlain
+}
+
+// encrypted tells whether credentials may be sent in clear to the server,
+// with the same rule as smtp.PlainAuth.
+func encrypted(server *smtp.ServerInfo, host string) bool {
+	return server.TLS || host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// loginAuth implements the LOGIN mechanism, which answers the username
+// and password prompts of the server.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !encrypted(server, a.host) {
+		return "", nil, ErrUnencryptedAuth
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.TrimSuffix(strings.ToLower(string(fromServer)), ":") {
+	case "username", "user name":
+		return []byte(a.username), nil
+
+	case "password":
+		return []byte(a.password), nil
+
+	default:
+		return nil, ErrUnexpectedAuth
+	}
+}
+
+// xoauth2Auth implements the XOAUTH2 mechanism of gmail and office 365.
+type xoauth2Auth struct {
+	username string
+	token    string
+	host     string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !encrypted(server, a.host) {
+		return "", nil, ErrUnencryptedAuth
+	}
+
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next answers the error challenge of a refused token with an empty
+// response, after which the server sends the actual error.
+func (a *xoauth2Auth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
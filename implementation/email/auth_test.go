@@ -0,0 +1,97 @@
+package email
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMechanisms(t *testing.T) {
+	tests := []struct {
+		name   string
+		mechs  string
+		relay  Relay
+		authed string
+	}{
+		{
+			name:   "plain is preferred",
+			mechs:  "LOGIN PLAIN CRAM-MD5",
+			authed: "PLAIN \x00user\x00secret",
+		},
+		{
+			name:   "login when only advertised",
+			mechs:  "LOGIN",
+			authed: "LOGIN user:secret",
+		},
+		{
+			name:   "configured cram-md5",
+			mechs:  "PLAIN CRAM-MD5",
+			relay:  Relay{Auth: AuthCRAMMD5},
+			authed: "CRAM-MD5 user 3fd7ee352b5d949a348cc5841e16e810",
+		},
+		{
+			name:   "xoauth2",
+			mechs:  "XOAUTH2",
+			relay:  Relay{Auth: AuthXOAUTH2, TokenSource: StaticTokenSource("token")},
+			authed: "XOAUTH2 user=user\x01auth=Bearer token\x01\x01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTP(t)
+			srv.authMechs = tt.mechs
+
+			tt.relay.Username, tt.relay.Password = "user", "secret"
+			require.NoError(t, sendOne(t, newTestPool(t, srv, tt.relay)))
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+
+			require.Equal(t, []string{tt.authed}, srv.authed)
+		})
+	}
+}
+
+func TestXOAUTH2Refused(t *testing.T) {
+	srv := newFakeSMTP(t)
+	srv.authMechs = "XOAUTH2"
+
+	p := newTestPool(t, srv, Relay{Username: "user", Auth: AuthXOAUTH2, TokenSource: StaticTokenSource("expired")})
+	require.Error(t, sendOne(t, p))
+	require.Empty(t, srv.accepted())
+
+	_, err := newPool(Relay{Auth: AuthXOAUTH2})
+	require.ErrorIs(t, err, ErrNoTokenSource)
+
+	_, err = newPool(Relay{Auth: "digest-md5"})
+	require.ErrorIs(t, err, ErrUnknownAuth)
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	refreshes := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+
+		require.Equal(t, "refresh_token", r.FormValue("grant_type"))
+		require.Equal(t, "rt", r.FormValue("refresh_token"))
+		require.Equal(t, "client", r.FormValue("client_id"))
+
+		_, _ = w.Write([]byte(`{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+
+	ts := NewRefreshTokenSource(srv.URL, "client", "secret", "rt", srv.Client())
+
+	for i := 0; i < 2; i++ {
+		token, err := ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+	}
+
+	require.Equal(t, 1, refreshes, "the access token is cached till it expires")
+}
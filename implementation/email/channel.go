@@ -0,0 +1,173 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notif/implementation/channel"
+	"notif/implementation/template"
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ChannelName is the channel token of email notifications.
+const ChannelName = "email"
+
+var ErrNotAnEntity = errors.New("notification is not an email entity")
+
+type emailChannel struct {
+	svc         Service
+	templateSvc template.Service
+	validate    *validator.Validate
+}
+
+// NewChannel returns the email notification channel sending through svc
+// and rendering the templated entities with templateSvc.
+func NewChannel(svc Service, templateSvc template.Service) channel.Channel {
+	return &emailChannel{
+		svc:         svc,
+		templateSvc: templateSvc,
+		validate:    validator.New(),
+	}
+}
+
+func (c *emailChannel) Name() string {
+	return ChannelName
+}
+
+func (c *emailChannel) Decode(data []byte) (interface{}, error) {
+	var e Entity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return e, nil
+}
+
+// Recipients returns the envelope recipients of the entity.
+func (c *emailChannel) Recipients(n interface{}) []string {
+	e, ok := n.(Entity)
+	if !ok {
+		return nil
+	}
+
+	return e.Recipients()
+}
+
+func (c *emailChannel) Validate(n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return ErrNotAnEntity
+	}
+
+	if err := c.validate.Struct(e); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	// mail from any domain would be relayed and dkim signed as ours
+	if e.FromAddr != "" && !c.svc.SendsFrom(e.FromAddr) {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  ErrSenderDomain,
+		}
+	}
+
+	if err := e.ToListValidation(); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	if err := e.AttachmentValidation(); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, ErrAttachmentTooLarge) || errors.Is(err, ErrAttachmentsTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+
+		return pkg.NotifErr{
+			Code: code,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
+
+// Render returns the entity as is when it has no template, otherwise one
+// entity per recipient with the subject and body rendered for them.
+func (c *emailChannel) Render(ctx context.Context, n interface{}) ([]interface{}, error) {
+	e, ok := n.(Entity)
+	if !ok {
+		return nil, ErrNotAnEntity
+	}
+
+	if e.TemplateID == "" {
+		return []interface{}{e}, nil
+	}
+
+	entities := make([]interface{}, len(e.ToList))
+
+	for i := range e.ToList {
+		r, err := c.templateSvc.Render(ctx, e.TemplateID, e.TemplateVersion, template.Data{
+			UserName:  e.ToList[i].UserName,
+			EmailAddr: e.ToList[i].EmailAddr,
+			Data:      e.RecipientData(e.ToList[i]),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		rendered := e
+		rendered.ToList = []NameAddr{e.ToList[i]}
+		rendered.Subject = r.Subject
+		rendered.Body = r.HTML
+		rendered.TextBody = r.Text
+		entities[i] = rendered
+	}
+
+	return entities, nil
+}
+
+// Send delivers the entity. Only the deferred recipients are left to retry
+// so the ones already delivered do not get the email twice.
+func (c *emailChannel) Send(ctx context.Context, n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return channel.Permanent(ErrNotAnEntity)
+	}
+
+	err := c.svc.SendEmail(ctx, e)
+
+	var pErr *ProviderError
+	if errors.As(err, &pErr) {
+		switch {
+		case !pErr.Retryable:
+			return channel.Permanent(err)
+		case pErr.RetryAfter > 0:
+			return &channel.RetryAfterError{Err: err, After: pErr.RetryAfter}
+		default:
+			return err
+		}
+	}
+
+	var dErr *channel.DeliveryError
+	if errors.As(err, &dErr) {
+		if len(dErr.Deferred()) == 0 {
+			return channel.Permanent(err)
+		}
+
+		return &channel.PartialError{Err: err, Next: e.withEnvelope(dErr.Deferred())}
+	}
+
+	return err
+}
@@ -0,0 +1,24 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+
+	"notif/implementation/channel"
+)
+
+// ErrNoRecipientAccepted is returned when every recipient was refused.
+var ErrNoRecipientAccepted = errors.New("no recipient was accepted by the smtp server")
+
+// classify maps a smtp reply error to the recipient delivery status, a
+// permanent 5xx reply to RCPT TO rejects the recipient while a transient
+// 4xx reply, or a send failing before the message was accepted, defers
+// it.
+func classify(err error) channel.DeliveryStatus {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return channel.Rejected
+	}
+
+	return channel.Deferred
+}
@@ -0,0 +1,341 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"notif/pkg/config"
+)
+
+const (
+	dkimRSA     = "rsa-sha256"
+	dkimEd25519 = "ed25519-sha256"
+
+	// dkimLineLen is the length the signature is folded at.
+	dkimLineLen = 72
+)
+
+var (
+	ErrInvalidDKIMKey  = errors.New("dkim key is neither a pem rsa or ed25519 key nor a base64 ed25519 seed")
+	ErrInvalidDKIMKeys = errors.New("invalid EMAIL_DKIM_KEYS")
+)
+
+// dkimHeaders are the headers signed by default. From is signed twice so
+// no From header can be added to the message without breaking the
+// signature.
+var dkimHeaders = []string{
+	"from", "to", "cc", "subject", "date", "message-id",
+	"mime-version", "content-type", "from",
+}
+
+// DKIMKey is the key of a sender domain in EMAIL_DKIM_KEYS.
+type DKIMKey struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	// Key is a pem rsa or ed25519 private key or the base64 seed of an
+	// ed25519 key, read from KeyFile when it is empty.
+	Key     string   `json:"key"`
+	KeyFile string   `json:"keyFile"`
+	Headers []string `json:"headers"`
+}
+
+type dkimSigner struct {
+	domain   string
+	selector string
+	algo     string
+	key      crypto.Signer
+	headers  []string
+}
+
+// dkimSigners signs the messages of every sender domain with a key.
+type dkimSigners map[string]*dkimSigner
+
+// newDKIMSigners returns the signers of EMAIL_DKIM_KEYS.
+func newDKIMSigners(cfg *config.NotifConfig) (dkimSigners, error) {
+	signers := make(dkimSigners)
+	if cfg.EmailDkimKeys == "" {
+		return signers, nil
+	}
+
+	var keys []DKIMKey
+	if err := json.Unmarshal([]byte(cfg.EmailDkimKeys), &keys); err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		domain := strings.ToLower(k.Domain)
+		if domain == "" || k.Selector == "" || signers[domain] != nil {
+			return nil, ErrInvalidDKIMKeys
+		}
+
+		s, err := newDKIMSigner(k)
+		if err != nil {
+			return nil, err
+		}
+
+		signers[domain] = s
+	}
+
+	return signers, nil
+}
+
+func newDKIMSigner(k DKIMKey) (*dkimSigner, error) {
+	data := []byte(k.Key)
+	if k.Key == "" {
+		var err error
+		if data, err = ioutil.ReadFile(k.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := parseDKIMKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &dkimSigner{
+		domain:   strings.ToLower(k.Domain),
+		selector: k.Selector,
+		algo:     dkimRSA,
+		key:      key,
+		headers:  dkimHeaders,
+	}
+
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		s.algo = dkimEd25519
+	}
+
+	if len(k.Headers) > 0 {
+		s.headers = make([]string, len(k.Headers))
+		for i := range k.Headers {
+			s.headers[i] = strings.ToLower(k.Headers[i])
+		}
+	}
+
+	return s, nil
+}
+
+func parseDKIMKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, ErrInvalidDKIMKey
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, ErrInvalidDKIMKey
+	}
+}
+
+// sign prepends a DKIM-Signature to msg when there is a key for the
+// domain of from, msg is returned as is otherwise.
+func (d dkimSigners) sign(msg []byte, from string, now time.Time) ([]byte, error) {
+	s := d[strings.ToLower(domainOf(from))]
+	if s == nil {
+		return msg, nil
+	}
+
+	fields, body := splitMessage(msg)
+
+	bh := sha256.Sum256(relaxedBody(body))
+	value := "v=1; a=" + s.algo + "; c=relaxed/relaxed;" + crlf +
+		"\td=" + s.domain + "; s=" + s.selector + "; t=" + strconv.FormatInt(now.Unix(), 10) + ";" + crlf +
+		"\th=" + strings.Join(s.headers, ":") + ";" + crlf +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bh[:]) + ";" + crlf +
+		"\tb="
+
+	sig, err := s.signature(fields, s.headers, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("DKIM-Signature: " + value)
+
+	for i := 0; i < len(sig); i += dkimLineLen {
+		if i > 0 {
+			buf.WriteString(crlf + "\t")
+		}
+
+		end := i + dkimLineLen
+		if end > len(sig) {
+			end = len(sig)
+		}
+
+		buf.WriteString(sig[i:end])
+	}
+
+	buf.WriteString(crlf)
+	buf.Write(msg)
+
+	return buf.Bytes(), nil
+}
+
+// signature returns the base64 signature of the headers named by names
+// and of the DKIM-Signature header of value, which ends with an empty b=.
+func (s *dkimSigner) signature(fields []headerField, names []string, value string) (string, error) {
+	h := sha256.New()
+
+	for _, f := range selectHeaders(fields, names) {
+		h.Write([]byte(relaxedHeader(f.name, f.value) + crlf))
+	}
+
+	h.Write([]byte(relaxedHeader("DKIM-Signature", value)))
+
+	// ed25519 signs the hash itself, rsa its digest info
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.algo == dkimEd25519 {
+		opts = crypto.Hash(0)
+	}
+
+	sig, err := s.key.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+type headerField struct {
+	name  string
+	value string
+}
+
+// splitMessage returns the header fields and the body of msg, the value
+// of a field keeps its folding.
+func splitMessage(msg []byte) ([]headerField, []byte) {
+	header, body := msg, []byte(nil)
+	if i := bytes.Index(msg, []byte(crlf+crlf)); i >= 0 {
+		header, body = msg[:i+len(crlf)], msg[i+2*len(crlf):]
+	}
+
+	var fields []headerField
+
+	for _, line := range strings.SplitAfter(string(header), crlf) {
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+
+		if i := strings.Index(line, ":"); i > 0 {
+			fields = append(fields, headerField{name: line[:i], value: line[i+1:]})
+		}
+	}
+
+	return fields, body
+}
+
+// selectHeaders picks the fields named by names. A name given several
+// times picks the instances of the field from the last one up, and a
+// missing instance is left out as rfc 6376 asks.
+func selectHeaders(fields []headerField, names []string) []headerField {
+	used := make(map[int]bool)
+	selected := make([]headerField, 0, len(names))
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(strings.TrimSpace(fields[i].name), name) {
+				used[i] = true
+				selected = append(selected, fields[i])
+
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+// relaxedHeader canonicalizes a field with the relaxed algorithm: the
+// name is lower cased, the value unfolded and its whitespace runs reduced
+// to a single space. The trailing CRLF is not included.
+func relaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "", "\r", "", "\n", "").Replace(value)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(reduceWSP(value))
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm: whitespace
+// runs are reduced to a single space, removed at the end of lines, and the
+// empty lines at the end of the body are removed.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), crlf)
+
+	for i := range lines {
+		lines[i] = strings.TrimRight(reduceWSP(lines[i]), " ")
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, crlf) + crlf)
+}
+
+func reduceWSP(s string) string {
+	var b strings.Builder
+
+	wsp := false
+
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			wsp = true
+			continue
+		}
+
+		if wsp {
+			b.WriteByte(' ')
+			wsp = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	if wsp {
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package email
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"notif/pkg/config"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// rfc8463Message is the example message of rfc 8463 appendix A.
+const rfc8463Message = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// the example of rfc 6376 section 3.4.5
+	fields, body := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+
+	require.Len(t, fields, 2)
+	require.Equal(t, "a:X", relaxedHeader(fields[0].name, fields[0].value))
+	require.Equal(t, "b:Y Z", relaxedHeader(fields[1].name, fields[1].value))
+	require.Equal(t, " C\r\nD E\r\n", string(relaxedBody(body)))
+	require.Empty(t, relaxedBody([]byte("\r\n\r\n")))
+}
+
+// TestDKIMEd25519 checks the ed25519 signature of rfc 8463 appendix A.
+func TestDKIMEd25519(t *testing.T) {
+	key, err := parseDKIMKey([]byte("nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="))
+	require.NoError(t, err)
+
+	fields, body := splitMessage([]byte(rfc8463Message))
+
+	bh := sha256.Sum256(relaxedBody(body))
+	require.Equal(t, "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=", base64.StdEncoding.EncodeToString(bh[:]))
+
+	s := &dkimSigner{algo: dkimEd25519, key: key}
+	sig, err := s.signature(fields,
+		strings.Split("from : to : subject : date : message-id : from : subject : date", ":"),
+		" v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n"+
+			" d=football.example.com; i=@football.example.com;\r\n"+
+			" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n"+
+			" subject : date : message-id : from : subject : date;\r\n"+
+			" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n"+
+			" b=")
+	require.NoError(t, err)
+	require.Equal(t, "/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11BusFa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==", sig)
+}
+
+func TestDKIMSignRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	signers, err := newDKIMSigners(&config.NotifConfig{EmailDkimKeys: `[{"domain":"Football.example.com","selector":"s1","key":` +
+		`"` + strings.ReplaceAll(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), "\n", `\n`) + `"}]`})
+	require.NoError(t, err)
+
+	msg := []byte(rfc8463Message)
+
+	unsigned, err := signers.sign(msg, "joe@other.example.com", time.Now())
+	require.NoError(t, err)
+	require.Equal(t, msg, unsigned, "domains without a key are not signed")
+
+	signed, err := signers.sign(msg, "joe@football.example.com", time.Unix(1528637909, 0))
+	require.NoError(t, err)
+
+	fields, body := splitMessage(signed)
+	require.Equal(t, "DKIM-Signature", fields[0].name)
+
+	value := fields[0].value
+	require.Contains(t, value, "a=rsa-sha256; c=relaxed/relaxed;")
+	require.Contains(t, value, "d=football.example.com; s=s1; t=1528637909;")
+	require.Contains(t, value, "h=from:to:cc:subject:date:message-id:mime-version:content-type:from;")
+	require.Contains(t, value, "bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;")
+	require.Equal(t, []byte(rfc8463Message[strings.Index(rfc8463Message, "\r\n\r\n")+4:]), body)
+
+	for _, line := range strings.Split(string(signed), "\r\n") {
+		require.LessOrEqual(t, len(line), 78)
+	}
+
+	// a verifier hashes the signature header with an empty b=
+	i := strings.Index(value, "b=") + len("b=")
+	sig, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r\n", "", "\t", "").Replace(value[i:]))
+	require.NoError(t, err)
+
+	h := sha256.New()
+	for _, f := range selectHeaders(fields[1:], dkimHeaders) {
+		h.Write([]byte(relaxedHeader(f.name, f.value) + "\r\n"))
+	}
+
+	h.Write([]byte(relaxedHeader("DKIM-Signature", value[:i])))
+	require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, h.Sum(nil), sig))
+}
+
+func TestDKIMKeys(t *testing.T) {
+	for _, invalid := range []string{
+		`[{"selector":"s1","key":"nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="}]`,
+		`[{"domain":"example.com","key":"nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="}]`,
+	} {
+		_, err := newDKIMSigners(&config.NotifConfig{EmailDkimKeys: invalid})
+		require.ErrorIs(t, err, ErrInvalidDKIMKeys)
+	}
+
+	_, err := newDKIMSigners(&config.NotifConfig{EmailDkimKeys: `[{"domain":"example.com","selector":"s1","key":"c2hvcnQ="}]`})
+	require.ErrorIs(t, err, ErrInvalidDKIMKey)
+}
+
+func TestSendEmailSigned(t *testing.T) {
+	srv := newFakeSMTP(t)
+	host, port := srv.hostPort()
+
+	svc, err := NewEmailService(zap.NewNop().Sugar(), &config.NotifConfig{
+		EmailSmtpHost:     host,
+		EmailSmtpPORT:     port,
+		EmailSmtpUserName: "notif@example.com",
+		EmailDkimKeys:     `[{"domain":"example.com","selector":"s1","key":"nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="}]`,
+	}, nil, trace.NewNoopTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	require.NoError(t, svc.SendEmail(context.Background(), testEntity("a@example.com")))
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	// the fake server reads the data without the CRs
+	require.True(t, strings.HasPrefix(srv.data[0], "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\n\td=example.com; s=s1;"))
+}
@@ -1,20 +1,45 @@
 package email
 
-import "errors"
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
 
 var ErrEmptyToList = errors.New("toList cannot be empty")
 var ErrEmptyAddr = errors.New("toList email addr cannot be empty")
+var ErrInvalidAddr = errors.New("email addr must be a single address, without display name nor line breaks")
+var ErrTemplateCopies = errors.New("ccList and bccList cannot be used with a templateId")
 
 type NameAddr struct {
-	EmailAddr string `json:"emailAddr"`
-	UserName  string `json:"userName"`
+	EmailAddr string                 `json:"emailAddr"`
+	UserName  string                 `json:"userName"`
+	Data      map[string]interface{} `json:"data,omitempty"`
 }
 
 type Entity struct {
-	FromName string     `json:"fromName" validate:"required,min=4,max=15"`
+	FromName string `json:"fromName" validate:"required,min=4,max=15"`
+	// FromAddr sends from another address than EMAIL_FROM, its domain
+	// selects the smtp transports and must be a configured sender domain.
+	FromAddr string     `json:"fromAddr,omitempty" validate:"omitempty,email"`
 	ToList   []NameAddr `json:"toList" validate:"required"`
+	CcList   []NameAddr `json:"ccList,omitempty"`
+	BccList  []NameAddr `json:"bccList,omitempty"`
 	Subject  string     `json:"subject"`
-	Body     string     `json:"" validate:"required"`
+	Body     string     `json:"" validate:"required_without=TemplateID"`
+	TextBody string     `json:"textBody,omitempty"`
+
+	// TemplateID renders the subject and body from a stored template for
+	// every recipient, with Data overridden by the data of the recipient.
+	TemplateID      string                 `json:"templateId,omitempty"`
+	TemplateVersion int                    `json:"templateVersion,omitempty"`
+	Data            map[string]interface{} `json:"data,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty" validate:"omitempty,dive"`
+
+	// envelope overrides Recipients when a send is retried for
+	// a subset of the recipients.
+	envelope []string
 }
 
 func (e *Entity) ToListValidation() error {
@@ -22,11 +47,73 @@ func (e *Entity) ToListValidation() error {
 		return ErrEmptyToList
 	}
 
-	for i := range e.ToList {
-		if e.ToList[i].EmailAddr == "" {
-			return ErrEmptyAddr
+	if e.TemplateID != "" && (len(e.CcList) > 0 || len(e.BccList) > 0) {
+		return ErrTemplateCopies
+	}
+
+	for _, list := range [][]NameAddr{e.ToList, e.CcList, e.BccList} {
+		for i := range list {
+			if list[i].EmailAddr == "" {
+				return ErrEmptyAddr
+			}
+
+			if !validAddr(list[i].EmailAddr) {
+				return ErrInvalidAddr
+			}
 		}
 	}
 
 	return nil
 }
+
+// validAddr tells whether addr is a bare address, which cannot break out
+// of the to and cc headers it is written in.
+func validAddr(addr string) bool {
+	if strings.ContainsAny(addr, "\r\n") {
+		return false
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+
+	return err == nil && parsed.Address == addr
+}
+
+// Recipients returns the envelope recipients of the entity, which are
+// the to, cc and bcc addresses in that order.
+func (e *Entity) Recipients() []string {
+	if e.envelope != nil {
+		return e.envelope
+	}
+
+	rcpts := make([]string, 0, len(e.ToList)+len(e.CcList)+len(e.BccList))
+	for _, list := range [][]NameAddr{e.ToList, e.CcList, e.BccList} {
+		for i := range list {
+			rcpts = append(rcpts, list[i].EmailAddr)
+		}
+	}
+
+	return rcpts
+}
+
+// withEnvelope returns a copy of the entity whose envelope is limited to
+// the given recipients. Headers still carry the original to and cc lists.
+func (e Entity) withEnvelope(rcpts []string) Entity {
+	e.envelope = rcpts
+
+	return e
+}
+
+// RecipientData merges the entity data with the data of the recipient,
+// the recipient wins on conflicting keys.
+func (e *Entity) RecipientData(r NameAddr) map[string]interface{} {
+	data := make(map[string]interface{}, len(e.Data)+len(r.Data))
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	for k, v := range r.Data {
+		data[k] = v
+	}
+
+	return data
+}
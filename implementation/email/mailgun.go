@@ -0,0 +1,98 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type mailgun struct {
+	baseURL string
+	domain  string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewMailgunProvider returns a provider for the Mailgun messages api of
+// domain, or any api mimicking it at baseURL.
+func NewMailgunProvider(baseURL, domain, apiKey string, client *http.Client) APIProvider {
+	return &mailgun{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		domain:  domain,
+		apiKey:  apiKey,
+		client:  client,
+	}
+}
+
+func (g *mailgun) Name() string {
+	return Mailgun
+}
+
+type mailgunResponse struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// Send uploads the MIME message, the recipients are given apart since the
+// bcc addresses are not in its headers.
+func (g *mailgun) Send(ctx context.Context, m *Mail) (string, error) {
+	var buf bytes.Buffer
+
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("to", strings.Join(m.Recipients(), ",")); err != nil {
+		return "", err
+	}
+
+	// user variables are given back by the events of the message
+	if m.NotifID != "" {
+		if err := mw.WriteField("v:"+NotifIDVariable, m.NotifID); err != nil {
+			return "", err
+		}
+	}
+
+	fw, err := mw.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = fw.Write(m.Raw); err != nil {
+		return "", err
+	}
+
+	if err = mw.Close(); err != nil {
+		return "", err
+	}
+
+	endpoint := g.baseURL + "/v3/" + url.PathEscape(g.domain) + "/messages.mime"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &buf)
+	if err != nil {
+		return "", err
+	}
+
+	req.SetBasicAuth("api", g.apiKey)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, data, err := do(g.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var res mailgunResponse
+	_ = json.Unmarshal(data, &res)
+
+	if success(resp) {
+		return res.ID, nil
+	}
+
+	// some errors are not json
+	if res.Message == "" {
+		res.Message = strings.TrimSpace(string(data))
+	}
+
+	return "", newProviderError(resp, "", res.Message)
+}
@@ -0,0 +1,308 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jaytaylor/html2text"
+)
+
+const crlf = "\r\n"
+
+// IDHeader carries the id of the notification of a message, so its
+// bounces and complaints are traced back to it.
+const IDHeader = "X-Notif-Id"
+
+// message is a rfc 5322 message built from an Entity.
+type message struct {
+	from  mail.Address
+	e     Entity
+	date  time.Time
+	msgID string
+	// notifID is the id of the notification, if any
+	notifID string
+}
+
+// newMessage prepares the message of e sent from fromAddr, which is
+// displayed with the entity FromName.
+func newMessage(fromAddr string, e Entity) (*message, error) {
+	msgID, err := newMessageID(fromAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{
+		from:  mail.Address{Name: e.FromName, Address: fromAddr},
+		e:     e,
+		date:  time.Now(),
+		msgID: msgID,
+	}, nil
+}
+
+// newMessageID returns a unique Message-ID on the domain of the sender.
+func newMessageID(fromAddr string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "notif.local"
+	if i := strings.LastIndex(fromAddr, "@"); i >= 0 && i < len(fromAddr)-1 {
+		domain = fromAddr[i+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+// bodyWriter writes the parts of a multipart body.
+type bodyWriter func(mw *multipart.Writer) error
+
+// Bytes renders the headers and the body. The text and html versions of
+// the entity body form a multipart/alternative, wrapped in a
+// multipart/related when there are inline images and in a multipart/mixed
+// when there are attachments.
+func (m *message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader(&buf, "MIME-Version", "1.0")
+	writeHeader(&buf, "Date", m.date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", m.msgID)
+	writeHeader(&buf, "From", m.from.String())
+	writeHeader(&buf, "To", addressList(m.e.ToList))
+
+	if len(m.e.CcList) > 0 {
+		writeHeader(&buf, "Cc", addressList(m.e.CcList))
+	}
+
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.e.Subject))
+
+	if m.notifID != "" {
+		writeHeader(&buf, IDHeader, m.notifID)
+	}
+
+	mediaType, body := "multipart/alternative", bodyWriter(m.writeAlternative)
+	inline, attached := m.e.splitAttachments()
+
+	if len(inline) > 0 {
+		mediaType, body = "multipart/related", withAttachments(mediaType, body, inline)
+	}
+
+	if len(attached) > 0 {
+		mediaType, body = "multipart/mixed", withAttachments(mediaType, body, attached)
+	}
+
+	mw := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", multipartType(mediaType, mw.Boundary()))
+	buf.WriteString(crlf)
+
+	if err := body(mw); err != nil {
+		return nil, err
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeAlternative writes the text and html parts, ordered from the
+// plainest to the richest as rfc 2046 asks. Only the text part is written
+// when the entity has no html body.
+func (m *message) writeAlternative(mw *multipart.Writer) error {
+	text, err := m.text()
+	if err != nil {
+		return err
+	}
+
+	if err = writeQuotedPrintable(mw, "text/plain", text); err != nil || m.e.Body == "" {
+		return err
+	}
+
+	return writeQuotedPrintable(mw, "text/html", m.e.Body)
+}
+
+// text returns the text body of the entity, derived from the html body
+// when it has none.
+func (m *message) text() (string, error) {
+	if m.e.TextBody != "" || m.e.Body == "" {
+		return m.e.TextBody, nil
+	}
+
+	return html2text.FromString(m.e.Body)
+}
+
+// withAttachments returns a bodyWriter which nests the inner body as its
+// first part and follows it with the attachments.
+func withAttachments(innerType string, inner bodyWriter, atts []Attachment) bodyWriter {
+	return func(mw *multipart.Writer) error {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", multipartType(innerType, boundary))
+
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+
+		child := multipart.NewWriter(pw)
+		if err = child.SetBoundary(boundary); err != nil {
+			return err
+		}
+
+		if err = inner(child); err != nil {
+			return err
+		}
+
+		if err = child.Close(); err != nil {
+			return err
+		}
+
+		for i := range atts {
+			if err = writeAttachment(mw, atts[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// multipartType formats a multipart Content-Type. A multipart/related
+// carries the type of its root part as rfc 2387 requires.
+func multipartType(mediaType, boundary string) string {
+	params := map[string]string{"boundary": boundary}
+	if mediaType == "multipart/related" {
+		params["type"] = "multipart/alternative"
+	}
+
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// writeAttachment writes a base64 part, inline with a Content-ID when the
+// attachment is referenced from the html body.
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	content, err := a.decode()
+	if err != nil {
+		return err
+	}
+
+	disposition := "attachment"
+	h := make(textproto.MIMEHeader)
+
+	if a.ContentID != "" {
+		disposition = "inline"
+		h.Set("Content-ID", "<"+a.ContentID+">")
+	}
+
+	// the parameters given with the content type are kept
+	mediaType, params, err := mime.ParseMediaType(a.contentType())
+	if err != nil {
+		return ErrInvalidContentType
+	}
+
+	params["name"] = a.Filename
+
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	w := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: pw})
+	if _, err = w.Write(content); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func writeQuotedPrintable(mw *multipart.Writer, contentType, content string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	return writeAndClose(quotedprintable.NewWriter(pw), content)
+}
+
+func writeAndClose(w io.WriteCloser, content string) error {
+	if _, err := io.WriteString(w, content); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + value + crlf)
+}
+
+// addressList formats the list for an address header, encoding non-ascii
+// display names as rfc 2047 words.
+func addressList(list []NameAddr) string {
+	addrs := make([]string, len(list))
+	for i := range list {
+		addr := mail.Address{Name: list[i].UserName, Address: list[i].EmailAddr}
+		addrs[i] = addr.String()
+	}
+
+	return strings.Join(addrs, ", ")
+}
+
+// lineWriter breaks the base64 output in lines of 76 characters as
+// rfc 2045 requires.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+const maxLineLen = 76
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := 0
+
+	for len(p) > 0 {
+		chunk := maxLineLen - l.col
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+
+		if _, err := l.w.Write(p[:chunk]); err != nil {
+			return n, err
+		}
+
+		n += chunk
+		l.col += chunk
+		p = p[chunk:]
+
+		if l.col == maxLineLen {
+			if _, err := io.WriteString(l.w, crlf); err != nil {
+				return n, err
+			}
+
+			l.col = 0
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,206 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"testing"
+
+	"notif/pkg/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes(t *testing.T) {
+	e := Entity{
+		FromName: "Notif Ünicode",
+		ToList:   []NameAddr{{EmailAddr: "a@example.com", UserName: "Jörg"}},
+		CcList:   []NameAddr{{EmailAddr: "c@example.com"}},
+		BccList:  []NameAddr{{EmailAddr: "hidden@example.com"}},
+		Subject:  "Grüße from notif",
+		Body:     "<p>Hello <b>Jörg</b>, a line long enough to need a soft break in quoted printable encoding for sure</p>",
+	}
+
+	m, err := newMessage("notif@example.com", e)
+	require.NoError(t, err)
+
+	raw, err := m.Bytes()
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, e.Subject, subject)
+
+	from, err := msg.Header.AddressList("From")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Notif Ünicode", Address: "notif@example.com"}}, from)
+
+	to, err := msg.Header.AddressList("To")
+	require.NoError(t, err)
+	require.Equal(t, "Jörg", to[0].Name)
+
+	require.Equal(t, "<c@example.com>", msg.Header.Get("Cc"))
+	require.Empty(t, msg.Header.Get("Bcc"))
+	require.Regexp(t, `^<[0-9a-f]{32}@example\.com>$`, msg.Header.Get("Message-ID"))
+
+	_, err = msg.Header.Date()
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	var types, bodies []string
+
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		// multipart.Reader transparently decodes quoted-printable parts
+		b, err := io.ReadAll(p)
+		require.NoError(t, err)
+
+		types = append(types, p.Header.Get("Content-Type"))
+		bodies = append(bodies, string(b))
+	}
+
+	require.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, types)
+	require.Contains(t, bodies[0], "Hello *Jörg*")
+	require.Equal(t, e.Body, bodies[1])
+}
+
+func TestMessageWithAttachments(t *testing.T) {
+	pdf := bytes.Repeat([]byte("%PDF-1.4 invoice "), 20)
+	png := []byte("\x89PNG fake image")
+
+	e := Entity{
+		FromName: "notif",
+		ToList:   []NameAddr{{EmailAddr: "a@example.com"}},
+		Subject:  "invoice",
+		Body:     `<p>see attached</p><img src="cid:logo">`,
+		Attachments: []Attachment{
+			{Filename: "invoice.pdf", ContentType: "application/pdf", Content: base64.StdEncoding.EncodeToString(pdf)},
+			{Filename: "logo.png", ContentType: "image/png", Content: base64.StdEncoding.EncodeToString(png), ContentID: "logo"},
+		},
+	}
+
+	require.NoError(t, e.AttachmentValidation())
+
+	m, err := newMessage("notif@example.com", e)
+	require.NoError(t, err)
+
+	raw, err := m.Bytes()
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	parts := readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	require.Equal(t, []string{"multipart/related", "application/pdf"}, mediaTypes(parts))
+	require.Equal(t, pdf, parts[1].body)
+	require.Contains(t, parts[1].header.Get("Content-Disposition"), "attachment")
+
+	related := readParts(t, parts[0].header.Get("Content-Type"), bytes.NewReader(parts[0].body))
+	require.Equal(t, []string{"multipart/alternative", "image/png"}, mediaTypes(related))
+	require.Equal(t, png, related[1].body)
+	require.Equal(t, "<logo>", related[1].header.Get("Content-Id"))
+
+	alternative := readParts(t, related[0].header.Get("Content-Type"), bytes.NewReader(related[0].body))
+	require.Equal(t, []string{"text/plain", "text/html"}, mediaTypes(alternative))
+}
+
+func TestAttachmentValidation(t *testing.T) {
+	maxEach, maxTotal := attachmentLimits()
+	require.LessOrEqual(t, maxTotal, int(config.NatsMaxPayload))
+
+	big := base64.StdEncoding.EncodeToString(make([]byte, maxEach+1))
+
+	e := Entity{Attachments: []Attachment{{Filename: "big.bin", Content: big}}}
+	require.ErrorIs(t, e.AttachmentValidation(), ErrAttachmentTooLarge)
+
+	third := base64.StdEncoding.EncodeToString(make([]byte, maxTotal/3+1))
+	e = Entity{Attachments: []Attachment{{Filename: "a", Content: third}, {Filename: "b", Content: third}, {Filename: "c", Content: third}}}
+	require.ErrorIs(t, e.AttachmentValidation(), ErrAttachmentsTooLarge)
+
+	e = Entity{Attachments: []Attachment{{Filename: "a", ContentType: "not a type;;", Content: "AA=="}}}
+	require.ErrorIs(t, e.AttachmentValidation(), ErrInvalidContentType)
+
+	for _, id := range []string{"logo>\r\nBcc: x@example.com", "a b", "<logo>"} {
+		e = Entity{Attachments: []Attachment{{Filename: "a", ContentID: id, Content: "AA=="}}}
+		require.ErrorIs(t, e.AttachmentValidation(), ErrInvalidContentID)
+	}
+}
+
+func TestAttachmentContentTypeParams(t *testing.T) {
+	var buf bytes.Buffer
+
+	mw := multipart.NewWriter(&buf)
+	require.NoError(t, writeAttachment(mw, Attachment{Filename: "notes.txt", ContentType: "text/plain; charset=utf-8",
+		Content: base64.StdEncoding.EncodeToString([]byte("hi"))}))
+	require.NoError(t, mw.Close())
+
+	parts := readParts(t, mw.FormDataContentType(), &buf)
+	mediaType, params, err := mime.ParseMediaType(parts[0].header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", mediaType)
+	require.Equal(t, map[string]string{"charset": "utf-8", "name": "notes.txt"}, params)
+}
+
+type part struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// readParts reads the decoded parts of a multipart body.
+func readParts(t *testing.T, contentType string, r io.Reader) []part {
+	t.Helper()
+
+	_, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+
+	var parts []part
+
+	mr := multipart.NewReader(r, params["boundary"])
+
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+
+		require.NoError(t, err)
+
+		var body io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			body = base64.NewDecoder(base64.StdEncoding, p)
+		}
+
+		b, err := io.ReadAll(body)
+		require.NoError(t, err)
+
+		parts = append(parts, part{header: p.Header, body: b})
+	}
+}
+
+func mediaTypes(parts []part) []string {
+	types := make([]string, len(parts))
+	for i := range parts {
+		types[i], _, _ = mime.ParseMediaType(parts[i].header.Get("Content-Type"))
+	}
+
+	return types
+}
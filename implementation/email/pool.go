@@ -0,0 +1,292 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"notif/pkg/config"
+)
+
+const (
+	// TLSStartTLS upgrades the connection when the server offers STARTTLS.
+	TLSStartTLS = "starttls"
+	// TLSStartTLSRequired fails when the server does not offer STARTTLS.
+	TLSStartTLSRequired = "starttls-required"
+	// TLSImplicit connects over tls right away, as on port 465.
+	TLSImplicit = "implicit"
+	// TLSNone never upgrades the connection, for local test servers.
+	TLSNone = "none"
+
+	implicitTLSPort = "465"
+)
+
+var (
+	ErrStartTLSRequired = errors.New("smtp server does not offer STARTTLS")
+	ErrUnknownTLSMode   = errors.New("unknown smtp tls mode")
+	ErrInvalidCAFile    = errors.New("smtp ca file holds no pem certificate")
+)
+
+// Relay tells how to reach and authenticate with a smtp server.
+type Relay struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// TLS is one of the TLS* modes, it defaults to TLSImplicit on port
+	// 465 and to TLSStartTLS otherwise.
+	TLS                string
+	CAFile             string
+	InsecureSkipVerify bool
+	// Auth is one of the Auth* mechanisms, the one advertised by the
+	// server is picked when it is empty.
+	Auth        string
+	TokenSource TokenSource
+	// PoolSize bounds the connections kept open to the server.
+	PoolSize int
+}
+
+// relayFromConfig returns the relay of the EMAIL_SMTP_* config.
+func relayFromConfig(cfg *config.NotifConfig) Relay {
+	return Relay{
+		Host:               cfg.EmailSmtpHost,
+		Port:               cfg.EmailSmtpPORT,
+		Username:           cfg.EmailSmtpUserName,
+		Password:           cfg.EmailSmtpPassword,
+		TLS:                cfg.EmailSmtpTLS,
+		CAFile:             cfg.EmailSmtpCAFile,
+		InsecureSkipVerify: cfg.EmailSmtpInsecureSkipVerify,
+		Auth:               cfg.EmailSmtpAuth,
+		TokenSource:        tokenSourceFromConfig(cfg),
+		PoolSize:           cfg.EmailSmtpPoolSize,
+	}
+}
+
+func (r Relay) tlsMode() (string, error) {
+	switch r.TLS {
+	case "":
+		if r.Port == implicitTLSPort {
+			return TLSImplicit, nil
+		}
+
+		return TLSStartTLS, nil
+
+	case TLSStartTLS, TLSStartTLSRequired, TLSImplicit, TLSNone:
+		return r.TLS, nil
+
+	default:
+		return "", ErrUnknownTLSMode
+	}
+}
+
+// tlsConfig trusts the certificates of CAFile on top of the system ones.
+func (r Relay) tlsConfig() (*tls.Config, error) {
+	// nolint:gosec // min version is left to the server defaults like smtp.SendMail and skipping verification is opt-in
+	cfg := &tls.Config{
+		ServerName:         r.Host,
+		InsecureSkipVerify: r.InsecureSkipVerify,
+	}
+
+	if r.CAFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := ioutil.ReadFile(r.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, ErrInvalidCAFile
+	}
+
+	cfg.RootCAs = roots
+
+	return cfg, nil
+}
+
+// smtpConn is an authenticated connection to the relay.
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// pool keeps up to PoolSize authenticated connections open. Every slot
+// holds an idle connection or nil when it has none, so taking a slot
+// bounds the open connections.
+type pool struct {
+	relay     Relay
+	mode      string
+	tlsConfig *tls.Config
+	slots     chan *smtpConn
+}
+
+func newPool(r Relay) (*pool, error) {
+	mode, err := r.tlsMode()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.validAuth(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	size := r.PoolSize
+	if size < 1 {
+		size = 1
+	}
+
+	slots := make(chan *smtpConn, size)
+	for i := 0; i < size; i++ {
+		slots <- nil
+	}
+
+	return &pool{
+		relay:     r,
+		mode:      mode,
+		tlsConfig: tlsConfig,
+		slots:     slots,
+	}, nil
+}
+
+// get returns a connection ready for a mail transaction. An idle one is
+// reused once RSET tells it is still alive, a stale or broken one is
+// replaced by a new one.
+func (p *pool) get(ctx context.Context) (*smtpConn, error) {
+	var c *smtpConn
+
+	select {
+	case c = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if c != nil && time.Since(c.lastUsed) < config.SmtpIdleTimeOut {
+		_ = c.conn.SetDeadline(time.Now().Add(config.SmtpTimeOut))
+		if err := c.client.Reset(); err == nil {
+			return c, nil
+		}
+	}
+
+	if c != nil {
+		_ = c.client.Close()
+	}
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		p.slots <- nil
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// put gives c back to the pool, or closes it when lost.
+func (p *pool) put(c *smtpConn, lost bool) {
+	if lost {
+		_ = c.client.Close()
+		p.slots <- nil
+
+		return
+	}
+
+	c.lastUsed = time.Now()
+	p.slots <- c
+}
+
+// dial connects, upgrades the connection to tls as the mode asks and
+// authenticates when the server supports it.
+func (p *pool) dial(ctx context.Context) (*smtpConn, error) {
+	addr := net.JoinHostPort(p.relay.Host, p.relay.Port)
+	dialer := &net.Dialer{Timeout: config.SmtpDialTimeOut}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if p.mode == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: p.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(config.SmtpTimeOut))
+
+	client, err := smtp.NewClient(conn, p.relay.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err = p.handshake(ctx, client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+func (p *pool) handshake(ctx context.Context, c *smtp.Client) error {
+	if p.mode == TLSStartTLS || p.mode == TLSStartTLSRequired {
+		ok, _ := c.Extension("STARTTLS")
+
+		switch {
+		case ok:
+			if err := c.StartTLS(p.tlsConfig); err != nil {
+				return err
+			}
+
+		case p.mode == TLSStartTLSRequired:
+			return ErrStartTLSRequired
+		}
+	}
+
+	ok, mechs := c.Extension("AUTH")
+	if !ok {
+		return nil
+	}
+
+	auth, err := p.relay.auth(ctx, mechs)
+	if err != nil || auth == nil {
+		return err
+	}
+
+	return c.Auth(auth)
+}
+
+// connLost tells whether err leaves the connection unusable, either the
+// server is closing it with a 421 or the connection itself failed.
+func connLost(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code == 421
+	}
+
+	return true
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPool(t *testing.T, srv *fakeSMTP, r Relay) *pool {
+	t.Helper()
+
+	r.Host, r.Port = srv.hostPort()
+	r.PoolSize = 1
+
+	p, err := newPool(r)
+	require.NoError(t, err)
+
+	return p
+}
+
+// sendOne runs a transaction for a single recipient like SendEmail does.
+func sendOne(t *testing.T, p *pool) error {
+	t.Helper()
+
+	tr := &transport{name: defaultTransport, weight: 1, pool: p, breaker: &breaker{}}
+	_, err := tr.send(context.Background(), "notif@example.com", []string{"a@example.com"},
+		[]byte("Subject: hi\r\n\r\nhello\r\n"))
+
+	return err
+}
+
+func TestPoolReusesConnection(t *testing.T) {
+	srv := newFakeSMTP(t)
+	p := newTestPool(t, srv, Relay{})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendOne(t, p))
+	}
+
+	conns, rsets := srv.stats()
+	require.Equal(t, 1, conns, "the connection is kept open")
+	require.Equal(t, 2, rsets, "a reused connection is reset first")
+}
+
+func TestPoolReconnects(t *testing.T) {
+	srv := newFakeSMTP(t)
+	p := newTestPool(t, srv, Relay{})
+
+	// the server closes the connection in the middle of the transaction
+	srv.mu.Lock()
+	srv.closeMail = 1
+	srv.mu.Unlock()
+
+	require.NoError(t, sendOne(t, p))
+
+	conns, _ := srv.stats()
+	require.Equal(t, 2, conns)
+
+	// the server closed the idle connection
+	srv.mu.Lock()
+	srv.closeRset = true
+	srv.mu.Unlock()
+
+	require.NoError(t, sendOne(t, p))
+
+	conns, _ = srv.stats()
+	require.Equal(t, 3, conns)
+	require.Len(t, srv.accepted(), 2)
+}
+
+func TestPoolStartTLSRequired(t *testing.T) {
+	srv := newFakeSMTP(t)
+	p := newTestPool(t, srv, Relay{TLS: TLSStartTLSRequired})
+
+	err := sendOne(t, p)
+	require.ErrorIs(t, err, ErrStartTLSRequired)
+
+	_, err = newPool(Relay{TLS: "ssl"})
+	require.ErrorIs(t, err, ErrUnknownTLSMode)
+}
+
+func TestPoolImplicitTLS(t *testing.T) {
+	cert, caFile := selfSigned(t)
+	srv := newFakeSMTPWithTLS(t, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+
+	require.Error(t, sendOne(t, newTestPool(t, srv, Relay{TLS: TLSImplicit})), "the certificate is not trusted")
+	require.NoError(t, sendOne(t, newTestPool(t, srv, Relay{TLS: TLSImplicit, CAFile: caFile})))
+	require.NoError(t, sendOne(t, newTestPool(t, srv, Relay{TLS: TLSImplicit, InsecureSkipVerify: true})))
+
+	r := Relay{Port: implicitTLSPort}
+	mode, err := r.tlsMode()
+	require.NoError(t, err)
+	require.Equal(t, TLSImplicit, mode, "port 465 defaults to implicit tls")
+}
+
+// selfSigned returns a certificate for 127.0.0.1 and the file of its pem.
+func selfSigned(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,203 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"notif/pkg/config"
+)
+
+var ErrUnknownProvider = errors.New("unknown email provider")
+
+// maxResponseBody bounds how much of a provider response is read.
+const maxResponseBody = 64 << 10
+
+// NotifIDVariable names the notification id in the custom variables of
+// the providers.
+const NotifIDVariable = "notif_id"
+
+const (
+	// SMTP is the EMAIL_PROVIDER value sending through the smtp relays.
+	SMTP = "smtp"
+	// SendGrid is the EMAIL_PROVIDER value of the SendGrid v3 mail api.
+	SendGrid = "sendgrid"
+	// Mailgun is the EMAIL_PROVIDER value of the Mailgun messages api.
+	Mailgun = "mailgun"
+	// SES is the EMAIL_PROVIDER value of the Amazon SES v2 api.
+	SES = "ses"
+)
+
+// Mail is a rendered message handed to an APIProvider.
+type Mail struct {
+	From        mail.Address
+	To          []mail.Address
+	Cc          []mail.Address
+	Bcc         []mail.Address
+	Subject     string
+	HTML        string
+	Text        string
+	Attachments []Attachment
+	MessageID   string
+	// NotifID is the id of the notification, given back by the bounce and
+	// complaint events of the provider.
+	NotifID string
+	// Raw is the MIME message, for the providers sending it as is.
+	Raw []byte
+}
+
+// newMail renders m for the providers.
+func newMail(m *message) (*Mail, error) {
+	raw, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := m.text()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mail{
+		From:        m.from,
+		To:          addresses(m.e.ToList),
+		Cc:          addresses(m.e.CcList),
+		Bcc:         addresses(m.e.BccList),
+		Subject:     m.e.Subject,
+		HTML:        m.e.Body,
+		Text:        text,
+		Attachments: m.e.Attachments,
+		MessageID:   m.msgID,
+		NotifID:     m.notifID,
+		Raw:         raw,
+	}, nil
+}
+
+func addresses(list []NameAddr) []mail.Address {
+	addrs := make([]mail.Address, len(list))
+	for i := range list {
+		addrs[i] = mail.Address{Name: list[i].UserName, Address: list[i].EmailAddr}
+	}
+
+	return addrs
+}
+
+// Recipients returns the to, cc and bcc addresses of the mail.
+func (m *Mail) Recipients() []string {
+	rcpts := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	for _, list := range [][]mail.Address{m.To, m.Cc, m.Bcc} {
+		for i := range list {
+			rcpts = append(rcpts, list[i].Address)
+		}
+	}
+
+	return rcpts
+}
+
+// APIProvider hands mails to an email provider over http.
+type APIProvider interface {
+	// Name identifies the provider in logs and traces.
+	Name() string
+	// Send delivers the mail and returns the id the provider gave it.
+	// Failures reported by the provider are *ProviderError.
+	Send(ctx context.Context, m *Mail) (string, error)
+}
+
+// ProviderError is a failure reported by the provider.
+type ProviderError struct {
+	Status    int
+	Code      string
+	Message   string
+	Retryable bool
+	// RetryAfter is the delay the provider asked for before a retry.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("email provider responded with status %d code %s: %s", e.Status, e.Code, e.Message)
+}
+
+// newProviderError returns the error of a failed provider response,
+// retryable on rate limits, timeouts and server errors.
+func newProviderError(resp *http.Response, code, message string) *ProviderError {
+	return &ProviderError{
+		Status:  resp.StatusCode,
+		Code:    code,
+		Message: message,
+		Retryable: resp.StatusCode >= http.StatusInternalServerError ||
+			resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// do sends req and reads the response body.
+func do(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, data, nil
+}
+
+func success(resp *http.Response) bool {
+	return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// NewAPIProvider returns the provider selected by EMAIL_PROVIDER, or nil
+// when email is sent over smtp.
+func NewAPIProvider(cfg *config.NotifConfig) (APIProvider, error) {
+	client := &http.Client{Timeout: config.EmailApiTimeOut}
+
+	switch cfg.EmailProvider {
+	case "", SMTP:
+		return nil, nil
+
+	case SendGrid:
+		return NewSendGridProvider(cfg.EmailSendGridBaseURL, cfg.EmailSendGridAPIKey, client), nil
+
+	case Mailgun:
+		return NewMailgunProvider(cfg.EmailMailgunBaseURL, cfg.EmailMailgunDomain, cfg.EmailMailgunAPIKey, client), nil
+
+	case SES:
+		return NewSESProvider(cfg.EmailSesBaseURL, cfg.EmailSesRegion, Credentials{
+			AccessKeyID:     cfg.EmailSesAccessKeyID,
+			SecretAccessKey: cfg.EmailSesSecretAccessKey,
+			SessionToken:    cfg.EmailSesSessionToken,
+		}, client), nil
+
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
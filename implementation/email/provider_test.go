@@ -0,0 +1,253 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/pkg/config"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func testEntity(to string) Entity {
+	return Entity{
+		FromName: "notif",
+		ToList:   []NameAddr{{EmailAddr: to, UserName: "A"}},
+		BccList:  []NameAddr{{EmailAddr: "b@example.com"}},
+		Subject:  "hi",
+		Body:     "<p>hello</p>",
+		Attachments: []Attachment{{
+			Filename:  "logo.png",
+			Content:   base64.StdEncoding.EncodeToString([]byte("png")),
+			ContentID: "logo",
+		}},
+	}
+}
+
+// sendThrough sends e through provider as the email channel does.
+func sendThrough(p APIProvider, e Entity) error {
+	svc, err := NewAPIService(zap.NewNop().Sugar(), &config.NotifConfig{EmailFrom: "notif@example.com"},
+		p, nil, trace.NewNoopTracerProvider().Tracer(""))
+	if err != nil {
+		return err
+	}
+
+	return NewChannel(svc, nil).Send(context.Background(), e)
+}
+
+func TestSendGridProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v3/mail/send", r.URL.Path)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		var body sendGridRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		switch body.Personalizations[0].To[0].Email {
+		case "invalid@example.com":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"invalid email","field":"personalizations.0.to"}]}`))
+		case "limited@example.com":
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			require.Equal(t, "notif@example.com", body.From.Email)
+			require.Equal(t, []sendGridAddress{{Email: "b@example.com"}}, body.Personalizations[0].Bcc)
+			require.Equal(t, []sendGridContent{{Type: "text/plain", Value: "hello"}, {Type: "text/html", Value: "<p>hello</p>"}}, body.Content)
+			require.Equal(t, "inline", body.Attachments[0].Disposition)
+			require.Equal(t, "logo", body.Attachments[0].ContentID)
+
+			w.Header().Set("X-Message-Id", "sg-1")
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewSendGridProvider(srv.URL+"/", "key", srv.Client())
+
+	msg, err := newMessage("notif@example.com", testEntity("a@example.com"))
+	require.NoError(t, err)
+	m, err := newMail(msg)
+	require.NoError(t, err)
+
+	id, err := p.Send(context.Background(), m)
+	require.NoError(t, err)
+	require.Equal(t, "sg-1", id)
+
+	err = sendThrough(p, testEntity("invalid@example.com"))
+	require.True(t, channel.IsPermanent(err))
+	require.Contains(t, err.Error(), "personalizations.0.to: invalid email")
+
+	err = sendThrough(p, testEntity("limited@example.com"))
+	after, ok := channel.RetryAfter(err)
+	require.True(t, ok)
+	require.Equal(t, 7*time.Second, after)
+}
+
+func TestMailgunProvider(t *testing.T) {
+	status := http.StatusOK
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v3/mg.example.com/messages.mime", r.URL.Path)
+
+		user, pass, _ := r.BasicAuth()
+		require.Equal(t, "api", user)
+		require.Equal(t, "key", pass)
+
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		require.Equal(t, "a@example.com,b@example.com", r.FormValue("to"))
+
+		f, _, err := r.FormFile("message")
+		require.NoError(t, err)
+		raw, _ := ioutil.ReadAll(f)
+		require.Contains(t, string(raw), "Subject: hi")
+		require.NotContains(t, string(raw), "<b@example.com>", "bcc is not in the headers")
+
+		w.WriteHeader(status)
+
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"id":"<mg-1@mg.example.com>","message":"Queued. Thank you."}`))
+			return
+		}
+
+		_, _ = w.Write([]byte("Forbidden"))
+	}))
+	defer srv.Close()
+
+	p := NewMailgunProvider(srv.URL, "mg.example.com", "key", srv.Client())
+	require.NoError(t, sendThrough(p, testEntity("a@example.com")))
+
+	msg, err := newMessage("notif@example.com", testEntity("a@example.com"))
+	require.NoError(t, err)
+	m, err := newMail(msg)
+	require.NoError(t, err)
+
+	id, err := p.Send(context.Background(), m)
+	require.NoError(t, err)
+	require.Equal(t, "<mg-1@mg.example.com>", id)
+
+	status = http.StatusServiceUnavailable
+	err = sendThrough(p, testEntity("a@example.com"))
+	require.Error(t, err)
+	require.False(t, channel.IsPermanent(err), "server errors are retried")
+
+	status = http.StatusForbidden
+	err = sendThrough(p, testEntity("a@example.com"))
+	require.True(t, channel.IsPermanent(err))
+	require.Contains(t, err.Error(), "Forbidden")
+}
+
+func TestSESProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/email/outbound-emails", r.URL.Path)
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		require.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token,")
+		require.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+
+		var body sesRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, []string{"b@example.com"}, body.Destination.BccAddresses)
+		require.Contains(t, string(body.Content.Raw.Data), "Subject: hi")
+
+		if body.Destination.ToAddresses[0] == "unverified@example.com" {
+			w.Header().Set("X-Amzn-Errortype", "MessageRejected:http://internal.amazon.com/coral/com.amazonaws.sesv2/")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"Email address is not verified."}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"MessageId":"ses-1"}`))
+	}))
+	defer srv.Close()
+
+	p := NewSESProvider(srv.URL, "eu-west-1", Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, srv.Client())
+
+	msg, err := newMessage("notif@example.com", testEntity("a@example.com"))
+	require.NoError(t, err)
+	m, err := newMail(msg)
+	require.NoError(t, err)
+
+	id, err := p.Send(context.Background(), m)
+	require.NoError(t, err)
+	require.Equal(t, "ses-1", id)
+
+	err = sendThrough(p, testEntity("unverified@example.com"))
+	require.True(t, channel.IsPermanent(err))
+
+	var pErr *ProviderError
+	require.ErrorAs(t, err, &pErr)
+	require.Equal(t, "MessageRejected", pErr.Code)
+}
+
+// TestSignV4 checks the get-vanilla case of the aws signature v4 test suite.
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	signV4(req, nil, "us-east-1", "service",
+		Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"},
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+type recordingProvider struct{ sent []*Mail }
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) Send(_ context.Context, m *Mail) (string, error) {
+	p.sent = append(p.sent, m)
+	return "id", nil
+}
+
+type suppressed map[string]bool
+
+func (s suppressed) Suppressed(_ context.Context, addrs []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+
+	for i := range addrs {
+		if s[addrs[i]] {
+			found[addrs[i]] = true
+		}
+	}
+
+	return found, nil
+}
+
+func TestAPIServiceSuppressions(t *testing.T) {
+	p := &recordingProvider{}
+	svc, err := NewAPIService(zap.NewNop().Sugar(), &config.NotifConfig{EmailFrom: "notif@example.com"},
+		p, suppressed{"b@example.com": true}, trace.NewNoopTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	// the suppressed bcc is left out and failed for good
+	err = svc.SendEmail(context.Background(), testEntity("a@example.com"))
+
+	var dErr *channel.DeliveryError
+	require.ErrorAs(t, err, &dErr)
+	require.Empty(t, dErr.Deferred())
+	require.Len(t, p.sent, 1)
+	require.Empty(t, p.sent[0].Bcc)
+	require.Equal(t, "a@example.com", p.sent[0].To[0].Address)
+
+	// nothing is sent when every recipient is suppressed
+	e := testEntity("b@example.com")
+	e.BccList = nil
+
+	require.ErrorAs(t, svc.SendEmail(context.Background(), e), &dErr)
+	require.ErrorIs(t, dErr.Results[0].Err, ErrSuppressed)
+	require.Len(t, p.sent, 1)
+}
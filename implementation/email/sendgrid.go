@@ -0,0 +1,162 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+type sendGrid struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewSendGridProvider returns a provider for the SendGrid v3 mail send
+// api, or any api mimicking it at baseURL.
+func NewSendGridProvider(baseURL, apiKey string, client *http.Client) APIProvider {
+	return &sendGrid{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  client,
+	}
+}
+
+func (s *sendGrid) Name() string {
+	return SendGrid
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	// CustomArgs are given back by the events of the message.
+	CustomArgs map[string]string `json:"custom_args,omitempty"`
+}
+
+type sendGridResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+	} `json:"errors"`
+}
+
+func sendGridAddresses(addrs []mail.Address) []sendGridAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	list := make([]sendGridAddress, len(addrs))
+	for i := range addrs {
+		list[i] = sendGridAddress{Email: addrs[i].Address, Name: addrs[i].Name}
+	}
+
+	return list
+}
+
+// Send posts the mail as json, sendgrid builds the MIME message itself so
+// only the text and html bodies are given.
+func (s *sendGrid) Send(ctx context.Context, m *Mail) (string, error) {
+	body := sendGridRequest{
+		Personalizations: []sendGridPersonalization{{
+			To:  sendGridAddresses(m.To),
+			Cc:  sendGridAddresses(m.Cc),
+			Bcc: sendGridAddresses(m.Bcc),
+		}},
+		From:    sendGridAddress{Email: m.From.Address, Name: m.From.Name},
+		Subject: m.Subject,
+		Content: []sendGridContent{{Type: "text/plain", Value: m.Text}},
+	}
+
+	if m.NotifID != "" {
+		body.Headers = map[string]string{IDHeader: m.NotifID}
+		body.CustomArgs = map[string]string{NotifIDVariable: m.NotifID}
+	}
+
+	if m.HTML != "" {
+		body.Content = append(body.Content, sendGridContent{Type: "text/html", Value: m.HTML})
+	}
+
+	for _, a := range m.Attachments {
+		disposition := "attachment"
+		if a.ContentID != "" {
+			disposition = "inline"
+		}
+
+		body.Attachments = append(body.Attachments, sendGridAttachment{
+			Content:     a.Content,
+			Type:        a.contentType(),
+			Filename:    a.Filename,
+			Disposition: disposition,
+			ContentID:   a.ContentID,
+		})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v3/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, data, err := do(s.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	// the id of an accepted mail is only given as a header
+	if success(resp) {
+		return resp.Header.Get("X-Message-Id"), nil
+	}
+
+	var res sendGridResponse
+	_ = json.Unmarshal(data, &res)
+
+	msgs := make([]string, 0, len(res.Errors))
+	for _, e := range res.Errors {
+		msg := e.Message
+		if e.Field != "" {
+			msg = e.Field + ": " + msg
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return "", newProviderError(resp, "", strings.Join(msgs, "; "))
+}
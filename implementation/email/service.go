@@ -3,51 +3,348 @@ package email
 
 import (
 	"context"
+	"errors"
 	"net/smtp"
+	"strings"
 
+	"notif/implementation/channel"
 	"notif/pkg/config"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+var ErrSenderDomain = errors.New("fromAddr domain is not a configured sender domain")
+
 type Service interface {
 	SendEmail(ctx context.Context, e Entity) error
+	// SendsFrom tells whether mail may be sent from addr, its domain being
+	// the one of the default sender, routed by a transport or signed with
+	// a dkim key.
+	SendsFrom(addr string) bool
 }
 
 type service struct {
-	log    *zap.SugaredLogger
-	cfg    *config.NotifConfig
-	tracer trace.Tracer
+	log          *zap.SugaredLogger
+	cfg          *config.NotifConfig
+	transports   []*transport
+	dkim         dkimSigners
+	domains      map[string]bool
+	suppressions Suppressions
+	tracer       trace.Tracer
 }
 
-func NewEmailService(logger *zap.SugaredLogger, config *config.NotifConfig, t trace.Tracer) Service {
-	return &service{
-		log:    logger,
-		cfg:    config,
-		tracer: t,
+// NewEmailService returns a Service sending through pools of connections
+// to the EMAIL_SMTP_TRANSPORTS relays, or to the EMAIL_SMTP_* relay, and
+// skipping the addresses of suppressions when it is not nil.
+func NewEmailService(logger *zap.SugaredLogger, config *config.NotifConfig, suppressions Suppressions,
+	t trace.Tracer) (Service, error) {
+	transports, err := newTransports(config)
+	if err != nil {
+		return nil, err
 	}
+
+	dkim, err := newDKIMSigners(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &service{
+		log:          logger,
+		cfg:          config,
+		transports:   transports,
+		dkim:         dkim,
+		domains:      senderDomains(config, dkim, transports),
+		suppressions: suppressions,
+		tracer:       t,
+	}, nil
 }
 
 func (s *service) SendEmail(ctx context.Context, e Entity) error {
-	_, span := s.tracer.Start(ctx, "sendEmail-func")
+	ctx, span := s.tracer.Start(ctx, "sendEmail-func")
 	defer span.End()
 
 	traceID := span.SpanContext().TraceID().String()
 
-	auth := smtp.PlainAuth("", s.cfg.EmailSmtpUserName, s.cfg.EmailSmtpPassword, s.cfg.EmailSmtpHost)
-	smtpAddr := s.cfg.EmailSmtpHost + ":" + s.cfg.EmailSmtpPORT
+	from := sender(s.cfg, e)
 
-	body := []byte(e.Body)
-	err := smtp.SendMail(smtpAddr, auth, s.cfg.EmailSmtpUserName, []string{e.ToList[0].EmailAddr}, body)
+	msg, err := newMessage(from, e)
 	if err != nil {
-		s.log.Errorf(err.Error(), zap.String("traceID", traceID))
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+		return s.fail(span, traceID, err)
+	}
 
-		return err
+	msg.notifID = channel.ID(ctx)
+
+	span.SetAttributes(attribute.String("email.message_id", msg.msgID))
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	if body, err = s.dkim.sign(body, from, msg.date); err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	// the suppressed recipients are rejected without being sent to
+	rcpts, results, err := suppress(ctx, s.suppressions, e.Recipients())
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	if len(rcpts) > 0 {
+		results = append(s.send(ctx, from, rcpts, body), results...)
+	}
+
+	for i := range results {
+		s.recordResult(span, traceID, results[i])
+	}
+
+	for i := range results {
+		if results[i].Status != channel.Delivered {
+			err = &channel.DeliveryError{Results: results}
+			break
+		}
+	}
+
+	if err != nil {
+		return s.fail(span, traceID, err)
 	}
 
 	return nil
 }
+
+// fail logs err and records it on the span before returning it.
+func (s *service) fail(span trace.Span, traceID string, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
+
+// send delivers body to every rcpt through the transports routing the
+// domain of from. The recipients deferred by a transport, on a connection
+// error or a 4xx, fail over to the next one.
+func (s *service) send(ctx context.Context, from string, rcpts []string, body []byte) []channel.Result {
+	results := newResults(rcpts)
+
+	transports, err := route(s.transports, domainOf(from))
+	if err != nil {
+		if errors.Is(err, ErrNoTransport) {
+			for i := range results {
+				results[i].Status = channel.Rejected
+				results[i].Err = err
+			}
+
+			return results
+		}
+
+		return deferAll(results, err)
+	}
+
+	// pending maps the deferred recipients to their result
+	pending := make(map[string]*channel.Result, len(rcpts))
+	for i := range results {
+		pending[results[i].Recipient] = &results[i]
+	}
+
+	for _, t := range transports {
+		left := make([]string, 0, len(pending))
+		for i := range rcpts {
+			if _, ok := pending[rcpts[i]]; ok {
+				left = append(left, rcpts[i])
+			}
+		}
+
+		sent, err := t.send(ctx, from, left, body)
+		if ctx.Err() != nil {
+			break
+		}
+
+		t.breaker.record(healthy(sent, err))
+
+		for i := range sent {
+			*pending[sent[i].Recipient] = sent[i]
+			if sent[i].Status != channel.Deferred {
+				delete(pending, sent[i].Recipient)
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		s.log.Warnw("failing over to the next smtp transport", "transport", t.name,
+			"deferred", len(pending))
+	}
+
+	return results
+}
+
+// sender returns the address e is sent from: its own, EMAIL_FROM or
+// EMAIL_SMTP_USERNAME.
+func sender(cfg *config.NotifConfig, e Entity) string {
+	switch {
+	case e.FromAddr != "":
+		return e.FromAddr
+	case cfg.EmailFrom != "":
+		return cfg.EmailFrom
+	default:
+		return cfg.EmailSmtpUserName
+	}
+}
+
+func (s *service) SendsFrom(addr string) bool {
+	return s.domains[strings.ToLower(domainOf(addr))]
+}
+
+// senderDomains returns the domains mail may be sent from: the one of the
+// default sender, the ones with a dkim key and the ones routed by a
+// transport.
+func senderDomains(cfg *config.NotifConfig, dkim dkimSigners, transports []*transport) map[string]bool {
+	domains := map[string]bool{strings.ToLower(domainOf(sender(cfg, Entity{}))): true}
+
+	for d := range dkim {
+		domains[d] = true
+	}
+
+	for _, t := range transports {
+		for _, d := range t.domains {
+			domains[d] = true
+		}
+	}
+
+	return domains
+}
+
+func domainOf(addr string) string {
+	return addr[strings.LastIndex(addr, "@")+1:]
+}
+
+// transaction sends body to every rcpt on c. It mirrors smtp.SendMail,
+// but keeps going when the server refuses a recipient instead of aborting
+// the whole message, so only the error of MAIL FROM or DATA is returned.
+func transaction(c *smtp.Client, from string, rcpts []string, body []byte) ([]channel.Result, error) {
+	results := newResults(rcpts)
+
+	if err := c.Mail(from); err != nil {
+		return deferAll(results, err), err
+	}
+
+	accepted := 0
+
+	for i := range results {
+		if rErr := c.Rcpt(rcpts[i]); rErr != nil {
+			results[i].Status = classify(rErr)
+			results[i].Err = rErr
+
+			continue
+		}
+
+		accepted++
+	}
+
+	if accepted == 0 {
+		return results, nil
+	}
+
+	if err := writeData(c, body); err != nil {
+		return deferAccepted(results, err), err
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Status = channel.Delivered
+		}
+	}
+
+	return results, nil
+}
+
+func newResults(rcpts []string) []channel.Result {
+	results := make([]channel.Result, len(rcpts))
+	for i := range rcpts {
+		results[i] = channel.Result{Recipient: rcpts[i], Status: channel.Deferred}
+	}
+
+	return results
+}
+
+// sessionLost tells whether a recipient failed because the connection
+// was lost.
+func sessionLost(results []channel.Result) bool {
+	for i := range results {
+		if connLost(results[i].Err) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func delivered(results []channel.Result) bool {
+	for i := range results {
+		if results[i].Status == channel.Delivered {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeData(c *smtp.Client, body []byte) error {
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// deferAll marks every recipient deferred with the session error.
+func deferAll(results []channel.Result, err error) []channel.Result {
+	for i := range results {
+		results[i].Status = classify(err)
+		results[i].Err = err
+	}
+
+	return results
+}
+
+// deferAccepted marks the recipients accepted by RCPT TO as failed with the
+// DATA error, since the server never took the message for them.
+func deferAccepted(results []channel.Result, err error) []channel.Result {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Status = classify(err)
+			results[i].Err = err
+		}
+	}
+
+	return results
+}
+
+func (s *service) recordResult(span trace.Span, traceID string, r channel.Result) {
+	attrs := []attribute.KeyValue{
+		attribute.String("email.recipient", r.Recipient),
+		attribute.String("email.status", string(r.Status)),
+		attribute.String("email.transport", r.Via),
+	}
+
+	if r.Err != nil {
+		attrs = append(attrs, attribute.String("email.error", r.Err.Error()))
+		s.log.Warnw("recipient not delivered", "recipient", r.Recipient,
+			"status", r.Status, "transport", r.Via, "error", r.Err, "traceID", traceID)
+	} else {
+		s.log.Debugw("recipient delivered", "recipient", r.Recipient, "traceID", traceID)
+	}
+
+	span.AddEvent("email.recipient", trace.WithAttributes(attrs...))
+}
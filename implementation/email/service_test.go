@@ -1,10 +1,16 @@
 package email
 
 import (
+	"context"
 	"testing"
 
+	"notif/implementation/channel"
+	"notif/pkg/config"
+
 	// "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 func TestEmailValidation(t *testing.T) {
@@ -20,7 +26,7 @@ func TestEmailValidation(t *testing.T) {
 				FromName: "xyz",
 				ToList: []NameAddr{
 					{
-						EmailAddr: "xyz",
+						EmailAddr: "xyz@example.com",
 						UserName:  "xyz",
 					},
 				},
@@ -67,6 +73,26 @@ func TestEmailValidation(t *testing.T) {
 			shouldFail: true,
 			err:        ErrEmptyToList,
 		},
+		{
+			desc: "should return empty email address error for cc",
+			e: Entity{
+				FromName: "xyz",
+				ToList: []NameAddr{
+					{
+						EmailAddr: "xyz@example.com",
+					},
+				},
+				CcList: []NameAddr{
+					{
+						UserName: "xyz",
+					},
+				},
+				Subject: "test",
+				Body:    "its testing time !!!",
+			},
+			shouldFail: true,
+			err:        ErrEmptyAddr,
+		},
 		{
 			desc: "passing empty tolist2",
 			e: Entity{
@@ -80,6 +106,56 @@ func TestEmailValidation(t *testing.T) {
 			shouldFail: true,
 			err:        ErrEmptyAddr,
 		},
+		{
+			desc: "should reject an address injecting headers",
+			e: Entity{
+				FromName: "xyz",
+				ToList: []NameAddr{
+					{
+						EmailAddr: "a@evil.com>\r\nBcc: victim@x\r\nX-A: <b",
+					},
+				},
+				Subject: "test",
+				Body:    "its testing time !!!",
+			},
+			shouldFail: true,
+			err:        ErrInvalidAddr,
+		},
+		{
+			desc: "should reject an address with a display name in bcc",
+			e: Entity{
+				FromName: "xyz",
+				ToList: []NameAddr{
+					{
+						EmailAddr: "xyz@example.com",
+					},
+				},
+				BccList: []NameAddr{
+					{
+						EmailAddr: "Victim <victim@example.com>",
+					},
+				},
+				Subject: "test",
+				Body:    "its testing time !!!",
+			},
+			shouldFail: true,
+			err:        ErrInvalidAddr,
+		},
+		{
+			desc: "should reject an invalid address",
+			e: Entity{
+				FromName: "xyz",
+				ToList: []NameAddr{
+					{
+						EmailAddr: "xyz",
+					},
+				},
+				Subject: "test",
+				Body:    "its testing time !!!",
+			},
+			shouldFail: true,
+			err:        ErrInvalidAddr,
+		},
 	}
 
 	for i := range testCases {
@@ -93,3 +169,46 @@ func TestEmailValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestSendEmailPerRecipient(t *testing.T) {
+	srv := newFakeSMTP(t)
+	host, port := srv.hostPort()
+
+	svc, err := NewEmailService(zap.NewNop().Sugar(), &config.NotifConfig{
+		EmailSmtpHost:     host,
+		EmailSmtpPORT:     port,
+		EmailSmtpUserName: "notif@example.com",
+	}, nil, trace.NewNoopTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := Entity{
+		FromName: "notif",
+		ToList:   []NameAddr{{EmailAddr: "a@example.com"}, {EmailAddr: "reject@example.com"}},
+		CcList:   []NameAddr{{EmailAddr: "defer@example.com"}},
+		BccList:  []NameAddr{{EmailAddr: "b@example.com"}},
+		Body:     "hello",
+	}
+
+	err = svc.SendEmail(context.Background(), e)
+
+	var dErr *channel.DeliveryError
+	require.ErrorAs(t, err, &dErr)
+	require.Equal(t, []string{"a@example.com", "b@example.com"}, srv.accepted())
+	require.Equal(t, []string{"defer@example.com"}, dErr.Deferred())
+
+	statuses := make(map[string]channel.DeliveryStatus)
+	for _, r := range dErr.Results {
+		statuses[r.Recipient] = r.Status
+	}
+
+	require.Equal(t, map[string]channel.DeliveryStatus{
+		"a@example.com":      channel.Delivered,
+		"reject@example.com": channel.Rejected,
+		"defer@example.com":  channel.Deferred,
+		"b@example.com":      channel.Delivered,
+	}, statuses)
+
+	retry := e.withEnvelope(dErr.Deferred())
+	require.Equal(t, []string{"defer@example.com"}, retry.Recipients())
+	require.Len(t, retry.ToList, 2, "headers keep the original to list")
+}
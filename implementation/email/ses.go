@@ -0,0 +1,197 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sesService is the service name requests to SES are signed for.
+const sesService = "ses"
+
+// Credentials are the aws credentials SES requests are signed with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials.
+	SessionToken string
+}
+
+type ses struct {
+	baseURL string
+	region  string
+	creds   Credentials
+	client  *http.Client
+}
+
+// NewSESProvider returns a provider for the SES v2 api of region, or any
+// api mimicking it at baseURL. The regional endpoint is used when baseURL
+// is empty.
+func NewSESProvider(baseURL, region string, creds Credentials, client *http.Client) APIProvider {
+	if baseURL == "" {
+		baseURL = "https://email." + region + ".amazonaws.com"
+	}
+
+	return &ses{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		region:  region,
+		creds:   creds,
+		client:  client,
+	}
+}
+
+func (s *ses) Name() string {
+	return SES
+}
+
+type sesDestination struct {
+	ToAddresses  []string `json:"ToAddresses,omitempty"`
+	CcAddresses  []string `json:"CcAddresses,omitempty"`
+	BccAddresses []string `json:"BccAddresses,omitempty"`
+}
+
+type sesRequest struct {
+	FromEmailAddress string         `json:"FromEmailAddress"`
+	Destination      sesDestination `json:"Destination"`
+	Content          struct {
+		Raw struct {
+			Data []byte `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+type sesResponse struct {
+	MessageID string `json:"MessageId"`
+	Message   string `json:"message"`
+}
+
+func emails(addrs []mail.Address) []string {
+	list := make([]string, len(addrs))
+	for i := range addrs {
+		list[i] = addrs[i].Address
+	}
+
+	return list
+}
+
+// Send posts the raw MIME message, the destination lists the bcc
+// addresses since they are not in its headers.
+func (s *ses) Send(ctx context.Context, m *Mail) (string, error) {
+	var body sesRequest
+
+	body.FromEmailAddress = m.From.Address
+	body.Destination = sesDestination{
+		ToAddresses:  emails(m.To),
+		CcAddresses:  emails(m.Cc),
+		BccAddresses: emails(m.Bcc),
+	}
+	body.Content.Raw.Data = m.Raw
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, payload, s.region, sesService, s.creds, time.Now())
+
+	resp, data, err := do(s.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var res sesResponse
+	_ = json.Unmarshal(data, &res)
+
+	if success(resp) {
+		return res.MessageID, nil
+	}
+
+	// the error type may be suffixed with a ':' and the doc url
+	code := strings.SplitN(resp.Header.Get("X-Amzn-Errortype"), ":", 2)[0]
+
+	return "", newProviderError(resp, code, res.Message)
+}
+
+// signV4 signs req with aws signature version 4. Only the host, date,
+// content type and session token headers are signed.
+func signV4(req *http.Request, payload []byte, region, service string, creds Credentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for _, h := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(h); v != "" {
+			headers[strings.ToLower(h)] = strings.TrimSpace(v)
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(payload),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
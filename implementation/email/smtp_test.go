@@ -0,0 +1,277 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is a minimal smtp server for tests. Recipients starting with
+// "reject" get a 550 and the ones starting with "defer" get a 450.
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	rcpts []string
+	data  []string
+	conns int
+	rsets int
+	// closeMail is the number of MAIL commands answered with a 421
+	// before the connection is closed.
+	closeMail int
+	// closeRset answers RSET with a 421 and closes the connection.
+	closeRset bool
+	// deferRcpts answers every RCPT with a 451.
+	deferRcpts bool
+	// authMechs are advertised with AUTH, authed holds the mechanism
+	// and credentials of every successful AUTH.
+	authMechs string
+	authed    []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+
+	return newFakeSMTPWithTLS(t, nil)
+}
+
+// newFakeSMTPWithTLS listens over tls right away when cfg is set.
+func newFakeSMTPWithTLS(t *testing.T, cfg *tls.Config) *fakeSMTP {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
+
+	f := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeSMTP) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+	return host, port
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.conns++
+	f.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO", "HELO":
+			if mechs := f.mechs(); mechs != "" {
+				_ = tp.PrintfLine("250-fake")
+				_ = tp.PrintfLine("250 AUTH %s", mechs)
+
+				continue
+			}
+
+			_ = tp.PrintfLine("250 fake")
+
+		case "AUTH":
+			if !f.auth(tp, strings.Fields(line)[1:]) {
+				_ = tp.PrintfLine("535 authentication failed")
+				continue
+			}
+
+			_ = tp.PrintfLine("235 authenticated")
+
+		case "MAIL", "RSET":
+			if f.closing(cmd) {
+				_ = tp.PrintfLine("421 closing connection")
+				return
+			}
+
+			_ = tp.PrintfLine("250 ok")
+
+		case "NOOP":
+			_ = tp.PrintfLine("250 ok")
+
+		case "RCPT":
+			addr := strings.Trim(line[strings.Index(line, ":")+1:], "<> ")
+
+			f.mu.Lock()
+			deferRcpts := f.deferRcpts
+			f.mu.Unlock()
+
+			switch {
+			case deferRcpts:
+				_ = tp.PrintfLine("451 try again later")
+			case strings.HasPrefix(addr, "reject"):
+				_ = tp.PrintfLine("550 no such user")
+			case strings.HasPrefix(addr, "defer"):
+				_ = tp.PrintfLine("450 mailbox busy")
+			default:
+				f.mu.Lock()
+				f.rcpts = append(f.rcpts, addr)
+				f.mu.Unlock()
+
+				_ = tp.PrintfLine("250 ok")
+			}
+
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+
+			body, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			f.mu.Lock()
+			f.data = append(f.data, string(body))
+			f.mu.Unlock()
+
+			_ = tp.PrintfLine("250 queued")
+
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) mechs() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.authMechs
+}
+
+// auth runs the exchange of the mechanism in args with "user" and
+// "secret" as the only valid credentials, or "token" as access token.
+func (f *fakeSMTP) auth(tp *textproto.Conn, args []string) bool {
+	challenge := func(c string) string {
+		_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(c)))
+		line, _ := tp.ReadLine()
+		resp, _ := base64.StdEncoding.DecodeString(line)
+
+		return string(resp)
+	}
+
+	initial := func() string {
+		if len(args) > 1 {
+			resp, _ := base64.StdEncoding.DecodeString(args[1])
+			return string(resp)
+		}
+
+		return challenge("")
+	}
+
+	var creds string
+
+	switch args[0] {
+	case "PLAIN":
+		creds = initial()
+		if creds != "\x00user\x00secret" {
+			return false
+		}
+
+	case "LOGIN":
+		creds = challenge("Username:") + ":" + challenge("Password:")
+		if creds != "user:secret" {
+			return false
+		}
+
+	case "CRAM-MD5":
+		nonce := "<1896.697170952@fake>"
+		mac := hmac.New(md5.New, []byte("secret"))
+		mac.Write([]byte(nonce))
+
+		creds = challenge(nonce)
+		if creds != "user "+hex.EncodeToString(mac.Sum(nil)) {
+			return false
+		}
+
+	case "XOAUTH2":
+		creds = initial()
+		if creds != "user=user\x01auth=Bearer token\x01\x01" {
+			// the error challenge is answered by an empty response
+			challenge(`{"status":"401","schemes":"bearer"}`)
+			return false
+		}
+
+	default:
+		return false
+	}
+
+	f.mu.Lock()
+	f.authed = append(f.authed, args[0]+" "+creds)
+	f.mu.Unlock()
+
+	return true
+}
+
+// closing tells whether cmd is answered with a 421.
+func (f *fakeSMTP) closing(cmd string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cmd == "RSET" {
+		f.rsets++
+		return f.closeRset
+	}
+
+	if f.closeMail > 0 {
+		f.closeMail--
+		return true
+	}
+
+	return false
+}
+
+func (f *fakeSMTP) stats() (conns, rsets int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.conns, f.rsets
+}
+
+func (f *fakeSMTP) accepted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.rcpts...)
+}
@@ -0,0 +1,63 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+
+	"notif/implementation/channel"
+)
+
+var ErrSuppressed = errors.New("recipient is suppressed after a hard bounce or a complaint")
+
+// Suppressions tells which addresses email must not be sent to anymore.
+type Suppressions interface {
+	// Suppressed returns the suppressed addresses of addrs.
+	Suppressed(ctx context.Context, addrs []string) (map[string]bool, error)
+}
+
+// suppress splits rcpts in the ones to send to and the results of the
+// suppressed ones, which are rejected. Nothing is suppressed without a
+// list.
+func suppress(ctx context.Context, list Suppressions, rcpts []string) ([]string, []channel.Result, error) {
+	if list == nil {
+		return rcpts, nil, nil
+	}
+
+	suppressed, err := list.Suppressed(ctx, rcpts)
+	if err != nil || len(suppressed) == 0 {
+		return rcpts, nil, err
+	}
+
+	left := make([]string, 0, len(rcpts))
+	rejected := make([]channel.Result, 0, len(suppressed))
+
+	for i := range rcpts {
+		if !suppressed[rcpts[i]] {
+			left = append(left, rcpts[i])
+			continue
+		}
+
+		rejected = append(rejected, channel.Result{Recipient: rcpts[i], Status: channel.Rejected, Err: ErrSuppressed})
+	}
+
+	return left, rejected, nil
+}
+
+// without returns the addresses of addrs sent to, the ones of left.
+func without(addrs []mail.Address, left []string) []mail.Address {
+	keep := make(map[string]bool, len(left))
+	for i := range left {
+		keep[left[i]] = true
+	}
+
+	kept := make([]mail.Address, 0, len(addrs))
+
+	for i := range addrs {
+		if keep[addrs[i].Address] {
+			kept = append(kept, addrs[i])
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,300 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/pkg/config"
+)
+
+// defaultTransport names the transport of the EMAIL_SMTP_* relay when
+// EMAIL_SMTP_TRANSPORTS is not set.
+const defaultTransport = "default"
+
+var (
+	ErrNoTransport           = errors.New("no smtp transport routes the sender domain")
+	ErrTransportsUnavailable = errors.New("every smtp transport of the sender domain is unavailable")
+	ErrInvalidTransports     = errors.New("invalid EMAIL_SMTP_TRANSPORTS")
+)
+
+// TransportConfig is one named relay of EMAIL_SMTP_TRANSPORTS.
+type TransportConfig struct {
+	Name               string `json:"name"`
+	Host               string `json:"host"`
+	Port               string `json:"port"`
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	TLS                string `json:"tls"`
+	CAFile             string `json:"caFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	Auth               string `json:"auth"`
+	OAuthTokenURL      string `json:"oauthTokenUrl"`
+	OAuthClientID      string `json:"oauthClientId"`
+	OAuthClientSecret  string `json:"oauthClientSecret"`
+	OAuthRefreshToken  string `json:"oauthRefreshToken"`
+	PoolSize           int    `json:"poolSize"`
+	// Weight is the share of the mails routed to the transport, 1 when it
+	// is not set. Transports of weight 0 are only tried once the weighted
+	// ones failed.
+	Weight *int `json:"weight"`
+	// Domains restricts the transport to the mails sent from these
+	// domains, a transport without domains takes the other ones.
+	Domains []string `json:"domains"`
+}
+
+// relay returns the relay of t, with the EMAIL_SMTP_* defaults of the
+// fields it does not set.
+func (t TransportConfig) relay(cfg *config.NotifConfig) Relay {
+	r := Relay{
+		Host:               t.Host,
+		Port:               t.Port,
+		Username:           t.Username,
+		Password:           t.Password,
+		TLS:                t.TLS,
+		CAFile:             t.CAFile,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		Auth:               t.Auth,
+		TokenSource:        StaticTokenSource(t.Password),
+		PoolSize:           t.PoolSize,
+	}
+
+	if r.Port == "" {
+		r.Port = "587"
+	}
+
+	if r.PoolSize == 0 {
+		r.PoolSize = cfg.EmailSmtpPoolSize
+	}
+
+	if t.OAuthTokenURL != "" {
+		r.TokenSource = NewRefreshTokenSource(t.OAuthTokenURL, t.OAuthClientID,
+			t.OAuthClientSecret, t.OAuthRefreshToken, &http.Client{Timeout: config.SmtpDialTimeOut})
+	}
+
+	return r
+}
+
+// transport is a named relay with its pool and circuit breaker.
+type transport struct {
+	name    string
+	weight  int
+	domains []string
+	pool    *pool
+	breaker *breaker
+}
+
+// newTransports returns the transports of EMAIL_SMTP_TRANSPORTS, or the
+// single EMAIL_SMTP_* relay when it is not set.
+func newTransports(cfg *config.NotifConfig) ([]*transport, error) {
+	if cfg.EmailSmtpTransports == "" {
+		p, err := newPool(relayFromConfig(cfg))
+		if err != nil {
+			return nil, err
+		}
+
+		return []*transport{{name: defaultTransport, weight: 1, pool: p, breaker: &breaker{}}}, nil
+	}
+
+	var tcs []TransportConfig
+	if err := json.Unmarshal([]byte(cfg.EmailSmtpTransports), &tcs); err != nil {
+		return nil, err
+	}
+
+	if len(tcs) == 0 {
+		return nil, ErrInvalidTransports
+	}
+
+	names := make(map[string]bool, len(tcs))
+	transports := make([]*transport, len(tcs))
+
+	for i := range tcs {
+		tc := tcs[i]
+		if tc.Name == "" || tc.Host == "" || names[tc.Name] || tc.Weight != nil && *tc.Weight < 0 {
+			return nil, ErrInvalidTransports
+		}
+
+		names[tc.Name] = true
+
+		p, err := newPool(tc.relay(cfg))
+		if err != nil {
+			return nil, err
+		}
+
+		t := &transport{name: tc.Name, weight: 1, pool: p, breaker: &breaker{}}
+		if tc.Weight != nil {
+			t.weight = *tc.Weight
+		}
+
+		for _, d := range tc.Domains {
+			t.domains = append(t.domains, strings.ToLower(d))
+		}
+
+		transports[i] = t
+	}
+
+	return transports, nil
+}
+
+func (t *transport) routes(domain string) bool {
+	for _, d := range t.domains {
+		if d == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send delivers body to every rcpt in a single mail transaction on a
+// pooled connection and returns the result per recipient with the error
+// failing the whole transaction, if any. When the connection is lost
+// before the message was accepted, the transaction is done again once on
+// a new connection.
+func (t *transport) send(ctx context.Context, from string, rcpts []string, body []byte) ([]channel.Result, error) {
+	var (
+		results []channel.Result
+		err     error
+	)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		c, gErr := t.pool.get(ctx)
+		if gErr != nil {
+			return deferAll(newResults(rcpts), gErr), gErr
+		}
+
+		results, err = transaction(c.client, from, rcpts, body)
+
+		lost := sessionLost(results)
+		t.pool.put(c, lost)
+
+		if !lost || delivered(results) {
+			break
+		}
+	}
+
+	for i := range results {
+		results[i].Via = t.name
+	}
+
+	return results, err
+}
+
+// healthy tells whether the relay worked during a send, which failed
+// neither on the connection nor with a transient session reply.
+func healthy(results []channel.Result, err error) bool {
+	return !sessionLost(results) && (err == nil || classify(err) == channel.Rejected)
+}
+
+// route returns the transports to try in turn for a mail sent from
+// domain. The transports of the domain are picked if any, the ones
+// without domains otherwise. They are ordered by a weighted draw, the
+// backup transports of weight 0 last, and the ones whose circuit is open
+// are left out.
+func route(transports []*transport, domain string) ([]*transport, error) {
+	domain = strings.ToLower(domain)
+
+	var candidates []*transport
+
+	for _, t := range transports {
+		if t.routes(domain) {
+			candidates = append(candidates, t)
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, t := range transports {
+			if len(t.domains) == 0 {
+				candidates = append(candidates, t)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoTransport
+	}
+
+	var weighted, backups []*transport
+
+	for _, t := range candidates {
+		switch {
+		case !t.breaker.allow():
+		case t.weight > 0:
+			weighted = append(weighted, t)
+		default:
+			backups = append(backups, t)
+		}
+	}
+
+	if len(weighted)+len(backups) == 0 {
+		return nil, ErrTransportsUnavailable
+	}
+
+	return append(weightedOrder(weighted), backups...), nil
+}
+
+// weightedOrder draws the transports one after another with a chance
+// proportional to their weight.
+func weightedOrder(transports []*transport) []*transport {
+	left := append([]*transport(nil), transports...)
+	ordered := make([]*transport, 0, len(left))
+
+	for len(left) > 0 {
+		total := 0
+		for _, t := range left {
+			total += t.weight
+		}
+
+		// nolint:gosec // the draw only spreads the load, it needs no crypto randomness
+		n := rand.Intn(total)
+
+		i := 0
+		for ; n >= left[i].weight; i++ {
+			n -= left[i].weight
+		}
+
+		ordered = append(ordered, left[i])
+		left = append(left[:i], left[i+1:]...)
+	}
+
+	return ordered
+}
+
+// breaker stops routing to a transport for SmtpBreakerCooldown once
+// SmtpBreakerThreshold sends in a row failed on it. After the cooldown
+// the transport is tried again and a single failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.failures = 0
+		b.openUntil = time.Time{}
+
+		return
+	}
+
+	b.failures++
+	if b.failures >= config.SmtpBreakerThreshold {
+		b.openUntil = time.Now().Add(config.SmtpBreakerCooldown)
+	}
+}
@@ -0,0 +1,187 @@
+package email
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T, transports string) *service {
+	t.Helper()
+
+	svc, err := NewEmailService(zap.NewNop().Sugar(), &config.NotifConfig{
+		EmailSmtpUserName:   "notif@example.com",
+		EmailSmtpTransports: transports,
+	}, nil, trace.NewNoopTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	return svc.(*service)
+}
+
+func transportJSON(name string, srv *fakeSMTP, extra string) string {
+	host, port := srv.hostPort()
+	return `{"name":"` + name + `","host":"` + host + `","port":"` + port + `"` + extra + `}`
+}
+
+// closedAddr returns the address of a port nothing listens on.
+func closedAddr(t *testing.T) (string, string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	return host, port
+}
+
+func TestNewTransports(t *testing.T) {
+	cfg := &config.NotifConfig{EmailSmtpPoolSize: 2, EmailSmtpTransports: `[
+		{"name":"primary","host":"smtp.example.com","weight":3,"domains":["Example.com"]},
+		{"name":"backup","host":"backup.example.com","port":"2525","weight":0}
+	]`}
+
+	transports, err := newTransports(cfg)
+	require.NoError(t, err)
+	require.Len(t, transports, 2)
+
+	require.Equal(t, 3, transports[0].weight)
+	require.Equal(t, []string{"example.com"}, transports[0].domains)
+	require.Equal(t, "587", transports[0].pool.relay.Port)
+	require.Equal(t, 2, transports[0].pool.relay.PoolSize)
+	require.Equal(t, 0, transports[1].weight)
+	require.Equal(t, "2525", transports[1].pool.relay.Port)
+
+	for _, invalid := range []string{
+		`[]`,
+		`[{"host":"smtp.example.com"}]`,
+		`[{"name":"a","host":"a.example.com"},{"name":"a","host":"b.example.com"}]`,
+		`[{"name":"a","host":"a.example.com","weight":-1}]`,
+	} {
+		_, err = newTransports(&config.NotifConfig{EmailSmtpTransports: invalid})
+		require.ErrorIs(t, err, ErrInvalidTransports, invalid)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	newTransport := func(name string, weight int, domains ...string) *transport {
+		return &transport{name: name, weight: weight, domains: domains, breaker: &breaker{}}
+	}
+
+	marketing := newTransport("marketing", 1, "news.example.com")
+	main := newTransport("main", 1)
+	backup := newTransport("backup", 0)
+	transports := []*transport{marketing, main, backup}
+
+	routed, err := route(transports, "News.Example.com")
+	require.NoError(t, err)
+	require.Equal(t, []*transport{marketing}, routed)
+
+	routed, err = route(transports, "example.com")
+	require.NoError(t, err)
+	require.Equal(t, []*transport{main, backup}, routed, "backups are tried last")
+
+	_, err = route([]*transport{marketing}, "example.com")
+	require.ErrorIs(t, err, ErrNoTransport)
+
+	for i := 0; i < config.SmtpBreakerThreshold; i++ {
+		marketing.breaker.record(false)
+	}
+
+	_, err = route(transports, "news.example.com")
+	require.ErrorIs(t, err, ErrTransportsUnavailable)
+
+	marketing.breaker.record(true)
+	require.True(t, marketing.breaker.allow())
+}
+
+func TestSendsFrom(t *testing.T) {
+	s := newTestService(t, `[
+		{"name":"main","host":"127.0.0.1","port":"25"},
+		{"name":"marketing","host":"127.0.0.1","port":"25","domains":["News.example.com"]}
+	]`)
+
+	require.True(t, s.SendsFrom("ops@example.com"), "the domain of the default sender")
+	require.True(t, s.SendsFrom("deals@news.example.com"))
+	require.False(t, s.SendsFrom("ceo@bank.example"))
+
+	ch := NewChannel(s, nil)
+	e := Entity{FromName: "notif", FromAddr: "ceo@bank.example", ToList: []NameAddr{{EmailAddr: "a@example.com"}}, Body: "hi"}
+	require.ErrorIs(t, ch.Validate(e).(pkg.NotifErr).Err, ErrSenderDomain)
+
+	e.FromAddr = "deals@news.example.com"
+	require.NoError(t, ch.Validate(e))
+
+	api, err := NewAPIService(zap.NewNop().Sugar(), &config.NotifConfig{
+		EmailFrom:     "notif@example.com",
+		EmailDkimKeys: `[{"domain":"mail.example.com","selector":"s1","key":"nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="}]`,
+	}, nil, nil, trace.NewNoopTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	require.True(t, api.SendsFrom("a@mail.example.com"), "the domain of a dkim key")
+	require.False(t, api.SendsFrom("a@news.example.com"))
+}
+
+func TestWeightedOrder(t *testing.T) {
+	heavy := &transport{name: "heavy", weight: 9}
+	light := &transport{name: "light", weight: 1}
+
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ordered := weightedOrder([]*transport{light, heavy})
+		require.Len(t, ordered, 2)
+		first[ordered[0].name]++
+	}
+
+	require.Greater(t, first["heavy"], 800)
+	require.Greater(t, first["light"], 40)
+}
+
+func TestSendFailsOver(t *testing.T) {
+	srv := newFakeSMTP(t)
+	host, port := closedAddr(t)
+
+	// the dead relay is tried first and the live one takes over
+	s := newTestService(t, `[
+		{"name":"dead","host":"`+host+`","port":"`+port+`","weight":1000000},
+		`+transportJSON("live", srv, `,"weight":1`)+`
+	]`)
+
+	for i := 0; i < config.SmtpBreakerThreshold; i++ {
+		results := s.send(context.Background(), "notif@example.com", []string{"a@example.com"}, []byte("hello\r\n"))
+		require.Equal(t, channel.Delivered, results[0].Status)
+		require.Equal(t, "live", results[0].Via)
+	}
+
+	require.False(t, s.transports[0].breaker.allow(), "the circuit of the dead relay is open")
+
+	routed, err := route(s.transports, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routed, 1)
+	require.Equal(t, "live", routed[0].name)
+}
+
+func TestSendFailsOverDeferredRecipients(t *testing.T) {
+	busy := newFakeSMTP(t)
+	busy.deferRcpts = true
+	srv := newFakeSMTP(t)
+
+	s := newTestService(t, "["+transportJSON("busy", busy, "")+","+transportJSON("backup", srv, `,"weight":0`)+"]")
+
+	results := s.send(context.Background(), "notif@example.com",
+		[]string{"a@example.com", "reject@example.com"}, []byte("hello\r\n"))
+
+	require.Equal(t, channel.Delivered, results[0].Status)
+	require.Equal(t, "backup", results[0].Via)
+	require.Equal(t, channel.Rejected, results[1].Status)
+	require.Equal(t, []string{"a@example.com"}, srv.accepted())
+	require.True(t, s.transports[0].breaker.allow(), "refused recipients do not open the circuit")
+}
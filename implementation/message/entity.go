@@ -0,0 +1,72 @@
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxKeyLen bounds the length of an idempotency key.
+const maxKeyLen = 255
+
+var ErrInvalidKey = errors.New("idempotency key must be 1 to 255 printable ascii characters")
+var ErrTooLarge = errors.New("notification is larger than the maximum nats payload")
+
+// Notification is a notification to publish to its channel.
+type Notification struct {
+	// ID is generated when empty, or derived from Key when given.
+	ID string
+	// Key is the idempotency key of the notification, the requests sent
+	// again with it within the duplicate window are not sent twice.
+	Key     string
+	Channel string
+	Body    interface{}
+	// SendAt holds the notification till then when it is ahead.
+	SendAt time.Time
+	// Tenant gets the status changes of the notification pushed to its
+	// callback, unless CallbackURL is given.
+	Tenant      string
+	CallbackURL string
+}
+
+// Receipt tells the id of a published notification along with its
+// pubAck, or when it is held, the time it is due at instead.
+type Receipt struct {
+	ID     string     `json:"id"`
+	SendAt *time.Time `json:"sendAt,omitempty"`
+	*nats.PubAck
+}
+
+// Result is the receipt of a notification of a batch, or the error it
+// failed with.
+type Result struct {
+	*Receipt
+	Err error
+}
+
+// scopedKey returns the idempotency key of n within its tenant and its
+// channel, so the same key given by two tenants, or for two channels,
+// does not name the same notification.
+func scopedKey(n Notification) string {
+	return n.Tenant + "/" + n.Channel + "/" + n.Key
+}
+
+// keyID returns the notification id of the idempotency key, so the
+// requests sent again with it are answered with the same id.
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:11])
+}
+
+// ValidKey tells whether key fits a nats header.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > maxKeyLen {
+		return false
+	}
+
+	return strings.IndexFunc(key, func(r rune) bool { return r < '!' || r > '~' }) < 0
+}
@@ -7,27 +7,57 @@ import (
 	"fmt"
 
 	"net/http"
+	"notif/implementation/callback"
+	"notif/implementation/channel"
+	"notif/implementation/deadletter"
 	"notif/implementation/email"
+	"notif/implementation/schedule"
+	"notif/implementation/status"
+	"notif/implementation/webhook"
 	"notif/pkg"
 	"notif/pkg/config"
+	natshelper "notif/pkg/nats"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/avast/retry-go"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// IDHeader carries the id of the notification of a msg.
+const IDHeader = "Notif-Id"
+
 type Service interface {
-	SendEmailRequest(ctx context.Context, e email.Entity) (*nats.PubAck, error)
-	RecvEmailRequest(ctx context.Context, wg *sync.WaitGroup)
+	// SendRequest publishes the notification n, or holds it till its
+	// SendAt when that is ahead.
+	SendRequest(ctx context.Context, n Notification) (*Receipt, error)
+	// SendBatch publishes the notifications ns without waiting for each
+	// pubAck in turn, the result of every one is at its index.
+	SendBatch(ctx context.Context, ns []Notification) []Result
+	// RecvRequest consumes the notifications of every channel till ctx is done.
+	RecvRequest(ctx context.Context, wg *sync.WaitGroup)
+	// Notify pushes the status r moved to outside of a delivery, like a
+	// bounce, to its callback.
+	Notify(ctx context.Context, r status.Record)
 }
 
 type messageSvc struct {
 	js          nats.JetStreamContext
-	emailSvc    email.Service
+	channels    *channel.Registry
+	deadLetters deadletter.Service
+	schedules   schedule.Service
+	statuses    status.Service
+	callbacks   callback.Service
+	concurrency int
 	log         *zap.SugaredLogger
 	tracer      trace.Tracer
 	propagators propagation.TextMapPropagator
@@ -35,26 +65,177 @@ type messageSvc struct {
 
 func NewMessageService(
 	l *zap.SugaredLogger, jetStream nats.JetStreamContext,
-	e email.Service, t trace.Tracer, p propagation.TextMapPropagator) Service {
+	channels *channel.Registry, deadLetters deadletter.Service, schedules schedule.Service,
+	statuses status.Service, callbacks callback.Service, concurrency int, t trace.Tracer,
+	p propagation.TextMapPropagator) Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
 	return &messageSvc{
 		log:         l,
 		js:          jetStream,
-		emailSvc:    e,
+		channels:    channels,
+		deadLetters: deadLetters,
+		schedules:   schedules,
+		statuses:    statuses,
+		callbacks:   callbacks,
+		concurrency: concurrency,
 		tracer:      t,
 		propagators: p,
 	}
 }
 
-func (s *messageSvc) SendEmailRequest(ctx context.Context, e email.Entity) (*nats.PubAck, error) {
+func (s *messageSvc) SendRequest(ctx context.Context, n Notification) (*Receipt, error) {
 	// starting span for publishing the msg
 	spanCtx, span := s.tracer.Start(ctx, "message.svc-publish")
 	defer span.End()
 
+	out, err := s.prepare(spanCtx, span, n)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("notif.id", out.id))
+
+	if out.receipt != nil {
+		return out.receipt, nil
+	}
+
+	// publishing the msg
+	pub, err := s.js.PublishMsg(out.msg)
+	if err != nil {
+		s.publishFailed(spanCtx, span, out, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Bool("notif.replay", pub.Duplicate))
+
+	return &Receipt{ID: out.id, PubAck: pub}, nil
+}
+
+func (s *messageSvc) SendBatch(ctx context.Context, ns []Notification) []Result {
+	// starting span for publishing the msgs
+	spanCtx, span := s.tracer.Start(ctx, "message.svc-publish-batch")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("notif.batch_size", len(ns)))
+
+	// the batch answers before the server gives up writing its response,
+	// the notifications left are reported failed
+	batchCtx, cancel := context.WithTimeout(spanCtx, config.BatchTimeOut)
+	defer cancel()
+
+	results := make([]Result, len(ns))
+	outs := make([]*outgoing, len(ns))
+	futures := make([]nats.PubAckFuture, len(ns))
+
+	// the statuses are recorded by BatchConcurrency workers at once and
+	// every msg is published once its status is, without waiting for the
+	// pubAck of the previous ones
+	slots := make(chan struct{}, config.BatchConcurrency)
+	prepared := sync.WaitGroup{}
+
+	for i := range ns {
+		slots <- struct{}{}
+
+		prepared.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-slots
+				prepared.Done()
+			}()
+
+			if err := batchCtx.Err(); err != nil {
+				results[i].Err = err
+				return
+			}
+
+			out, err := s.prepare(batchCtx, span, ns[i])
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+
+			if out.receipt != nil {
+				results[i].Receipt = out.receipt
+				return
+			}
+
+			if futures[i], err = s.js.PublishMsgAsync(out.msg); err != nil {
+				s.publishFailed(spanCtx, span, out, err)
+				results[i].Err = err
+
+				return
+			}
+
+			outs[i] = out
+		}(i)
+	}
+
+	prepared.Wait()
+
+	for i := range futures {
+		if outs[i] == nil {
+			continue
+		}
+
+		select {
+		case pub := <-futures[i].Ok():
+			results[i].Receipt = &Receipt{ID: outs[i].id, PubAck: pub}
+
+		case err := <-futures[i].Err():
+			s.publishFailed(spanCtx, span, outs[i], err)
+			results[i].Err = err
+
+		// async publishes have no timeout of their own
+		case <-batchCtx.Done():
+			// the msg may be stored still, its status tells
+			results[i].Err = batchCtx.Err()
+		}
+	}
+
+	return results
+}
+
+// outgoing is a notification ready to publish.
+type outgoing struct {
+	id  string
+	msg *nats.Msg
+	// replay tells the notification was sent before with its key
+	replay bool
+	// receipt is set when the notification is not to publish, as it was
+	// held or its replay was
+	receipt *Receipt
+}
+
+// prepare records the status of n and returns its msg to publish, a
+// notification due later is held here.
+func (s *messageSvc) prepare(ctx context.Context, span trace.Span, n Notification) (*outgoing, error) {
 	// extracting traceID for logging purpose
 	traceID := span.SpanContext().TraceID().String()
 
-	// marshalling email struct to send as msg data
-	eBytes, err := json.Marshal(e)
+	if n.Key != "" {
+		if !ValidKey(n.Key) {
+			err := pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  ErrInvalidKey,
+			}
+			s.errLogWithSpanAttributes("invalid idempotency key", traceID, err, span)
+
+			return nil, err
+		}
+
+		n.ID = keyID(scopedKey(n))
+	}
+
+	if n.ID == "" {
+		n.ID = nuid.Next()
+	}
+
+	// marshalling notification to send as msg data
+	eBytes, err := json.Marshal(n.Body)
 	if err != nil {
 		s.errLogWithSpanAttributes("marshiling failed", traceID, err, span)
 
@@ -67,32 +248,167 @@ func (s *messageSvc) SendEmailRequest(ctx context.Context, e email.Entity) (*nat
 	// prepare nats msg with data and headers and
 	// injecting the current traceID into the msg headers
 	header := make(nats.Header)
-	s.propagators.Inject(spanCtx, propagation.HeaderCarrier(header))
-	m := &nats.Msg{
-		Subject: fmt.Sprintf("%s.send", config.StreamName),
-		Header:  header,
-		Data:    eBytes,
-	}
+	header.Set(IDHeader, n.ID)
+	s.propagators.Inject(ctx, propagation.HeaderCarrier(header))
+
+	// the server refuses the msgs larger than its max_payload, the msg
+	// id header set later is accounted for
+	if payloadSize(header, eBytes)+int64(len(nats.MsgIdHdr)+len(n.ID)+4) > config.NatsMaxPayload {
+		err = pkg.NotifErr{
+			Code: http.StatusRequestEntityTooLarge,
+			Err:  ErrTooLarge,
+		}
+		s.errLogWithSpanAttributes("notification too large", traceID, err, span)
 
-	// publishing the msg
-	pub, err := s.js.PublishMsg(m)
-	if err != nil {
-		s.errLogWithSpanAttributes("publishing failed", traceID, err, span)
 		return nil, err
 	}
 
-	return pub, nil
+	out := &outgoing{
+		id: n.ID,
+		msg: &nats.Msg{
+			Subject: channel.Subject(n.Channel),
+			Header:  header,
+			Data:    eBytes,
+		},
+	}
+
+	held := n.SendAt.After(time.Now())
+
+	// a request sent again with its idempotency key keeps the status of
+	// the first one, a held notification is answered with its due time
+	// while jetstream answers a published one with its original pubAck
+	if n.Key != "" {
+		r, err := s.statuses.Get(ctx, n.ID)
+		if err == nil && r.SendAt != nil {
+			span.SetAttributes(attribute.Bool("notif.replay", true))
+
+			out.receipt = &Receipt{ID: n.ID, SendAt: r.SendAt}
+
+			return out, nil
+		}
+
+		out.replay = err == nil
+	}
+
+	// the status is recorded first so a worker never finds it missing
+	if !out.replay {
+		if err = s.statuses.Create(ctx, s.newRecord(n, held)); err != nil {
+			s.errLogWithSpanAttributes("recording status failed", traceID, err, span)
+			return nil, err
+		}
+	}
+
+	// notifications due later are held till then
+	if held {
+		e, err := s.schedules.Hold(ctx, n.ID, out.msg, n.SendAt)
+		if err != nil {
+			s.errLogWithSpanAttributes("holding failed", traceID, err, span)
+			s.track(ctx, n.ID, 0, status.Failed, err, nil)
+
+			return nil, err
+		}
+
+		out.receipt = &Receipt{ID: n.ID, SendAt: &e.SendAt}
+
+		return out, nil
+	}
+
+	// jetstream drops the msgs of a key it got within its duplicate
+	// window, held msgs are left without so a reschedule is not dropped.
+	// The id is derived from the scoped key, so the msgs of the same key
+	// given by two tenants or for two channels are both kept
+	if n.Key != "" {
+		out.msg.Header.Set(nats.MsgIdHdr, n.ID)
+	}
+
+	return out, nil
+}
+
+// payloadSize is the size of a msg of header and data on the wire.
+func payloadSize(header nats.Header, data []byte) int64 {
+	// the NATS/1.0 line and the blank line ending the headers
+	size := int64(len("NATS/1.0\r\n\r\n") + len(data))
+
+	for k, vs := range header {
+		for i := range vs {
+			size += int64(len(k) + len(vs[i]) + 4)
+		}
+	}
+
+	return size
+}
+
+// publishFailed records that out could not be published.
+func (s *messageSvc) publishFailed(ctx context.Context, span trace.Span, out *outgoing, err error) {
+	s.errLogWithSpanAttributes("publishing failed", span.SpanContext().TraceID().String(), err, span)
+
+	// the status of a replay is the one of the msg published first
+	if !out.replay {
+		s.track(ctx, out.id, 0, status.Failed, err, nil)
+	}
+}
+
+// newRecord returns the status of n once published or held.
+func (s *messageSvc) newRecord(n Notification, held bool) status.Record {
+	var rcpts []string
+	if ch, err := s.channels.Get(n.Channel); err == nil {
+		rcpts = channel.Recipients(ch, n.Body)
+	}
+
+	st := status.Queued
+	if held {
+		st = status.Scheduled
+	}
+
+	r := status.NewRecord(n.ID, n.Channel, rcpts, st, time.Now())
+	r.Tenant, r.CallbackURL = n.Tenant, n.CallbackURL
+
+	if held {
+		r.SendAt = &n.SendAt
+	}
+
+	return r
 }
 
-func (s *messageSvc) RecvEmailRequest(ctx context.Context, wg *sync.WaitGroup) {
+func (s *messageSvc) RecvRequest(ctx context.Context, wg *sync.WaitGroup) {
 	// for the subscriber
 	wg.Add(1)
-	// preparing args for new consumer
-	subj := fmt.Sprintf("%s.send", config.StreamName)
+	// preparing args for new consumer, which gets the events of every channel
+	subj := channel.Subject("*")
 	durableName := fmt.Sprintf("%s_pullSub", config.StreamName)
 
-	// creating a new pull based consumer
-	sub, err := s.js.PullSubscribe(subj, durableName, nats.PullMaxWaiting(128))
+	// consumers created before channels filtered on NOTIFS.send only and
+	// the ones created before explicit acks used the server defaults
+	if err := natshelper.MigrateConsumer(s.js, config.StreamName, &nats.ConsumerConfig{
+		Durable:       durableName,
+		FilterSubject: subj,
+		AckWait:       config.NatsAckWait,
+		MaxDeliver:    config.NatsMaxDeliver,
+	}, s.log); err != nil {
+		s.log.Errorf("migrating consumer: %s failed with err: %v", durableName, err)
+		wg.Done()
+
+		return
+	}
+
+	// the msgs still on NOTIFS.send were published for email before the
+	// channels had subjects of their own
+	if err := natshelper.MoveMsgs(s.js, config.StreamName, config.StreamName+".send",
+		channel.Subject(email.ChannelName), s.log); err != nil {
+		s.log.Errorf("moving msgs of %s.send failed with err: %v", config.StreamName, err)
+		wg.Done()
+
+		return
+	}
+
+	// creating a new pull based consumer, a msg not acked within AckWait
+	// is redelivered up to MaxDeliver times
+	sub, err := s.js.PullSubscribe(subj, durableName,
+		nats.PullMaxWaiting(128),
+		nats.AckExplicit(),
+		nats.AckWait(config.NatsAckWait),
+		nats.MaxDeliver(config.NatsMaxDeliver),
+	)
 	if err != nil {
 		s.log.Errorf("subcribing to stream: %s failed with err: %v", config.StreamName, err)
 		wg.Done()
@@ -100,68 +416,556 @@ func (s *messageSvc) RecvEmailRequest(ctx context.Context, wg *sync.WaitGroup) {
 		return
 	}
 
-	s.log.Infof("subscriber added to stream : %s of name: %s", config.StreamName, durableName)
+	s.log.Infof("subscriber added to stream : %s of name: %s with %d workers",
+		config.StreamName, durableName, s.concurrency)
+
+	// a slot is taken by every notification being processed
+	slots := make(chan struct{}, s.concurrency)
+	inflight := &sync.WaitGroup{}
+
+	// the in-flight sends are not cut short by the shutdown but given up to
+	// AckWait to finish, past which their msg is redelivered anyway
+	work, cancel := drain(ctx, config.NatsAckWait)
+	defer cancel()
 
 	// iterate over till ctx is not done
 	for {
+		// waiting for a free worker
 		select {
 		case <-ctx.Done():
+			// the in-flight notifications are settled before returning
+			inflight.Wait()
 			wg.Done()
+
 			return
 
-		default:
+		case slots <- struct{}{}:
+		}
+
+		// fetching as many msgs as there are free workers, so no msg waits
+		// for one while its ack wait runs
+		free := 1
+		for free < config.NatsBatchSize && tryAcquire(slots) {
+			free++
 		}
 
 		// fecthing msgs in batch till context deadline or timeout
-		msgs, err := sub.Fetch(config.NatsBatchSize, nats.MaxWait(config.NatsSubMaxWait))
+		msgs, err := sub.Fetch(free, nats.MaxWait(config.NatsSubMaxWait))
 		if err != nil && !errors.Is(err, nats.ErrTimeout) {
 			s.log.Errorf("failed to fetch msg in batch:%v", err)
-			continue
 		}
 
-		// range over the batch of msgs and sends them using go-smtp
-		s.eventProcessor(ctx, msgs)
+		for i := len(msgs); i < free; i++ {
+			<-slots
+		}
+
+		// sends every msg of the batch through its channel on its own worker
+		s.eventProcessor(work, msgs, slots, inflight)
+	}
+}
+
+// drain returns a context which is cancelled grace after ctx is done, so
+// the work started with it gets to finish on shutdown.
+func drain(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-work.Done():
+			return
+
+		case <-ctx.Done():
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-work.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+
+	return work, cancel
+}
+
+// tryAcquire takes a slot when one is free.
+func tryAcquire(slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+
+	default:
+		return false
 	}
 }
 
-func (s *messageSvc) eventProcessor(ctx context.Context, msgs []*nats.Msg) {
+// eventProcessor processes every msg concurrently, each one holding a
+// slot it releases once settled.
+func (s *messageSvc) eventProcessor(ctx context.Context, msgs []*nats.Msg, slots chan struct{},
+	inflight *sync.WaitGroup) {
 	for i := range msgs {
-		// Extracts the trace from msg header and creates a span for processing.
-		var span trace.Span
-		spanCtx := s.propagators.Extract(ctx, propagation.HeaderCarrier(msgs[i].Header))
-		spanCtx, span = s.tracer.Start(spanCtx, "message.svc-subscribe.eventProcessor")
+		inflight.Add(1)
 
-		// extracting traceID for logging purpose
-		traceID := span.SpanContext().TraceID().String()
+		go func(msg *nats.Msg) {
+			defer func() {
+				<-slots
+				inflight.Done()
+			}()
 
-		if err := msgs[i].Ack(); err != nil {
-			s.errLogWithSpanAttributes("ack failed", traceID, err, span)
-			continue
+			s.process(ctx, msg)
+		}(msgs[i])
+	}
+}
+
+// process sends the notification of msg and acks it only once it is
+// delivered, so a crash or an outage redelivers it instead of losing it.
+// Retryable failures are redelivered after a backoff and permanent ones
+// are terminated.
+func (s *messageSvc) process(ctx context.Context, msg *nats.Msg) {
+	// Extracts the trace from msg header and creates a span for processing.
+	spanCtx := s.propagators.Extract(ctx, propagation.HeaderCarrier(msg.Header))
+	spanCtx, span := s.tracer.Start(spanCtx, "message.svc-subscribe.eventProcessor")
+	defer span.End()
+
+	// extracting traceID for logging purpose
+	traceID := span.SpanContext().TraceID().String()
+
+	id := msg.Header.Get(IDHeader)
+	span.SetAttributes(attribute.String("notif.id", id))
+	s.track(spanCtx, id, deliveries(msg), status.Processing, nil, nil)
+
+	// keeps the msg from being redelivered while a long send is going on
+	stop := heartbeat(msg, s.log)
+	results, err := s.deliver(channel.WithID(spanCtx, id), span, msg)
+	stop()
+
+	if err != nil {
+		s.errLogWithSpanAttributes("sending notification failed", traceID, err, span)
+		s.track(spanCtx, id, 0, s.settle(spanCtx, msg, err, traceID, span), err, results)
+
+		return
+	}
+
+	if err = msg.Ack(); err != nil {
+		s.errLogWithSpanAttributes("ack failed", traceID, err, span)
+		return
+	}
+
+	s.track(spanCtx, id, 0, status.Sent, nil, results)
+	s.log.Info("successfully sent notification", zap.String("traceID", traceID))
+}
+
+// deliver routes the msg to its channel and sends every rendered message.
+// A msg which cannot be decoded or rendered is a permanent failure. When
+// several messages fail, the msg is retried if any of them may succeed.
+// Redelivering resends the messages which succeeded as well, which is the
+// price of at-least-once delivery. The error of every recipient of the
+// channels telling them apart is returned along, nil once sent.
+func (s *messageSvc) deliver(ctx context.Context, span trace.Span, msg *nats.Msg) (map[string]error, error) {
+	// routing the event to the channel it was published for
+	ch, n, err := s.decode(msg)
+	if err != nil {
+		return nil, channel.Permanent(err)
+	}
+
+	span.SetAttributes(attribute.String("notif.channel", ch.Name()))
+
+	// templated notifications are rendered into a message per recipient
+	rendered, err := ch.Render(ctx, n)
+	if err != nil {
+		if clientError(err) {
+			return nil, channel.Permanent(err)
+		}
+
+		return nil, err
+	}
+
+	var failed error
+
+	results := make(map[string]error)
+
+	for i := range rendered {
+		sErr := s.sendWithRetry(ctx, ch, rendered[i])
+		if sErr != nil && (failed == nil || channel.IsPermanent(failed)) {
+			failed = sErr
+		}
+
+		// the recipients left out of the failures of a partial delivery
+		// were delivered
+		failures := channel.Failures(sErr)
+		for _, rcpt := range channel.Recipients(ch, rendered[i]) {
+			if failures != nil {
+				results[rcpt] = failures[rcpt]
+			} else {
+				results[rcpt] = sErr
+			}
+		}
+	}
+
+	return results, failed
+}
+
+// settle dead-letters and terminates the msg on permanent failures or
+// once it was delivered MaxDeliver times, and naks it with a backoff
+// otherwise. It returns the status the notification is left in.
+func (s *messageSvc) settle(ctx context.Context, msg *nats.Msg, err error, traceID string,
+	span trace.Span) status.Status {
+	delivered := deliveries(msg)
+
+	span.SetAttributes(attribute.Int64("nats.num_delivered", int64(delivered)))
+
+	// the send was cut short by the shutdown, another instance may
+	// take the msg right away
+	if ctx.Err() != nil {
+		if nErr := msg.Nak(); nErr != nil {
+			s.errLogWithSpanAttributes("nak failed", traceID, nErr, span)
+		}
+
+		return status.Queued
+	}
+
+	if channel.IsPermanent(err) || delivered >= uint64(config.NatsMaxDeliver) {
+		reason := deadletter.Exhausted
+		if channel.IsPermanent(err) {
+			reason = deadletter.Permanent
+		}
+
+		dErr := s.deadLetters.Publish(ctx, msg, deadletter.Failure{
+			Reason:     reason,
+			Errors:     errorChain(err),
+			Deliveries: delivered,
+		})
+
+		if dErr == nil {
+			if tErr := msg.Term(); tErr != nil {
+				s.errLogWithSpanAttributes("term failed", traceID, tErr, span)
+			}
+
+			return status.DeadLettered
+		}
+
+		// keeping the msg in the work queue beats losing it
+		s.errLogWithSpanAttributes("dead-lettering failed", traceID, dErr, span)
+	}
+
+	if nErr := msg.NakWithDelay(nakDelay(delivered)); nErr != nil {
+		s.errLogWithSpanAttributes("nak failed", traceID, nErr, span)
+	}
+
+	return status.Retrying
+}
+
+// deliveries returns how many times msg was delivered.
+func deliveries(msg *nats.Msg) uint64 {
+	if meta, err := msg.Metadata(); err == nil {
+		return meta.NumDelivered
+	}
+
+	return 1
+}
+
+// track moves the status of the notification id to st, and its
+// deliveries to delivered unless it is 0. A failure to record it is only
+// logged, it must not hold up the delivery.
+func (s *messageSvc) track(ctx context.Context, id string, delivered uint64, st status.Status, err error,
+	results map[string]error) {
+	// msgs published before the ids have none
+	if id == "" {
+		return
+	}
+
+	r, uErr := s.statuses.Update(ctx, id, func(r *status.Record) {
+		if delivered > 0 {
+			r.Deliveries = delivered
 		}
 
-		var e email.Entity
-		err := json.Unmarshal(msgs[i].Data, &e)
+		r.Set(st, err, results, time.Now())
+	})
+	if uErr != nil {
+		s.log.Warnf("recording status %s of %s failed: %v", st, id, uErr)
+		return
+	}
+
+	s.notify(ctx, r)
+}
+
+func (s *messageSvc) Notify(ctx context.Context, r status.Record) {
+	s.notify(ctx, r)
+}
+
+// notify pushes the status r moved to to the callback url given with its
+// notification, or else to the one of its tenant. The callback is sent as
+// a signed webhook notification, so it is retried like any other one, and
+// its key keeps a status from being pushed twice when its msg is
+// redelivered.
+func (s *messageSvc) notify(ctx context.Context, r status.Record) {
+	url, events := r.CallbackURL, []status.Status(nil)
+
+	if url == "" && r.Tenant != "" && s.callbacks != nil {
+		c, err := s.callbacks.Get(ctx, r.Tenant)
 		if err != nil {
-			s.errLogWithSpanAttributes("unmarshalling msgData failed", traceID, err, span)
-			continue
+			if !clientError(err) {
+				s.log.Warnf("getting callback of tenant %s failed: %v", r.Tenant, err)
+			}
+
+			return
+		}
+
+		url, events = c.URL, c.Events
+	}
+
+	if url == "" || !callback.Wants(events, r.Status) {
+		return
+	}
+
+	payload, err := json.Marshal(callback.NewEvent(r))
+	if err != nil {
+		s.log.Warnf("marshalling callback of %s failed: %v", r.ID, err)
+		return
+	}
+
+	if _, err = s.SendRequest(ctx, Notification{
+		Key:     "callback-" + r.ID + "-" + string(r.Status) + "-" + strconv.FormatUint(r.Deliveries, 10),
+		Channel: webhook.ChannelName,
+		Body: webhook.Entity{
+			URL:     url,
+			Payload: payload,
+			Headers: map[string]string{callback.EventHeader: string(r.Status)},
+		},
+	}); err != nil {
+		s.log.Warnf("sending callback %s of %s failed: %v", r.Status, r.ID, err)
+	}
+}
+
+// nakDelay doubles the redelivery delay with every delivery.
+func nakDelay(delivered uint64) time.Duration {
+	delay := config.NatsNakDelay
+	for i := uint64(1); i < delivered && delay < config.NatsNakMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > config.NatsNakMaxDelay {
+		return config.NatsNakMaxDelay
+	}
+
+	return delay
+}
+
+// heartbeat tells the server the msg is in progress a few times per
+// AckWait till stop is called.
+func heartbeat(msg *nats.Msg, log *zap.SugaredLogger) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(config.NatsAckWait / 3)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					log.Warnf("in progress heartbeat failed: %v", err)
+				}
+			}
 		}
+	}()
+
+	return func() { close(done) }
+}
+
+// clientError tells whether err is a NotifErr about the notification
+// itself, which no retry will fix.
+func clientError(err error) bool {
+	var nErr pkg.NotifErr
+
+	return errors.As(err, &nErr) && nErr.Code >= http.StatusBadRequest && nErr.Code < http.StatusInternalServerError
+}
+
+// decode finds the channel of the msg subject and decodes its data.
+func (s *messageSvc) decode(msg *nats.Msg) (channel.Channel, interface{}, error) {
+	name, err := channel.NameFromSubject(msg.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, err := s.channels.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n, err := ch.Decode(msg.Data)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// Send email service retry logic with maxAttempt and delay between each attempt
-		err = retry.Do(func() error {
-			return s.emailSvc.SendEmail(spanCtx, e)
-		}, retry.Attempts(config.SmtpRetryAttempts),
-			retry.Delay(config.SmtpRetryDelay),
-			retry.Context(spanCtx),
-		)
+	return ch, n, nil
+}
+
+// sendWithRetry sends the message with maxAttempt and delay between each
+// attempt. Permanent errors are not retried, a partial delivery only
+// retries what is left to send and a rate limited channel is retried
+// after the delay it asks for. The failures of the recipients are merged
+// across the attempts, so a recipient refused for good by an attempt is
+// still reported once the recipients retried are delivered.
+func (s *messageSvc) sendWithRetry(ctx context.Context, ch channel.Channel, n interface{}) error {
+	var errs []error
+
+	failures := make(map[string]error)
 
+	err := retry.Do(func() error {
+		rcpts := channel.Recipients(ch, n)
+
+		err := ch.Send(ctx, n)
 		if err != nil {
-			s.errLogWithSpanAttributes("sending email failed", traceID, err, span)
+			errs = append(errs, err)
+		}
+
+		merge(failures, rcpts, err)
+
+		var pErr *channel.PartialError
+		if errors.As(err, &pErr) {
+			n = pErr.Next
+		}
+
+		if channel.IsPermanent(err) {
+			return retry.Unrecoverable(err)
+		}
+
+		return err
+	}, retry.Attempts(config.SmtpRetryAttempts),
+		retry.Delay(config.SmtpRetryDelay),
+		retry.DelayType(retryDelay),
+		// the last error tells whether the msg is worth redelivering
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+	)
+	if len(errs) == 0 {
+		return err
+	}
+
+	if err == nil {
+		if len(failures) == 0 {
+			return nil
+		}
+
+		// the recipients left were refused for good by an earlier attempt
+		errs = append(errs, channel.Permanent(&refusedError{failures: failures}))
+	}
+
+	// the retries were cut short by the shutdown
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+
+	return &sendError{errs: errs, failures: failures}
+}
+
+// merge records in failures the outcome of an attempt sent to rcpts which
+// failed with err. A recipient delivered is dropped, the error of the
+// whole attempt is the one of its recipients unless err tells them apart.
+func merge(failures map[string]error, rcpts []string, err error) {
+	attempt := channel.Failures(err)
+
+	for _, rcpt := range rcpts {
+		rErr := err
+		if attempt != nil {
+			rErr = attempt[rcpt]
+		}
+
+		if rErr == nil {
+			delete(failures, rcpt)
 			continue
 		}
 
-		s.log.Info("successfully send email", zap.String("traceID", traceID))
-		span.End()
+		failures[rcpt] = rErr
+	}
+}
+
+// sendError is the failure of a message after its last attempt, it keeps
+// the error of every attempt and unwraps to the last one. Its failures
+// are the ones of every recipient across the attempts.
+type sendError struct {
+	errs     []error
+	failures map[string]error
+}
+
+func (e *sendError) Error() string {
+	return e.errs[len(e.errs)-1].Error()
+}
+
+func (e *sendError) Unwrap() error {
+	return e.errs[len(e.errs)-1]
+}
+
+// Failures returns the error of every recipient not delivered by any
+// attempt, nil when the channel does not tell apart its recipients.
+func (e *sendError) Failures() map[string]error {
+	if len(e.failures) == 0 {
+		return nil
+	}
+
+	return e.failures
+}
+
+// refusedError is the failure of the recipients an earlier attempt refused
+// for good when the last attempt delivered the others.
+type refusedError struct {
+	failures map[string]error
+}
+
+func (r *refusedError) Error() string {
+	rcpts := make([]string, 0, len(r.failures))
+	for rcpt := range r.failures {
+		rcpts = append(rcpts, rcpt)
+	}
+
+	sort.Strings(rcpts)
+
+	for i, rcpt := range rcpts {
+		rcpts[i] = fmt.Sprintf("%s: %v", rcpt, r.failures[rcpt])
+	}
+
+	return "delivery failed for " + strings.Join(rcpts, "; ")
+}
+
+// errorChain returns the error of every attempt of err.
+func errorChain(err error) []string {
+	errs := []error{err}
+
+	var sErr *sendError
+	if errors.As(err, &sErr) {
+		errs = sErr.errs
 	}
+
+	chain := make([]string, len(errs))
+	for i := range errs {
+		chain[i] = errs[i].Error()
+	}
+
+	return chain
+}
+
+// defaultDelay is the default delay type of retry-go.
+var defaultDelay = retry.CombineDelay(retry.BackOffDelay, retry.RandomDelay)
+
+// retryDelay honours the delay asked by the channel, capped so a single
+// message cannot hold the subscriber for long.
+func retryDelay(n uint, err error, cfg *retry.Config) time.Duration {
+	after, ok := channel.RetryAfter(err)
+	if !ok {
+		return defaultDelay(n, err, cfg)
+	}
+
+	if after > config.MaxRetryAfter {
+		return config.MaxRetryAfter
+	}
+
+	return after
 }
 
 func (s *messageSvc) errLogWithSpanAttributes(msg, traceID string, err error, span trace.Span) {
@@ -0,0 +1,388 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/implementation/push"
+	"notif/implementation/status"
+	"notif/pkg"
+	"notif/pkg/config"
+	natshelper "notif/pkg/nats"
+	"notif/pkg/nats/natstest"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestNakDelay(t *testing.T) {
+	require.Equal(t, config.NatsNakDelay, nakDelay(1))
+	require.Equal(t, 2*config.NatsNakDelay, nakDelay(2))
+	require.Equal(t, 8*config.NatsNakDelay, nakDelay(4))
+	require.Equal(t, config.NatsNakMaxDelay, nakDelay(100))
+}
+
+func TestRetryDelay(t *testing.T) {
+	err := &channel.RetryAfterError{Err: errors.New("slow down"), After: 3 * time.Second}
+	require.Equal(t, 3*time.Second, retryDelay(0, err, nil))
+
+	err.After = time.Hour
+	require.Equal(t, config.MaxRetryAfter, retryDelay(0, err, nil))
+}
+
+func TestClientError(t *testing.T) {
+	require.True(t, clientError(pkg.NotifErr{Code: http.StatusNotFound, Err: errors.New("no template")}))
+	require.False(t, clientError(pkg.NotifErr{Code: http.StatusServiceUnavailable, Err: errors.New("kv down")}))
+	require.False(t, clientError(errors.New("timeout")))
+}
+
+func TestKey(t *testing.T) {
+	require.True(t, ValidKey("order-42/confirmation"))
+	require.False(t, ValidKey(""))
+	require.False(t, ValidKey("order 42"))
+	require.False(t, ValidKey("order-42\r\nX-Injected: 1"))
+	require.False(t, ValidKey(strings.Repeat("k", maxKeyLen+1)))
+
+	require.Equal(t, keyID("order-42"), keyID("order-42"))
+	require.NotEqual(t, keyID("order-42"), keyID("order-43"))
+	require.Len(t, keyID("order-42"), 22)
+
+	n := Notification{Key: "order-42", Channel: "email"}
+	sms := Notification{Key: "order-42", Channel: "sms"}
+	tenant := Notification{Key: "order-42", Channel: "email", Tenant: "acme"}
+	require.Equal(t, scopedKey(n), scopedKey(Notification{Key: "order-42", Channel: "email", Body: "again"}))
+	require.NotEqual(t, scopedKey(n), scopedKey(sms), "a key is scoped to its channel")
+	require.NotEqual(t, scopedKey(n), scopedKey(tenant), "a key is scoped to its tenant")
+}
+
+func TestPrepareTooLarge(t *testing.T) {
+	s := &messageSvc{
+		log:         zap.NewNop().Sugar(),
+		tracer:      trace.NewNoopTracerProvider().Tracer(""),
+		propagators: b3.New(),
+	}
+	ctx, span := s.tracer.Start(context.Background(), "test")
+
+	_, err := s.prepare(ctx, span, Notification{Channel: "email", Body: strings.Repeat("a", int(config.NatsMaxPayload))})
+
+	var pErr pkg.Error
+	require.ErrorAs(t, err, &pErr)
+	require.Equal(t, http.StatusRequestEntityTooLarge, pErr.Status())
+	require.ErrorIs(t, pErr.(pkg.NotifErr).Err, ErrTooLarge)
+}
+
+// gateChannel holds every send till release is closed, telling how many
+// sends ran at once and how many finished without being cancelled.
+type gateChannel struct {
+	release chan struct{}
+
+	mu       sync.Mutex
+	running  int
+	most     int
+	finished int
+}
+
+func (*gateChannel) Name() string                            { return "gate" }
+func (*gateChannel) Decode(data []byte) (interface{}, error) { return data, nil }
+func (*gateChannel) Validate(interface{}) error              { return nil }
+func (*gateChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+func (g *gateChannel) Send(ctx context.Context, _ interface{}) error {
+	g.mu.Lock()
+	g.running++
+	if g.running > g.most {
+		g.most = g.running
+	}
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.running--
+		g.mu.Unlock()
+	}()
+
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	g.mu.Lock()
+	g.finished++
+	g.mu.Unlock()
+
+	return nil
+}
+
+func (g *gateChannel) counts() (running, most, finished int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.running, g.most, g.finished
+}
+
+func TestRecvRequestWorkers(t *testing.T) {
+	defer func(wait time.Duration) { config.NatsSubMaxWait = wait }(config.NatsSubMaxWait)
+	config.NatsSubMaxWait = 100 * time.Millisecond
+
+	_, js := natstest.RunJetStream(t)
+	log := zap.NewNop().Sugar()
+	require.NoError(t, natshelper.CreateStream(js, time.Minute, log))
+
+	for i := 0; i < 5; i++ {
+		_, err := js.Publish(channel.Subject("gate"), []byte("n"))
+		require.NoError(t, err)
+	}
+
+	gate := &gateChannel{release: make(chan struct{})}
+	svc := NewMessageService(log, js, channel.NewRegistry(gate), nil, nil, nil, nil, 2,
+		trace.NewNoopTracerProvider().Tracer(""), b3.New())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	returned := make(chan struct{})
+
+	go func() {
+		svc.RecvRequest(ctx, wg)
+		close(returned)
+	}()
+
+	require.Eventually(t, func() bool {
+		running, _, _ := gate.counts()
+		return running == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// no more than the 2 workers send at once
+	time.Sleep(200 * time.Millisecond)
+
+	_, most, _ := gate.counts()
+	require.Equal(t, 2, most)
+
+	// the shutdown waits for the in-flight sends instead of cancelling them
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case <-returned:
+		t.Fatal("returned before the in-flight sends finished")
+	default:
+	}
+
+	close(gate.release)
+	<-returned
+	wg.Wait()
+
+	_, most, finished := gate.counts()
+	require.Equal(t, 2, most)
+	require.Equal(t, 2, finished)
+
+	info, err := js.StreamInfo(config.StreamName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), info.State.Msgs, "the drained msgs are acked, the others are left")
+}
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	work, stop := drain(ctx, 50*time.Millisecond)
+	defer stop()
+
+	cancel()
+	require.NoError(t, work.Err(), "the work outlives ctx")
+	require.Eventually(t, func() bool { return work.Err() != nil }, time.Second, 5*time.Millisecond,
+		"the work is cancelled once the grace is over")
+}
+
+// splitChannel sends to comma separated recipients, it unregisters "A" and
+// defers every other recipient on the first attempt.
+type splitChannel struct {
+	attempts int
+}
+
+func (*splitChannel) Name() string { return "split" }
+func (*splitChannel) Decode(data []byte) (interface{}, error) {
+	return strings.Split(string(data), ","), nil
+}
+func (*splitChannel) Validate(interface{}) error        { return nil }
+func (*splitChannel) Recipients(n interface{}) []string { return n.([]string) }
+func (*splitChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+func (c *splitChannel) Send(_ context.Context, n interface{}) error {
+	c.attempts++
+	if c.attempts > 1 {
+		return nil
+	}
+
+	dErr := &channel.DeliveryError{}
+
+	var next []string
+
+	for _, rcpt := range n.([]string) {
+		if rcpt == "A" {
+			dErr.Results = append(dErr.Results, channel.Result{Recipient: rcpt, Status: channel.Unregistered,
+				Err: errors.New("unregistered")})
+
+			continue
+		}
+
+		dErr.Results = append(dErr.Results, channel.Result{Recipient: rcpt, Status: channel.Deferred,
+			Err: errors.New("unavailable")})
+		next = append(next, rcpt)
+	}
+
+	return &channel.PartialError{Err: dErr, Next: next}
+}
+
+func TestDeliverMergesAttempts(t *testing.T) {
+	defer func(delay time.Duration) { config.SmtpRetryDelay = delay }(config.SmtpRetryDelay)
+	config.SmtpRetryDelay = time.Millisecond
+
+	ch := &splitChannel{}
+	svc := NewMessageService(zap.NewNop().Sugar(), nil, channel.NewRegistry(ch), nil, nil, nil, nil, 1,
+		trace.NewNoopTracerProvider().Tracer(""), b3.New()).(*messageSvc)
+
+	ctx := context.Background()
+	results, err := svc.deliver(ctx, trace.SpanFromContext(ctx),
+		&nats.Msg{Subject: channel.Subject("split"), Data: []byte("A,B")})
+
+	// B delivered on the retry does not hide that A was refused before
+	require.Equal(t, 2, ch.attempts)
+	require.True(t, channel.IsPermanent(err), err)
+	require.Contains(t, err.Error(), "A: unregistered")
+	require.Len(t, channel.Failures(err), 1)
+	require.True(t, channel.IsUnregistered(results["A"]))
+	require.Contains(t, results, "B")
+	require.NoError(t, results["B"])
+
+	r := status.Record{}
+	r.Set(status.Failed, err, results, time.Now())
+	require.Equal(t, status.Unregistered, r.Recipients["A"].Status)
+	require.Equal(t, status.Sent, r.Recipients["B"].Status)
+	require.Len(t, errorChain(err), 2, "the error of every attempt is kept")
+}
+
+// flakyPush unregisters the token "dead" and defers the others on the
+// first push, and delivers them on the next ones.
+type flakyPush struct {
+	pushes int
+}
+
+func (*flakyPush) Supports(string) bool { return true }
+
+func (f *flakyPush) SendPush(_ context.Context, e push.Entity) error {
+	f.pushes++
+	if f.pushes > 1 {
+		return nil
+	}
+
+	dErr := &channel.DeliveryError{}
+
+	for _, token := range e.Tokens {
+		if token == "dead" {
+			dErr.Results = append(dErr.Results, channel.Result{Recipient: token, Status: channel.Unregistered,
+				Err: errors.New("Unregistered")})
+
+			continue
+		}
+
+		dErr.Results = append(dErr.Results, channel.Result{Recipient: token, Status: channel.Deferred,
+			Err: errors.New("ServiceUnavailable")})
+	}
+
+	return dErr
+}
+
+func TestDeliverPushUnregistered(t *testing.T) {
+	defer func(delay time.Duration) { config.SmtpRetryDelay = delay }(config.SmtpRetryDelay)
+	config.SmtpRetryDelay = time.Millisecond
+
+	p := &flakyPush{}
+	svc := NewMessageService(zap.NewNop().Sugar(), nil, channel.NewRegistry(push.NewChannel(p)), nil, nil, nil,
+		nil, 1, trace.NewNoopTracerProvider().Tracer(""), b3.New()).(*messageSvc)
+
+	ctx := context.Background()
+	results, err := svc.deliver(ctx, trace.SpanFromContext(ctx), &nats.Msg{Subject: channel.Subject(push.ChannelName),
+		Data: []byte(`{"provider":"fcm","tokens":["dead","live"],"body":"hi"}`)})
+
+	// the live token delivered on the retry leaves the dead one reported
+	require.Equal(t, 2, p.pushes)
+	require.True(t, channel.IsPermanent(err), err)
+	require.True(t, channel.IsUnregistered(results["dead"]))
+	require.Contains(t, results, "live")
+	require.NoError(t, results["live"])
+}
+
+func TestSendBatch(t *testing.T) {
+	_, js := natstest.RunJetStream(t)
+	log := zap.NewNop().Sugar()
+	tracer := trace.NewNoopTracerProvider().Tracer("")
+	require.NoError(t, natshelper.CreateStream(js, time.Minute, log))
+
+	kv, err := natshelper.CreateKeyValue(js, config.StatusBucket, "notification delivery status", 0, log)
+	require.NoError(t, err)
+
+	svc := NewMessageService(log, js, channel.NewRegistry(&gateChannel{}), nil, nil,
+		status.NewStatusService(log, kv, tracer), nil, 1, tracer, b3.New())
+
+	ns := make([]Notification, 3*config.BatchConcurrency)
+	for i := range ns {
+		ns[i] = Notification{Key: "campaign-" + strconv.Itoa(i), Channel: "gate", Body: i}
+	}
+
+	ns[1].Key = "not a key"
+
+	results := svc.SendBatch(context.Background(), ns)
+	require.Len(t, results, len(ns))
+
+	for i := range results {
+		if i == 1 {
+			require.ErrorIs(t, results[i].Err.(pkg.NotifErr).Err, ErrInvalidKey)
+			continue
+		}
+
+		require.NoError(t, results[i].Err, i)
+		require.Equal(t, keyID(scopedKey(ns[i])), results[i].ID, "results keep the order of the batch")
+		require.False(t, results[i].Duplicate)
+
+		r, err := status.NewStatusService(log, kv, tracer).Get(context.Background(), results[i].ID)
+		require.NoError(t, err)
+		require.Equal(t, status.Queued, r.Status)
+	}
+
+	// a batch sent again is not published twice
+	again := svc.SendBatch(context.Background(), ns)
+	require.True(t, again[0].Duplicate)
+
+	info, err := js.StreamInfo(config.StreamName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(ns)-1), info.State.Msgs)
+}
+
+func TestSendBatchTimeOut(t *testing.T) {
+	defer func(d time.Duration) { config.BatchTimeOut = d }(config.BatchTimeOut)
+	config.BatchTimeOut = 0
+
+	_, js := natstest.RunJetStream(t)
+	log := zap.NewNop().Sugar()
+	require.NoError(t, natshelper.CreateStream(js, time.Minute, log))
+
+	svc := NewMessageService(log, js, channel.NewRegistry(&gateChannel{}), nil, nil, nil, nil, 1,
+		trace.NewNoopTracerProvider().Tracer(""), b3.New())
+
+	// the notifications left once the batch is out of time are failed
+	results := svc.SendBatch(context.Background(), []Notification{{Channel: "gate", Body: 1}})
+	require.ErrorIs(t, results[0].Err, context.DeadlineExceeded)
+}
@@ -0,0 +1,187 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// apnsTokenTTL renews the provider token before apple refuses it
+	// after an hour, but not more often than the 20 minutes it allows.
+	apnsTokenTTL = 50 * time.Minute
+	// apnsUnregistered and apnsBadDeviceToken are the apns reasons of a
+	// token which is no longer, or was never, valid for the topic.
+	apnsUnregistered   = "Unregistered"
+	apnsBadDeviceToken = "BadDeviceToken"
+	// apnsExpiredToken is the reason of a provider token apple refuses.
+	apnsExpiredToken = "ExpiredProviderToken"
+)
+
+var ErrAPNsKey = errors.New("apns signing key must be a P-256 ecdsa key")
+
+type apns struct {
+	baseURL string
+	key     crypto.Signer
+	keyID   string
+	teamID  string
+	topic   string
+	client  *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNsProvider returns a provider for the apns http/2 api at baseURL,
+// authenticated with the .p8 signing key of keyFile. topic is the bundle
+// id of the app.
+func NewAPNsProvider(baseURL, keyFile, keyID, teamID, topic string, client *http.Client) (PushProvider, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// apple only takes ES256 provider tokens
+	if alg, err := algorithm(key); err != nil || alg != "ES256" {
+		return nil, ErrAPNsKey
+	}
+
+	return &apns{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		key:     key,
+		keyID:   keyID,
+		teamID:  teamID,
+		topic:   topic,
+		client:  client,
+	}, nil
+}
+
+func (a *apns) Name() string {
+	return APNs
+}
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body"`
+}
+
+// payload puts the alert in the aps dictionary and the data as custom
+// keys next to it.
+func (a *apns) payload(e Entity) ([]byte, error) {
+	p := make(map[string]interface{}, len(e.Data)+1)
+	for k, v := range e.Data {
+		p[k] = v
+	}
+
+	p["aps"] = map[string]interface{}{
+		"alert": apnsAlert{Title: e.Title, Body: e.Body},
+	}
+
+	return json.Marshal(p)
+}
+
+func (a *apns) Send(ctx context.Context, token string, e Entity) (string, error) {
+	providerToken, err := a.providerToken()
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := a.payload(e)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := a.baseURL + "/3/device/" + url.PathEscape(token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return resp.Header.Get("apns-id"), nil
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+
+	_ = json.Unmarshal(data, &body)
+
+	expired := body.Reason == apnsExpiredToken
+	if expired {
+		a.resetToken()
+	}
+
+	return "", &ProviderError{
+		Status:    resp.StatusCode,
+		Reason:    body.Reason,
+		Message:   http.StatusText(resp.StatusCode),
+		Retryable: retryableStatus(resp.StatusCode) || expired,
+		Unregistered: resp.StatusCode == http.StatusGone ||
+			body.Reason == apnsUnregistered || body.Reason == apnsBadDeviceToken,
+	}
+}
+
+// providerToken returns the cached ES256 provider token, signing a new one
+// once it is apnsTokenTTL old.
+func (a *apns) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Since(a.issuedAt) < apnsTokenTTL {
+		return a.token, nil
+	}
+
+	now := time.Now()
+
+	token, err := signJWT(
+		map[string]interface{}{"kid": a.keyID},
+		map[string]interface{}{"iss": a.teamID, "iat": now.Unix()},
+		a.key)
+	if err != nil {
+		return "", err
+	}
+
+	a.token, a.issuedAt = token, now
+
+	return token, nil
+}
+
+func (a *apns) resetToken() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
@@ -0,0 +1,112 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ChannelName is the channel token of push notifications.
+const ChannelName = "push"
+
+var ErrNotAnEntity = errors.New("notification is not a push entity")
+
+type pushChannel struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+// NewChannel returns the push notification channel sending through svc.
+func NewChannel(svc Service) channel.Channel {
+	return &pushChannel{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+func (c *pushChannel) Name() string {
+	return ChannelName
+}
+
+func (c *pushChannel) Decode(data []byte) (interface{}, error) {
+	var e Entity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return e, nil
+}
+
+// Recipients returns the device tokens of the entity.
+func (c *pushChannel) Recipients(n interface{}) []string {
+	e, ok := n.(Entity)
+	if !ok {
+		return nil
+	}
+
+	return e.Tokens
+}
+
+// Validate checks the entity and that its provider is configured.
+func (c *pushChannel) Validate(n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return ErrNotAnEntity
+	}
+
+	if err := c.validate.Struct(e); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	if !c.svc.Supports(e.Provider) {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  ErrProviderNotConfigured,
+		}
+	}
+
+	return nil
+}
+
+func (c *pushChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+// Send pushes to every token. Unregistered and rejected tokens are
+// reported in the error, and so in the status of their recipient, and
+// never retried, only the deferred tokens are sent again.
+func (c *pushChannel) Send(ctx context.Context, n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return channel.Permanent(ErrNotAnEntity)
+	}
+
+	err := c.svc.SendPush(ctx, e)
+
+	var dErr *channel.DeliveryError
+	if errors.As(err, &dErr) {
+		if len(dErr.Deferred()) == 0 {
+			return channel.Permanent(err)
+		}
+
+		return &channel.PartialError{Err: err, Next: e.withTokens(dErr.Deferred())}
+	}
+
+	if errors.Is(err, ErrProviderNotConfigured) {
+		return channel.Permanent(err)
+	}
+
+	return err
+}
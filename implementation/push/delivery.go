@@ -0,0 +1,23 @@
+package push
+
+import (
+	"errors"
+
+	"notif/implementation/channel"
+)
+
+// classify maps a provider error to the token delivery status.
+func classify(err error) channel.DeliveryStatus {
+	var pErr *ProviderError
+
+	switch {
+	case !errors.As(err, &pErr):
+		return channel.Deferred
+	case pErr.Unregistered:
+		return channel.Unregistered
+	case pErr.Retryable:
+		return channel.Deferred
+	default:
+		return channel.Rejected
+	}
+}
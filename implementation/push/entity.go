@@ -0,0 +1,26 @@
+package push
+
+const (
+	// FCM delivers to android and web devices through firebase cloud
+	// messaging.
+	FCM = "fcm"
+	// APNs delivers to apple devices through the apple push notification
+	// service.
+	APNs = "apns"
+)
+
+// Entity is a push notification sent to every device token of Tokens
+// through Provider.
+type Entity struct {
+	Provider string            `json:"provider" validate:"required,oneof=fcm apns"`
+	Tokens   []string          `json:"tokens" validate:"required,min=1,max=500,dive,required"`
+	Title    string            `json:"title,omitempty" validate:"max=200"`
+	Body     string            `json:"body" validate:"required,max=4000"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// withTokens returns a copy of e sent only to tokens.
+func (e Entity) withTokens(tokens []string) Entity {
+	e.Tokens = tokens
+	return e
+}
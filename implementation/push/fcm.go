@@ -0,0 +1,249 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+	// fcmUnregistered is the fcm error code of a token which is no longer
+	// valid for the app.
+	fcmUnregistered = "UNREGISTERED"
+	// tokenLeeway renews the access token a bit before it expires.
+	tokenLeeway = time.Minute
+)
+
+// serviceAccount is the part of a google service account key file fcm
+// needs to get access tokens.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type fcm struct {
+	baseURL string
+	account serviceAccount
+	key     crypto.Signer
+	client  *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewFCMProvider returns a provider for the fcm HTTP v1 api at baseURL,
+// authenticated with the service account of credentialsFile.
+func NewFCMProvider(baseURL, credentialsFile string, client *http.Client) (PushProvider, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var account serviceAccount
+	if err = json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fcm{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		account: account,
+		key:     key,
+		client:  client,
+	}, nil
+}
+
+func (f *fcm) Name() string {
+	return FCM
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body"`
+}
+
+type fcmResponse struct {
+	Name  string `json:"name"`
+	Error struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// errorCode returns the fcm specific error code, falling back on the
+// canonical google api status.
+func (r *fcmResponse) errorCode() string {
+	for i := range r.Error.Details {
+		if r.Error.Details[i].ErrorCode != "" {
+			return r.Error.Details[i].ErrorCode
+		}
+	}
+
+	return r.Error.Status
+}
+
+func (f *fcm) Send(ctx context.Context, token string, e Entity) (string, error) {
+	accessToken, err := f.accessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(fcmRequest{Message: fcmMessage{
+		Token:        token,
+		Notification: fcmNotification{Title: e.Title, Body: e.Body},
+		Data:         e.Data,
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := f.baseURL + "/v1/projects/" + url.PathEscape(f.account.ProjectID) + "/messages:send"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body fcmResponse
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+
+	_ = json.Unmarshal(data, &body)
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return body.Name, nil
+	}
+
+	// the access token was revoked or expired early, the next attempt
+	// gets a new one
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.resetToken()
+	}
+
+	code := body.errorCode()
+
+	return "", &ProviderError{
+		Status:       resp.StatusCode,
+		Reason:       code,
+		Message:      body.Error.Message,
+		Retryable:    retryableStatus(resp.StatusCode) || resp.StatusCode == http.StatusUnauthorized,
+		Unregistered: code == fcmUnregistered,
+	}
+}
+
+// accessToken returns the cached oauth2 access token, exchanging a signed
+// assertion of the service account for a new one when it expires.
+func (f *fcm) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.token != "" && time.Now().Before(f.expiresAt) {
+		return f.token, nil
+	}
+
+	now := time.Now()
+
+	assertion, err := signJWT(
+		map[string]interface{}{"typ": "JWT"},
+		map[string]interface{}{
+			"iss":   f.account.ClientEmail,
+			"scope": fcmScope,
+			"aud":   f.account.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}, f.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+
+	_ = json.Unmarshal(data, &body)
+
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", &ProviderError{
+			Status:    resp.StatusCode,
+			Reason:    body.Error,
+			Message:   body.Description,
+			Retryable: retryableStatus(resp.StatusCode),
+		}
+	}
+
+	f.token = body.AccessToken
+	f.expiresAt = now.Add(time.Duration(body.ExpiresIn)*time.Second - tokenLeeway)
+
+	return f.token, nil
+}
+
+func (f *fcm) resetToken() {
+	f.mu.Lock()
+	f.token = ""
+	f.mu.Unlock()
+}
@@ -0,0 +1,113 @@
+package push
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+)
+
+var (
+	ErrInvalidKey        = errors.New("push signing key is not a pem encoded rsa or ecdsa private key")
+	ErrUnsupportedSigner = errors.New("push signing key type is not supported")
+)
+
+// algorithm returns the jws alg of key: RS256 for an rsa key and ES256
+// for a P-256 ecdsa key.
+func algorithm(key crypto.Signer) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrUnsupportedSigner
+		}
+
+		return "ES256", nil
+	default:
+		return "", ErrUnsupportedSigner
+	}
+}
+
+// signJWT returns the compact jws of claims, signed RS256 with an rsa key
+// or ES256 with a P-256 ecdsa key. The alg of header is set from the key.
+func signJWT(header, claims map[string]interface{}, key crypto.Signer) (string, error) {
+	alg, err := algorithm(key)
+	if err != nil {
+		return "", err
+	}
+
+	header["alg"] = alg
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+
+		// jws wants r and s as fixed size big endian integers, not asn.1
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+
+	default:
+		return "", ErrUnsupportedSigner
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parsePrivateKey reads a pkcs8, pkcs1 or sec1 pem private key.
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+
+		return nil, ErrUnsupportedSigner
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, ErrInvalidKey
+}
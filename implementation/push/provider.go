@@ -0,0 +1,81 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"notif/pkg/config"
+)
+
+// maxResponseBody bounds how much of a provider response is read.
+const maxResponseBody = 64 << 10
+
+var ErrProviderNotConfigured = errors.New("push provider is not configured")
+
+// PushProvider hands notifications to a push service.
+type PushProvider interface {
+	// Name identifies the provider, it is the provider of the entities
+	// it sends.
+	Name() string
+	// Send delivers e to a single device token and returns the id the
+	// provider gave the message. Failures reported by the provider are
+	// *ProviderError.
+	Send(ctx context.Context, token string, e Entity) (string, error)
+}
+
+// ProviderError is a failure reported by the provider. Unregistered is
+// set when the device token is no longer valid.
+type ProviderError struct {
+	Status       int
+	Reason       string
+	Message      string
+	Retryable    bool
+	Unregistered bool
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("push provider responded with status %d reason %s: %s", e.Status, e.Reason, e.Message)
+}
+
+// retryableStatus tells whether an http status of a provider is worth
+// retrying: rate limits, timeouts and server errors.
+func retryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError ||
+		status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// NewProviders returns the providers configured in cfg by name, it is
+// empty when push is not configured.
+func NewProviders(cfg *config.NotifConfig) (map[string]PushProvider, error) {
+	providers := make(map[string]PushProvider)
+
+	if cfg.PushFcmCredentialsFile != "" {
+		client := &http.Client{Timeout: config.PushTimeOut}
+
+		p, err := NewFCMProvider(cfg.PushFcmBaseURL, cfg.PushFcmCredentialsFile, client)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[FCM] = p
+	}
+
+	if cfg.PushApnsKeyFile != "" {
+		// apns only speaks http/2, which the default transport negotiates
+		// over tls
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		client := &http.Client{Timeout: config.PushTimeOut, Transport: transport}
+
+		p, err := NewAPNsProvider(cfg.PushApnsBaseURL, cfg.PushApnsKeyFile,
+			cfg.PushApnsKeyID, cfg.PushApnsTeamID, cfg.PushApnsTopic, client)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[APNs] = p
+	}
+
+	return providers, nil
+}
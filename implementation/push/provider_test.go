@@ -0,0 +1,203 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"notif/implementation/channel"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func writeKey(t *testing.T, key interface{}) (string, []byte) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, ioutil.WriteFile(path, data, 0o600))
+
+	return path, data
+}
+
+func TestFCMProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	exchanges := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			exchanges++
+
+			require.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+			require.Len(t, strings.Split(r.FormValue("assertion"), "."), 3)
+			_, _ = w.Write([]byte(`{"access_token":"at-1","expires_in":3600}`))
+
+			return
+		}
+
+		require.Equal(t, "/v1/projects/notif-test/messages:send", r.URL.Path)
+		require.Equal(t, "Bearer at-1", r.Header.Get("Authorization"))
+
+		var req fcmRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "Hello", req.Message.Notification.Title)
+		require.Equal(t, "42", req.Message.Data["orderID"])
+
+		switch req.Message.Token {
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","message":"Requested entity was not found.",
+				"details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`))
+		case "busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"code":503,"status":"UNAVAILABLE","message":"try later"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"name":"projects/notif-test/messages/0:1"}`))
+		}
+	}))
+	defer srv.Close()
+
+	_, pemKey := writeKey(t, key)
+	creds, err := json.Marshal(serviceAccount{
+		ProjectID:   "notif-test",
+		ClientEmail: "notif@notif-test.iam.gserviceaccount.com",
+		PrivateKey:  string(pemKey),
+		TokenURI:    srv.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, ioutil.WriteFile(credsFile, creds, 0o600))
+
+	p, err := NewFCMProvider(srv.URL, credsFile, srv.Client())
+	require.NoError(t, err)
+
+	e := Entity{Provider: FCM, Title: "Hello", Body: "your order shipped", Data: map[string]string{"orderID": "42"}}
+
+	id, err := p.Send(context.Background(), "device-1", e)
+	require.NoError(t, err)
+	require.Equal(t, "projects/notif-test/messages/0:1", id)
+
+	ch := NewChannel(NewPushService(zap.NewNop().Sugar(), map[string]PushProvider{FCM: p},
+		trace.NewNoopTracerProvider().Tracer("")))
+
+	e.Tokens = []string{"device-1", "gone", "busy"}
+	require.NoError(t, ch.Validate(e))
+
+	err = ch.Send(context.Background(), e)
+
+	var pErr *channel.PartialError
+	require.ErrorAs(t, err, &pErr)
+	require.Equal(t, []string{"busy"}, pErr.Next.(Entity).Tokens, "only deferred tokens are retried")
+
+	var dErr *channel.DeliveryError
+	require.ErrorAs(t, err, &dErr)
+	require.Equal(t, []string{"gone"}, dErr.Unregistered())
+	require.True(t, channel.IsUnregistered(channel.Failures(err)["gone"]))
+
+	e.Tokens = []string{"gone"}
+	require.True(t, channel.IsPermanent(ch.Send(context.Background(), e)), "unregistered tokens must not be retried")
+	require.Equal(t, 1, exchanges, "the access token is cached")
+
+	e.Provider = APNs
+	require.Error(t, ch.Validate(e), "apns is not configured")
+}
+
+func TestAPNsProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, 2, r.ProtoMajor, "apns requires http/2")
+		require.Equal(t, "com.example.app", r.Header.Get("apns-topic"))
+		require.Equal(t, "alert", r.Header.Get("apns-push-type"))
+		verifyES256(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "bearer "))
+
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		require.Equal(t, "42", payload["orderID"])
+		require.Equal(t, "Hello", payload["aps"].(map[string]interface{})["alert"].(map[string]interface{})["title"])
+
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered","timestamp":1640995200000}`))
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		default:
+			w.Header().Set("apns-id", "EC1BF194-B3B2-424A-89A9-5A918A6E6B5D")
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rsaFile, _ := writeKey(t, rsaKey)
+
+	_, err = NewAPNsProvider(srv.URL, rsaFile, "KEY123", "TEAM123", "com.example.app", srv.Client())
+	require.ErrorIs(t, err, ErrAPNsKey)
+
+	keyFile, _ := writeKey(t, key)
+
+	p, err := NewAPNsProvider(srv.URL, keyFile, "KEY123", "TEAM123", "com.example.app", srv.Client())
+	require.NoError(t, err)
+
+	e := Entity{Provider: APNs, Title: "Hello", Body: "your order shipped", Data: map[string]string{"orderID": "42"}}
+
+	id, err := p.Send(context.Background(), "device-1", e)
+	require.NoError(t, err)
+	require.Equal(t, "EC1BF194-B3B2-424A-89A9-5A918A6E6B5D", id)
+
+	for _, token := range []string{"gone", "bad"} {
+		_, err = p.Send(context.Background(), token, e)
+
+		var pErr *ProviderError
+		require.ErrorAs(t, err, &pErr)
+		require.True(t, pErr.Unregistered, token)
+		require.False(t, pErr.Retryable, token)
+	}
+}
+
+func verifyES256(t *testing.T, pub *ecdsa.PublicKey, token string) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.Len(t, sig, 64)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	require.True(t, ecdsa.Verify(pub, digest[:], r, s), "provider token signature")
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"alg":"ES256","kid":"KEY123"}`, string(header))
+}
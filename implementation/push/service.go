@@ -0,0 +1,115 @@
+// Package push sends mobile push notifications through fcm and apns.
+package push
+
+import (
+	"context"
+
+	"notif/implementation/channel"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	// SendPush delivers e to each of its tokens and fails with a
+	// *channel.DeliveryError when some were not delivered.
+	SendPush(ctx context.Context, e Entity) error
+	// Supports tells whether the provider is configured.
+	Supports(provider string) bool
+}
+
+type service struct {
+	log       *zap.SugaredLogger
+	providers map[string]PushProvider
+	tracer    trace.Tracer
+}
+
+// NewPushService returns a Service sending through the providers, keyed
+// by name.
+func NewPushService(logger *zap.SugaredLogger, providers map[string]PushProvider, t trace.Tracer) Service {
+	return &service{
+		log:       logger,
+		providers: providers,
+		tracer:    t,
+	}
+}
+
+func (s *service) Supports(provider string) bool {
+	_, ok := s.providers[provider]
+	return ok
+}
+
+func (s *service) SendPush(ctx context.Context, e Entity) error {
+	ctx, span := s.tracer.Start(ctx, "sendPush-func")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	span.SetAttributes(
+		attribute.String("push.provider", e.Provider),
+		attribute.Int("push.tokens", len(e.Tokens)),
+	)
+
+	p, ok := s.providers[e.Provider]
+	if !ok {
+		return s.fail(span, traceID, ErrProviderNotConfigured)
+	}
+
+	results := make([]channel.Result, len(e.Tokens))
+	failed := false
+
+	for i := range e.Tokens {
+		results[i] = channel.Result{Recipient: e.Tokens[i], Status: channel.Delivered}
+
+		id, err := p.Send(ctx, e.Tokens[i], e)
+		if err != nil {
+			results[i].Status = classify(err)
+			results[i].Err = err
+			failed = true
+		}
+
+		results[i].MessageID = id
+		s.recordResult(span, traceID, results[i])
+	}
+
+	if failed {
+		return s.fail(span, traceID, &channel.DeliveryError{Results: results})
+	}
+
+	return nil
+}
+
+// recordResult reports the outcome of a token, unregistered tokens are
+// warned about so their owner can stop targeting them.
+func (s *service) recordResult(span trace.Span, traceID string, r channel.Result) {
+	attrs := []attribute.KeyValue{
+		attribute.String("push.token", r.Recipient),
+		attribute.String("push.status", string(r.Status)),
+	}
+
+	switch {
+	case r.Err == nil:
+		attrs = append(attrs, attribute.String("push.message_id", r.MessageID))
+		s.log.Debugw("push delivered", "token", r.Recipient, "messageID", r.MessageID, "traceID", traceID)
+
+	case r.Status == channel.Unregistered:
+		attrs = append(attrs, attribute.String("push.error", r.Err.Error()))
+		s.log.Warnw("device token unregistered", "token", r.Recipient, "error", r.Err, "traceID", traceID)
+
+	default:
+		attrs = append(attrs, attribute.String("push.error", r.Err.Error()))
+		s.log.Warnw("push not delivered", "token", r.Recipient,
+			"status", r.Status, "error", r.Err, "traceID", traceID)
+	}
+
+	span.AddEvent("push.token", trace.WithAttributes(attrs...))
+}
+
+func (s *service) fail(span trace.Span, traceID string, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
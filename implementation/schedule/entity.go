@@ -0,0 +1,117 @@
+package schedule
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"notif/pkg"
+	"notif/pkg/config"
+)
+
+// SendAtHeader carries the time a held notification is due at.
+const SendAtHeader = "Notif-Send-At"
+
+// localLayout is the layout of a sendAt given in the time zone of the
+// request.
+const localLayout = "2006-01-02T15:04:05"
+
+var (
+	ErrAmbiguousSchedule = errors.New("sendAt and delay cannot both be set")
+	ErrInvalidSendAt     = errors.New("sendAt must be RFC 3339, or local time with a timezone")
+	ErrInvalidDelay      = errors.New("delay must be a positive duration like 30m")
+	ErrUnknownTimezone   = errors.New("timezone is not a known IANA time zone")
+	ErrTooFarAhead       = errors.New("notifications cannot be scheduled that far ahead")
+	ErrMissingSchedule   = errors.New("sendAt or delay is required")
+	ErrNotScheduled      = errors.New("notification is not scheduled")
+	ErrAlreadySending    = errors.New("notification is already being sent")
+	ErrScheduleChanged   = errors.New("notification schedule changed meanwhile, try again")
+)
+
+// State is where a held notification is at.
+type State string
+
+const (
+	// Scheduled notifications are held till they are due.
+	Scheduled State = "scheduled"
+	// Sending notifications are due and being published to their channel.
+	Sending State = "sending"
+	// Cancelled notifications are dropped when they come up.
+	Cancelled State = "cancelled"
+)
+
+// When is the due time given on a create or reschedule request: either
+// sendAt, in RFC 3339 or in local time with timezone, or a delay from now.
+type When struct {
+	SendAt   string `json:"sendAt,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Delay    string `json:"delay,omitempty"`
+}
+
+// Time returns the due time of w, zero when it holds none.
+func (w When) Time(now time.Time) (time.Time, error) {
+	var at time.Time
+
+	switch {
+	case w.SendAt != "" && w.Delay != "":
+		return time.Time{}, badRequest(ErrAmbiguousSchedule)
+
+	case w.Delay != "":
+		d, err := time.ParseDuration(w.Delay)
+		if err != nil || d < 0 {
+			return time.Time{}, badRequest(ErrInvalidDelay)
+		}
+
+		at = now.Add(d)
+
+	case w.SendAt != "" && w.Timezone != "":
+		loc, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return time.Time{}, badRequest(ErrUnknownTimezone)
+		}
+
+		if at, err = time.ParseInLocation(localLayout, strings.TrimSuffix(w.SendAt, "Z"), loc); err != nil {
+			return time.Time{}, badRequest(ErrInvalidSendAt)
+		}
+
+	case w.SendAt != "":
+		var err error
+		if at, err = time.Parse(time.RFC3339, w.SendAt); err != nil {
+			return time.Time{}, badRequest(ErrInvalidSendAt)
+		}
+
+	default:
+		return time.Time{}, nil
+	}
+
+	if at.Sub(now) > config.ScheduleMaxAhead {
+		return time.Time{}, badRequest(ErrTooFarAhead)
+	}
+
+	return at.UTC(), nil
+}
+
+// Entry is the schedule of a held notification, kept in the
+// NOTIF_SCHEDULES bucket under its id.
+type Entry struct {
+	ID      string    `json:"id"`
+	Channel string    `json:"channel"`
+	SendAt  time.Time `json:"sendAt"`
+	State   State     `json:"state"`
+	// Seq is the sequence of the held msg in the NOTIFS_SCHEDULED stream,
+	// a msg of another sequence was rescheduled and is dropped.
+	Seq uint64 `json:"seq"`
+}
+
+// subject returns the subject a notification of ch is held on.
+func subject(ch, id string) string {
+	return config.ScheduleStreamName + "." + ch + "." + id
+}
+
+func badRequest(err error) error {
+	return pkg.NotifErr{
+		Code: http.StatusBadRequest,
+		Err:  err,
+	}
+}
@@ -0,0 +1,41 @@
+package schedule
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"notif/pkg"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhen(t *testing.T) {
+	now := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		when When
+		want time.Time
+		err  error
+	}{
+		{when: When{}},
+		{when: When{Delay: "30m"}, want: now.Add(30 * time.Minute)},
+		{when: When{SendAt: "2022-03-01T09:00:00+01:00"}, want: time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{when: When{SendAt: "2022-03-01T09:00:00", Timezone: "Asia/Kolkata"}, want: time.Date(2022, 3, 1, 3, 30, 0, 0, time.UTC)},
+		{when: When{SendAt: "2022-03-01T09:00:00", Delay: "30m"}, err: ErrAmbiguousSchedule},
+		{when: When{Delay: "-1m"}, err: ErrInvalidDelay},
+		{when: When{Delay: "tomorrow"}, err: ErrInvalidDelay},
+		{when: When{SendAt: "2022-03-01 09:00"}, err: ErrInvalidSendAt},
+		{when: When{SendAt: "2022-03-01T09:00:00", Timezone: "Mars/Olympus"}, err: ErrUnknownTimezone},
+		{when: When{Delay: "1000h"}, err: ErrTooFarAhead},
+	} {
+		at, err := tc.when.Time(now)
+		if tc.err != nil {
+			require.Equal(t, pkg.NotifErr{Code: http.StatusBadRequest, Err: tc.err}, err, tc.when)
+			continue
+		}
+
+		require.NoError(t, err, tc.when)
+		require.True(t, tc.want.Equal(at), "%v: got %v", tc.when, at)
+	}
+}
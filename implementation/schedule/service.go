@@ -0,0 +1,429 @@
+// Package schedule holds the notifications to send later in the
+// NOTIFS_SCHEDULED stream and publishes them to their channel once due.
+// Every held notification has an Entry in the NOTIF_SCHEDULES bucket,
+// which cancelling and rescheduling change.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"github.com/avast/retry-go"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	// Hold keeps msg, published for the channel of its subject, till
+	// sendAt.
+	Hold(ctx context.Context, id string, msg *nats.Msg, sendAt time.Time) (Entry, error)
+	// Cancel drops the held notification id.
+	Cancel(ctx context.Context, id string) (Entry, error)
+	// Reschedule moves the due time of the held notification id to sendAt.
+	Reschedule(ctx context.Context, id string, sendAt time.Time) (Entry, error)
+	// Run publishes the held notifications once due till ctx is done, and
+	// marks wg done once returned. It is added to wg before it is started.
+	Run(ctx context.Context, wg *sync.WaitGroup)
+}
+
+type service struct {
+	js     nats.JetStreamContext
+	kv     nats.KeyValue
+	log    *zap.SugaredLogger
+	tracer trace.Tracer
+}
+
+// NewScheduleService returns a Service over the NOTIFS_SCHEDULED stream
+// and the schedules of kv.
+func NewScheduleService(l *zap.SugaredLogger, js nats.JetStreamContext, kv nats.KeyValue, t trace.Tracer) Service {
+	return &service{
+		js:     js,
+		kv:     kv,
+		log:    l,
+		tracer: t,
+	}
+}
+
+func (s *service) Hold(ctx context.Context, id string, msg *nats.Msg, sendAt time.Time) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "schedule.svc-hold")
+	defer span.End()
+
+	name, err := channel.NameFromSubject(msg.Subject)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	span.SetAttributes(
+		attribute.String("notif.id", id),
+		attribute.String("notif.channel", name),
+		attribute.String("notif.send_at", sendAt.Format(time.RFC3339)),
+	)
+
+	// the entry is created first so the held msg never comes up without
+	// one, its sequence is recorded once published
+	e := Entry{ID: id, Channel: name, SendAt: sendAt, State: Scheduled}
+
+	rev, err := s.put(e, 0)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	header := make(nats.Header, len(msg.Header)+1)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+
+	header.Set(SendAtHeader, sendAt.Format(time.RFC3339Nano))
+
+	pubAck, err := s.js.PublishMsg(&nats.Msg{
+		Subject: subject(name, id),
+		Header:  header,
+		Data:    msg.Data,
+	})
+	if err != nil {
+		if dErr := s.kv.Delete(id); dErr != nil {
+			s.log.Warnf("deleting schedule of %s failed: %v", id, dErr)
+		}
+
+		return Entry{}, s.fail(span, err)
+	}
+
+	// cancel and reschedule find the held msg by its sequence, and the
+	// msg is naked forever while the entry has none, so the msg and the
+	// entry are dropped when it cannot be recorded
+	e.Seq = pubAck.Sequence
+	if err = retry.Do(func() error {
+		_, pErr := s.put(e, rev)
+		return pErr
+	}, retry.Attempts(config.ScheduleRecordAttempts),
+		retry.Delay(config.ScheduleRecordDelay),
+		retry.LastErrorOnly(true),
+	); err != nil {
+		if dErr := s.js.DeleteMsg(config.ScheduleStreamName, e.Seq); dErr != nil {
+			s.log.Warnf("deleting held notification %s failed: %v", id, dErr)
+		}
+
+		if dErr := s.kv.Delete(id); dErr != nil {
+			s.log.Warnf("deleting schedule of %s failed: %v", id, dErr)
+		}
+
+		return Entry{}, s.fail(span, err)
+	}
+
+	return e, nil
+}
+
+func (s *service) Cancel(ctx context.Context, id string) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "schedule.svc-cancel")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.id", id))
+
+	e, rev, err := s.scheduled(id)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	// the consumer claims the entry the same way before sending it
+	e.State = Cancelled
+	if _, err = s.put(e, rev); err != nil {
+		return Entry{}, s.fail(span, s.conflict(id, rev, err))
+	}
+
+	// a held msg left behind is dropped when it comes up
+	if err = s.js.DeleteMsg(config.ScheduleStreamName, e.Seq); err != nil {
+		s.log.Warnf("deleting held notification %s failed: %v", id, err)
+		return e, nil
+	}
+
+	if err = s.kv.Delete(id); err != nil {
+		s.log.Warnf("deleting schedule of %s failed: %v", id, err)
+	}
+
+	return e, nil
+}
+
+func (s *service) Reschedule(ctx context.Context, id string, sendAt time.Time) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "schedule.svc-reschedule")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("notif.id", id),
+		attribute.String("notif.send_at", sendAt.Format(time.RFC3339)),
+	)
+
+	e, rev, err := s.scheduled(id)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	// a msg cannot be delayed again once naked, so a copy is held for the
+	// new time and the old one dropped
+	old, err := s.js.GetMsg(config.ScheduleStreamName, e.Seq)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	old.Header.Set(SendAtHeader, sendAt.Format(time.RFC3339Nano))
+
+	pubAck, err := s.js.PublishMsg(&nats.Msg{
+		Subject: old.Subject,
+		Header:  old.Header,
+		Data:    old.Data,
+	})
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	oldSeq := e.Seq
+	e.SendAt, e.Seq = sendAt, pubAck.Sequence
+
+	if _, err = s.put(e, rev); err != nil {
+		if dErr := s.js.DeleteMsg(config.ScheduleStreamName, pubAck.Sequence); dErr != nil {
+			s.log.Warnf("deleting held copy of %s failed: %v", id, dErr)
+		}
+
+		return Entry{}, s.fail(span, s.conflict(id, rev, err))
+	}
+
+	// the old msg no longer matches the entry and is dropped anyway
+	if err = s.js.DeleteMsg(config.ScheduleStreamName, oldSeq); err != nil {
+		s.log.Warnf("deleting rescheduled notification %s failed: %v", id, err)
+	}
+
+	return e, nil
+}
+
+func (s *service) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	subj := config.ScheduleStreamName + ".>"
+	durableName := config.ScheduleStreamName + "_pullSub"
+
+	// every held msg is naked till due, so it is delivered any number of
+	// times and stays pending meanwhile
+	sub, err := s.js.PullSubscribe(subj, durableName,
+		nats.AckExplicit(),
+		nats.AckWait(config.NatsAckWait),
+		nats.MaxDeliver(-1),
+		nats.MaxAckPending(-1),
+	)
+	if err != nil {
+		s.log.Errorf("subcribing to stream: %s failed with err: %v", config.ScheduleStreamName, err)
+		return
+	}
+
+	s.log.Infof("subscriber added to stream : %s of name: %s", config.ScheduleStreamName, durableName)
+
+	for ctx.Err() == nil {
+		msgs, err := sub.Fetch(config.ScheduleBatchSize, nats.MaxWait(config.NatsSubMaxWait))
+		if err != nil && !errors.Is(err, nats.ErrTimeout) {
+			s.log.Errorf("failed to fetch held msgs in batch:%v", err)
+		}
+
+		// checking the due time only takes a kv lookup, so the batch is
+		// handled in turn
+		for i := range msgs {
+			s.due(ctx, msgs[i], time.Now())
+		}
+	}
+}
+
+// due publishes msg to its channel when its entry is due, drops it when
+// it was cancelled or rescheduled and naks it till due otherwise.
+func (s *service) due(ctx context.Context, msg *nats.Msg, now time.Time) {
+	id := msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+
+	kve, err := s.kv.Get(id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		s.settle(msg, msg.Ack())
+		return
+	}
+
+	if err != nil {
+		s.log.Errorf("getting schedule of %s failed: %v", id, err)
+		s.settle(msg, msg.NakWithDelay(config.ScheduleRetryDelay))
+
+		return
+	}
+
+	var e Entry
+	if err = json.Unmarshal(kve.Value(), &e); err != nil {
+		s.log.Errorf("decoding schedule of %s failed: %v", id, err)
+		s.settle(msg, msg.Term())
+
+		return
+	}
+
+	var seq uint64
+	if meta, mErr := msg.Metadata(); mErr == nil {
+		seq = meta.Sequence.Stream
+	}
+
+	switch {
+	case e.State == Cancelled:
+		if err = s.kv.Delete(id); err != nil {
+			s.log.Warnf("deleting schedule of %s failed: %v", id, err)
+		}
+
+		s.settle(msg, msg.Ack())
+
+	case seq < e.Seq:
+		// superseded by the copy of a reschedule
+		s.settle(msg, msg.Ack())
+
+	case seq > e.Seq:
+		// held or rescheduled right now, its sequence is not recorded yet
+		s.settle(msg, msg.NakWithDelay(config.ScheduleRetryDelay))
+
+	case e.State == Scheduled && now.Before(e.SendAt):
+		s.settle(msg, msg.NakWithDelay(e.SendAt.Sub(now)))
+
+	default:
+		if err = s.send(ctx, msg, e, kve.Revision()); err != nil {
+			s.log.Errorf("sending held notification %s failed: %v", id, err)
+			s.settle(msg, msg.NakWithDelay(config.ScheduleRetryDelay))
+
+			return
+		}
+
+		s.settle(msg, msg.Ack())
+	}
+}
+
+// send claims the entry, so it can no longer be cancelled, and publishes
+// the held notification to its channel. An entry claimed already was
+// left by a crash before the ack and is sent again.
+func (s *service) send(ctx context.Context, msg *nats.Msg, e Entry, rev uint64) error {
+	_, span := s.tracer.Start(ctx, "schedule.svc-send")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("notif.id", e.ID),
+		attribute.String("notif.channel", e.Channel),
+	)
+
+	if e.State != Sending {
+		e.State = Sending
+		if _, err := s.put(e, rev); err != nil {
+			return s.fail(span, err)
+		}
+	}
+
+	header := make(nats.Header, len(msg.Header))
+	for k, v := range msg.Header {
+		if k != SendAtHeader {
+			header[k] = v
+		}
+	}
+
+	if _, err := s.js.PublishMsg(&nats.Msg{
+		Subject: channel.Subject(e.Channel),
+		Header:  header,
+		Data:    msg.Data,
+	}); err != nil {
+		return s.fail(span, err)
+	}
+
+	if err := s.kv.Delete(e.ID); err != nil {
+		s.log.Warnf("deleting schedule of %s failed: %v", e.ID, err)
+	}
+
+	return nil
+}
+
+// scheduled returns the entry of id and its revision, failing when it is
+// not held anymore or being sent.
+func (s *service) scheduled(id string) (Entry, uint64, error) {
+	kve, err := s.kv.Get(id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Entry{}, 0, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  ErrNotScheduled,
+		}
+	}
+
+	if err != nil {
+		return Entry{}, 0, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(kve.Value(), &e); err != nil {
+		return Entry{}, 0, err
+	}
+
+	switch {
+	case e.State == Cancelled:
+		return Entry{}, 0, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  ErrNotScheduled,
+		}
+
+	case e.State == Sending:
+		return Entry{}, 0, pkg.NotifErr{
+			Code: http.StatusConflict,
+			Err:  ErrAlreadySending,
+		}
+
+	case e.Seq == 0:
+		return Entry{}, 0, pkg.NotifErr{
+			Code: http.StatusConflict,
+			Err:  ErrScheduleChanged,
+		}
+	}
+
+	return e, kve.Revision(), nil
+}
+
+// put writes e over revision rev of its entry, rev 0 creates it.
+func (s *service) put(e Entry, rev uint64) (uint64, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	if rev == 0 {
+		return s.kv.Create(e.ID, data)
+	}
+
+	return s.kv.Update(e.ID, data, rev)
+}
+
+// conflict tells a write rejected because the entry of id moved past rev
+// from any other failure.
+func (s *service) conflict(id string, rev uint64, err error) error {
+	if kve, gErr := s.kv.Get(id); gErr == nil && kve.Revision() != rev {
+		return pkg.NotifErr{
+			Code: http.StatusConflict,
+			Err:  ErrScheduleChanged,
+		}
+	}
+
+	return err
+}
+
+func (s *service) settle(msg *nats.Msg, err error) {
+	if err != nil {
+		s.log.Errorf("settling held msg %s failed: %v", msg.Subject, err)
+	}
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,251 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+	"notif/pkg/config"
+	natshelper "notif/pkg/nats"
+	"notif/pkg/nats/natstest"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T) (*service, nats.JetStreamContext) {
+	t.Helper()
+
+	_, js := natstest.RunJetStream(t)
+	log := zap.NewNop().Sugar()
+
+	require.NoError(t, natshelper.CreateStream(js, 0, log))
+	require.NoError(t, natshelper.CreateScheduleStream(js, log))
+
+	kv, err := natshelper.CreateKeyValue(js, config.ScheduleBucket, "notification schedules", 0, log)
+	require.NoError(t, err)
+
+	svc := NewScheduleService(log, js, kv, trace.NewNoopTracerProvider().Tracer(""))
+
+	return svc.(*service), js
+}
+
+func newMsg() *nats.Msg {
+	return &nats.Msg{
+		Subject: channel.Subject("email"),
+		Header:  nats.Header{"Notif-Id": []string{"n1"}},
+		Data:    []byte(`{"subject":"hi"}`),
+	}
+}
+
+// held returns the msgs of the NOTIFS_SCHEDULED stream.
+func held(t *testing.T, js nats.JetStreamContext) uint64 {
+	t.Helper()
+
+	info, err := js.StreamInfo(config.ScheduleStreamName)
+	require.NoError(t, err)
+
+	return info.State.Msgs
+}
+
+// fetch returns the next held msg as delivered to the scheduler.
+func fetch(t *testing.T, js nats.JetStreamContext) *nats.Msg {
+	t.Helper()
+
+	sub, err := js.PullSubscribe(config.ScheduleStreamName+".>", config.ScheduleStreamName+"_pullSub",
+		nats.AckExplicit(), nats.MaxDeliver(-1))
+	require.NoError(t, err)
+
+	msgs, err := sub.Fetch(1, nats.MaxWait(time.Second))
+	require.NoError(t, err)
+
+	return msgs[0]
+}
+
+func requireStatus(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var pErr pkg.Error
+	require.ErrorAs(t, err, &pErr)
+	require.Equal(t, code, pErr.Status())
+}
+
+func TestHold(t *testing.T) {
+	s, js := newTestService(t)
+	ctx := context.Background()
+	sendAt := time.Now().Add(time.Hour).UTC()
+
+	e, err := s.Hold(ctx, "n1", newMsg(), sendAt)
+	require.NoError(t, err)
+	require.Equal(t, Entry{ID: "n1", Channel: "email", SendAt: sendAt, State: Scheduled, Seq: 1}, e)
+
+	m, err := js.GetMsg(config.ScheduleStreamName, e.Seq)
+	require.NoError(t, err)
+	require.Equal(t, subject("email", "n1"), m.Subject)
+	require.Equal(t, sendAt.Format(time.RFC3339Nano), m.Header.Get(SendAtHeader))
+
+	_, err = s.Hold(ctx, "n1", newMsg(), sendAt)
+	require.Error(t, err, "an id is held once")
+}
+
+// failingUpdates fails every update of its bucket.
+type failingUpdates struct {
+	nats.KeyValue
+}
+
+func (failingUpdates) Update(string, []byte, uint64) (uint64, error) {
+	return 0, errors.New("nats: timeout")
+}
+
+func TestHoldDropsUnrecorded(t *testing.T) {
+	s, js := newTestService(t)
+	kv := s.kv
+	s.kv = failingUpdates{kv}
+
+	_, err := s.Hold(context.Background(), "n1", newMsg(), time.Now().Add(time.Hour))
+	require.Error(t, err)
+
+	require.Zero(t, held(t, js), "the held msg is dropped")
+
+	_, err = kv.Get("n1")
+	require.ErrorIs(t, err, nats.ErrKeyNotFound)
+}
+
+func TestCancel(t *testing.T) {
+	s, js := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Hold(ctx, "n1", newMsg(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	e, err := s.Cancel(ctx, "n1")
+	require.NoError(t, err)
+	require.Equal(t, Cancelled, e.State)
+	require.Zero(t, held(t, js))
+
+	_, err = s.Cancel(ctx, "n1")
+	requireStatus(t, err, http.StatusNotFound)
+
+	_, err = s.Reschedule(ctx, "n1", time.Now().Add(time.Hour))
+	requireStatus(t, err, http.StatusNotFound)
+}
+
+func TestReschedule(t *testing.T) {
+	s, js := newTestService(t)
+	ctx := context.Background()
+	sendAt := time.Now().Add(2 * time.Hour).UTC()
+
+	old, err := s.Hold(ctx, "n1", newMsg(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	e, err := s.Reschedule(ctx, "n1", sendAt)
+	require.NoError(t, err)
+	require.Equal(t, sendAt, e.SendAt)
+	require.Greater(t, e.Seq, old.Seq)
+
+	_, err = js.GetMsg(config.ScheduleStreamName, old.Seq)
+	require.ErrorIs(t, err, nats.ErrMsgNotFound, "the old msg is dropped")
+
+	m, err := js.GetMsg(config.ScheduleStreamName, e.Seq)
+	require.NoError(t, err)
+	require.Equal(t, sendAt.Format(time.RFC3339Nano), m.Header.Get(SendAtHeader))
+	require.Equal(t, "n1", m.Header.Get("Notif-Id"))
+}
+
+func TestDue(t *testing.T) {
+	s, js := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := s.Hold(ctx, "n1", newMsg(), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// due, the msg goes to its channel without its due time
+	s.due(ctx, fetch(t, js), now.Add(time.Hour))
+
+	info, err := js.StreamInfo(config.StreamName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), info.State.Msgs)
+
+	m, err := js.GetMsg(config.StreamName, info.State.LastSeq)
+	require.NoError(t, err)
+	require.Equal(t, channel.Subject("email"), m.Subject)
+	require.Empty(t, m.Header.Get(SendAtHeader))
+	require.Equal(t, "n1", m.Header.Get("Notif-Id"))
+
+	_, err = s.kv.Get("n1")
+	require.ErrorIs(t, err, nats.ErrKeyNotFound)
+	require.Eventually(t, func() bool { return held(t, js) == 0 }, time.Second, 10*time.Millisecond)
+
+	// not due yet, the msg and its entry are kept
+	_, err = s.Hold(ctx, "n2", newMsg(), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	s.due(ctx, fetch(t, js), now)
+	require.Equal(t, uint64(1), held(t, js))
+
+	_, err = s.kv.Get("n2")
+	require.NoError(t, err)
+}
+
+func TestDueDropsStale(t *testing.T) {
+	s, js := newTestService(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := s.Hold(ctx, "n1", newMsg(), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	stale := fetch(t, js)
+
+	// the copy of a reschedule supersedes the msg fetched before
+	_, err = s.Reschedule(ctx, "n1", now.Add(time.Minute))
+	require.NoError(t, err)
+
+	s.due(ctx, stale, now.Add(time.Hour))
+
+	info, err := js.StreamInfo(config.StreamName)
+	require.NoError(t, err)
+	require.Zero(t, info.State.Msgs, "a superseded msg is not sent")
+
+	_, err = s.kv.Get("n1")
+	require.NoError(t, err, "the rescheduled entry is kept")
+}
+
+func TestRun(t *testing.T) {
+	defer func(wait time.Duration) { config.NatsSubMaxWait = wait }(config.NatsSubMaxWait)
+	config.NatsSubMaxWait = 100 * time.Millisecond
+
+	s, js := newTestService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+
+	_, err := s.Hold(ctx, "n1", newMsg(), time.Now().Add(200*time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = s.Hold(ctx, "n2", newMsg(), time.Now().Add(200*time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = s.Cancel(ctx, "n2")
+	require.NoError(t, err)
+
+	wg.Add(1)
+
+	go s.Run(ctx, wg)
+
+	require.Eventually(t, func() bool {
+		info, err := js.StreamInfo(config.StreamName)
+		return err == nil && info.State.Msgs == 1
+	}, 5*time.Second, 50*time.Millisecond, "only the notification left is sent once due")
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,96 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ChannelName is the channel token of sms notifications.
+const ChannelName = "sms"
+
+var ErrNotAnEntity = errors.New("notification is not an sms entity")
+
+type smsChannel struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+// NewChannel returns the sms notification channel sending through svc.
+func NewChannel(svc Service) channel.Channel {
+	return &smsChannel{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+func (c *smsChannel) Name() string {
+	return ChannelName
+}
+
+func (c *smsChannel) Decode(data []byte) (interface{}, error) {
+	var e Entity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return e, nil
+}
+
+// Recipients returns the phone number the entity is sent to.
+func (c *smsChannel) Recipients(n interface{}) []string {
+	e, ok := n.(Entity)
+	if !ok {
+		return nil
+	}
+
+	return []string{e.To}
+}
+
+// Validate checks the phone numbers are E.164.
+func (c *smsChannel) Validate(n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return ErrNotAnEntity
+	}
+
+	if err := c.validate.Struct(e); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
+
+func (c *smsChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+// Send delivers the message, the provider errors it does not flag as
+// retryable are permanent.
+func (c *smsChannel) Send(ctx context.Context, n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return channel.Permanent(ErrNotAnEntity)
+	}
+
+	err := c.svc.SendSMS(ctx, e)
+
+	var pErr *ProviderError
+	if errors.As(err, &pErr) && !pErr.Retryable {
+		return channel.Permanent(err)
+	}
+
+	return err
+}
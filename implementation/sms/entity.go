@@ -0,0 +1,9 @@
+package sms
+
+// Entity is a text message to a phone number in E.164 format. From
+// overrides the configured sender number.
+type Entity struct {
+	To   string `json:"to" validate:"required,e164"`
+	From string `json:"from,omitempty" validate:"omitempty,e164"`
+	Body string `json:"body" validate:"required,max=1600"`
+}
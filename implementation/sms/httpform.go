@@ -0,0 +1,82 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxResponseBody bounds how much of a provider response is read.
+const maxResponseBody = 64 << 10
+
+type httpForm struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPFormProvider returns a provider POSTing the to, from and body
+// form fields to url, with token as bearer when set. A 2xx response may
+// return the message id as {"id": "..."}.
+func NewHTTPFormProvider(url, token string, client *http.Client) SMSProvider {
+	return &httpForm{
+		url:    url,
+		token:  token,
+		client: client,
+	}
+}
+
+func (h *httpForm) Name() string {
+	return HTTPForm
+}
+
+func (h *httpForm) Send(ctx context.Context, e Entity) (string, error) {
+	form := url.Values{}
+	form.Set("to", e.To)
+	form.Set("from", e.From)
+	form.Set("body", e.Body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", &ProviderError{
+			Status:    resp.StatusCode,
+			Code:      strconv.Itoa(resp.StatusCode),
+			Message:   string(data),
+			Retryable: retryableStatus(resp.StatusCode),
+		}
+	}
+
+	var body struct {
+		ID string `json:"id"`
+	}
+
+	// the id is optional so a body that is not json is fine
+	_ = json.Unmarshal(data, &body)
+
+	return body.ID, nil
+}
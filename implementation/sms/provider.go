@@ -0,0 +1,74 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"notif/pkg/config"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown sms provider")
+	ErrNoSender        = errors.New("SMS_FROM must be set to send sms")
+)
+
+const (
+	// Twilio is the SMS_PROVIDER value of the twilio provider.
+	Twilio = "twilio"
+	// HTTPForm is the SMS_PROVIDER value of the generic http form provider.
+	HTTPForm = "http"
+)
+
+// SMSProvider hands messages to an sms gateway.
+type SMSProvider interface {
+	// Name identifies the provider in logs and traces.
+	Name() string
+	// Send delivers the message and returns the id the provider gave it.
+	// Failures reported by the provider are *ProviderError.
+	Send(ctx context.Context, e Entity) (string, error)
+}
+
+// ProviderError is a failure reported by the provider.
+type ProviderError struct {
+	Status    int
+	Code      string
+	Message   string
+	Retryable bool
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("sms provider responded with status %d code %s: %s", e.Status, e.Code, e.Message)
+}
+
+// retryableStatus tells whether an http status of a provider is worth
+// retrying: rate limits, timeouts and server errors.
+func retryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError ||
+		status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// NewProvider returns the provider selected by SMS_PROVIDER, or nil when
+// sms is not configured. A provider needs the SMS_FROM sender.
+func NewProvider(cfg *config.NotifConfig) (SMSProvider, error) {
+	client := &http.Client{Timeout: config.SmsTimeOut}
+
+	if cfg.SmsProvider != "" && cfg.SmsFrom == "" {
+		return nil, ErrNoSender
+	}
+
+	switch cfg.SmsProvider {
+	case "":
+		return nil, nil
+
+	case Twilio:
+		return NewTwilioProvider(cfg.SmsTwilioBaseURL, cfg.SmsTwilioAccountSID, cfg.SmsTwilioAuthToken, client), nil
+
+	case HTTPForm:
+		return NewHTTPFormProvider(cfg.SmsHTTPURL, cfg.SmsHTTPToken, client), nil
+
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
@@ -0,0 +1,105 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"notif/implementation/channel"
+	"notif/pkg/config"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestTwilioProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/2010-04-01/Accounts/AC1/Messages.json", r.URL.Path)
+
+		user, pass, _ := r.BasicAuth()
+		require.Equal(t, "AC1", user)
+		require.Equal(t, "token", pass)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.FormValue("To") {
+		case "+15005550001":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":21211,"message":"invalid To number"}`))
+		case "+15005550002":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"code":20429,"message":"too many requests"}`))
+		default:
+			require.Equal(t, "+15005550006", r.FormValue("From"))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"sid":"SM123"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewTwilioProvider(srv.URL, "AC1", "token", srv.Client())
+
+	id, err := p.Send(context.Background(), Entity{To: "+14155550100", From: "+15005550006", Body: "hi"})
+	require.NoError(t, err)
+	require.Equal(t, "SM123", id)
+
+	ch := NewChannel(NewSMSService(zap.NewNop().Sugar(), p, "+15005550006", trace.NewNoopTracerProvider().Tracer("")))
+
+	err = ch.Send(context.Background(), Entity{To: "+15005550001", Body: "hi"})
+	require.True(t, channel.IsPermanent(err), "invalid numbers must not be retried")
+
+	err = ch.Send(context.Background(), Entity{To: "+15005550002", Body: "hi"})
+	require.Error(t, err)
+	require.False(t, channel.IsPermanent(err), "rate limits must be retried")
+}
+
+func TestHTTPFormProvider(t *testing.T) {
+	status := http.StatusOK
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.Equal(t, "+14155550100", r.FormValue("to"))
+		require.Equal(t, "hello", r.FormValue("body"))
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"id":"msg-1"}`))
+	}))
+	defer srv.Close()
+
+	p := NewHTTPFormProvider(srv.URL, "secret", srv.Client())
+
+	id, err := p.Send(context.Background(), Entity{To: "+14155550100", Body: "hello"})
+	require.NoError(t, err)
+	require.Equal(t, "msg-1", id)
+
+	status = http.StatusBadGateway
+	_, err = p.Send(context.Background(), Entity{To: "+14155550100", Body: "hello"})
+
+	var pErr *ProviderError
+	require.ErrorAs(t, err, &pErr)
+	require.True(t, pErr.Retryable)
+}
+
+func TestValidateE164(t *testing.T) {
+	ch := NewChannel(nil)
+
+	require.NoError(t, ch.Validate(Entity{To: "+14155550100", Body: "hi"}))
+	require.Error(t, ch.Validate(Entity{To: "4155550100", Body: "hi"}))
+	require.Error(t, ch.Validate(Entity{To: "+14155550100", From: "sender", Body: "hi"}))
+	require.Error(t, ch.Validate(Entity{To: "+14155550100"}))
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(&config.NotifConfig{})
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	_, err = NewProvider(&config.NotifConfig{SmsProvider: Twilio})
+	require.ErrorIs(t, err, ErrNoSender)
+
+	p, err = NewProvider(&config.NotifConfig{SmsProvider: Twilio, SmsFrom: "+15550100"})
+	require.NoError(t, err)
+	require.Equal(t, Twilio, p.Name())
+}
@@ -0,0 +1,67 @@
+package sms
+
+import "unicode/utf16"
+
+// Encoding is the character set a message is sent with.
+type Encoding string
+
+const (
+	GSM7 Encoding = "GSM-7"
+	UCS2 Encoding = "UCS-2"
+)
+
+const (
+	gsm7Single      = 160
+	gsm7Concatenate = 153
+	ucs2Single      = 70
+	ucs2Concatenate = 67
+)
+
+// gsm7Basic is the GSM 03.38 basic character set.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds the characters sent with an escape, so they take
+// two septets.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+var gsm7Septets = func() map[rune]int {
+	m := make(map[rune]int)
+	for _, r := range gsm7Basic {
+		m[r] = 1
+	}
+
+	for _, r := range gsm7Extension {
+		m[r] = 2
+	}
+
+	return m
+}()
+
+// Segments returns the encoding a message needs and the number of
+// segments it is split in. Messages fitting GSM-7 use 7 bit septets, any
+// other character switches the whole message to UCS-2.
+func Segments(body string) (Encoding, int) {
+	septets := 0
+
+	for _, r := range body {
+		n, ok := gsm7Septets[r]
+		if !ok {
+			return UCS2, count(len(utf16.Encode([]rune(body))), ucs2Single, ucs2Concatenate)
+		}
+
+		septets += n
+	}
+
+	return GSM7, count(septets, gsm7Single, gsm7Concatenate)
+}
+
+// count splits units in segments, concatenated segments lose room to the
+// user data header.
+func count(units, single, concatenated int) int {
+	if units <= single {
+		return 1
+	}
+
+	return (units + concatenated - 1) / concatenated
+}
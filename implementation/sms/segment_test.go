@@ -0,0 +1,36 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegments(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		body     string
+		encoding Encoding
+		segments int
+	}{
+		{desc: "short gsm", body: "Your code is 1234", encoding: GSM7, segments: 1},
+		{desc: "full gsm segment", body: strings.Repeat("a", 160), encoding: GSM7, segments: 1},
+		{desc: "concatenated gsm", body: strings.Repeat("a", 161), encoding: GSM7, segments: 2},
+		{desc: "extension takes two septets", body: strings.Repeat("€", 80), encoding: GSM7, segments: 1},
+		{desc: "extension overflows", body: strings.Repeat("€", 81), encoding: GSM7, segments: 2},
+		{desc: "short ucs2", body: "Привет", encoding: UCS2, segments: 1},
+		{desc: "full ucs2 segment", body: strings.Repeat("ж", 70), encoding: UCS2, segments: 1},
+		{desc: "concatenated ucs2", body: strings.Repeat("ж", 71), encoding: UCS2, segments: 2},
+		{desc: "surrogate pairs take two units", body: strings.Repeat("😀", 35), encoding: UCS2, segments: 1},
+		{desc: "one char forces ucs2", body: strings.Repeat("a", 100) + "ж", encoding: UCS2, segments: 2},
+	}
+
+	for i := range testCases {
+		t.Run(testCases[i].desc, func(t *testing.T) {
+			encoding, segments := Segments(testCases[i].body)
+			require.Equal(t, testCases[i].encoding, encoding)
+			require.Equal(t, testCases[i].segments, segments)
+		})
+	}
+}
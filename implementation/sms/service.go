@@ -0,0 +1,66 @@
+// Package sms sends text messages through a pluggable SMSProvider.
+package sms
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	SendSMS(ctx context.Context, e Entity) error
+}
+
+type service struct {
+	log      *zap.SugaredLogger
+	provider SMSProvider
+	from     string
+	tracer   trace.Tracer
+}
+
+// NewSMSService returns a Service sending through provider, from is the
+// sender number of the messages which do not set one.
+func NewSMSService(logger *zap.SugaredLogger, provider SMSProvider, from string, t trace.Tracer) Service {
+	return &service{
+		log:      logger,
+		provider: provider,
+		from:     from,
+		tracer:   t,
+	}
+}
+
+func (s *service) SendSMS(ctx context.Context, e Entity) error {
+	ctx, span := s.tracer.Start(ctx, "sendSMS-func")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+
+	if e.From == "" {
+		e.From = s.from
+	}
+
+	encoding, segments := Segments(e.Body)
+	span.SetAttributes(
+		attribute.String("sms.provider", s.provider.Name()),
+		attribute.String("sms.encoding", string(encoding)),
+		attribute.Int("sms.segments", segments),
+	)
+
+	id, err := s.provider.Send(ctx, e)
+	if err != nil {
+		s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return err
+	}
+
+	span.SetAttributes(attribute.String("sms.message_id", id))
+	s.log.Debugw("sms sent", "provider", s.provider.Name(), "messageID", id,
+		"segments", segments, "traceID", traceID)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// twilioQueueOverflow is the twilio error code of a full sending queue,
+// the message may succeed later.
+const twilioQueueOverflow = 30001
+
+type twilio struct {
+	baseURL    string
+	accountSID string
+	authToken  string
+	client     *http.Client
+}
+
+// NewTwilioProvider returns a provider for the twilio Messages api, or any
+// api mimicking it at baseURL.
+func NewTwilioProvider(baseURL, accountSID, authToken string, client *http.Client) SMSProvider {
+	return &twilio{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		accountSID: accountSID,
+		authToken:  authToken,
+		client:     client,
+	}
+}
+
+func (t *twilio) Name() string {
+	return Twilio
+}
+
+type twilioResponse struct {
+	SID     string `json:"sid"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (t *twilio) Send(ctx context.Context, e Entity) (string, error) {
+	form := url.Values{}
+	form.Set("To", e.To)
+	form.Set("From", e.From)
+	form.Set("Body", e.Body)
+
+	endpoint := t.baseURL + "/2010-04-01/Accounts/" + url.PathEscape(t.accountSID) + "/Messages.json"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body twilioResponse
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+
+	// error responses are json as well, a body that is not still fails
+	// the send through the status below
+	_ = json.Unmarshal(data, &body)
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return body.SID, nil
+	}
+
+	return "", &ProviderError{
+		Status:    resp.StatusCode,
+		Code:      strconv.Itoa(body.Code),
+		Message:   body.Message,
+		Retryable: retryableStatus(resp.StatusCode) || body.Code == twilioQueueOverflow,
+	}
+}
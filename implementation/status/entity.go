@@ -0,0 +1,183 @@
+package status
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"notif/implementation/channel"
+)
+
+var ErrNotFound = errors.New("notification not found")
+
+// Status is where a notification, or one of its recipients, is at.
+type Status string
+
+const (
+	// Queued notifications wait in NOTIFS for a worker.
+	Queued Status = "queued"
+	// Scheduled notifications are held till their sendAt.
+	Scheduled Status = "scheduled"
+	// Processing notifications are being sent.
+	Processing Status = "processing"
+	// Sent notifications were accepted by their provider.
+	Sent Status = "sent"
+	// Retrying notifications failed and are redelivered after a backoff.
+	Retrying Status = "retrying"
+	// Failed notifications will not be sent, retrying would not fix them.
+	Failed Status = "failed"
+	// DeadLettered notifications were given up and kept in NOTIFS_DLQ.
+	DeadLettered Status = "dead-lettered"
+	// Cancelled notifications were scheduled and cancelled.
+	Cancelled Status = "cancelled"
+	// Unregistered recipients are no longer known to the provider, like
+	// the device token of an uninstalled app, and must not be sent to
+	// again.
+	Unregistered Status = "unregistered"
+)
+
+// final tells whether a recipient is done with.
+func (s Status) final() bool {
+	return s == Sent || s == Failed || s == Unregistered
+}
+
+// Recipient is the status of a recipient of a notification.
+type Recipient struct {
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Record is the status of a notification, kept in the NOTIF_STATUS
+// bucket under its id.
+type Record struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	Status  Status `json:"status"`
+	// Error is the failure of the last delivery.
+	Error string `json:"error,omitempty"`
+	// Deliveries counts the deliveries of the notification to a worker.
+	Deliveries uint64     `json:"deliveries"`
+	SendAt     *time.Time `json:"sendAt,omitempty"`
+	// Tenant gets the status changes pushed to its callback, unless
+	// CallbackURL was given with the notification.
+	Tenant      string `json:"tenant,omitempty"`
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// Recipients is keyed by the recipients of channels telling them
+	// apart, like the email addresses or the push tokens.
+	Recipients map[string]*Recipient `json:"recipients,omitempty"`
+	CreatedAt  time.Time             `json:"createdAt"`
+	UpdatedAt  time.Time             `json:"updatedAt"`
+}
+
+// NewRecord returns the record of the notification id of ch with
+// recipients, in status st.
+func NewRecord(id, ch string, recipients []string, st Status, now time.Time) Record {
+	r := Record{
+		ID:        id,
+		Channel:   ch,
+		Status:    st,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if len(recipients) > 0 {
+		r.Recipients = make(map[string]*Recipient, len(recipients))
+		for i := range recipients {
+			r.Recipients[recipients[i]] = &Recipient{Status: st, UpdatedAt: now}
+		}
+	}
+
+	return r
+}
+
+// Set moves r to st with the failure err, which may be nil. The
+// recipients of results move to sent when their error is nil, to
+// unregistered when the provider no longer knows them, to failed when it
+// is permanent and to st otherwise, the other recipients not done with
+// move to st as well.
+func (r *Record) Set(st Status, err error, results map[string]error, now time.Time) {
+	r.Status, r.Error, r.UpdatedAt = st, "", now
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	for rcpt, rErr := range results {
+		if r.Recipients == nil {
+			r.Recipients = make(map[string]*Recipient)
+		}
+
+		rs := &Recipient{Status: st, UpdatedAt: now}
+
+		switch {
+		case rErr == nil:
+			rs.Status = Sent
+		case channel.IsUnregistered(rErr):
+			rs.Status, rs.Error = Unregistered, rErr.Error()
+		case channel.IsPermanent(rErr):
+			rs.Status, rs.Error = Failed, rErr.Error()
+		default:
+			rs.Error = rErr.Error()
+		}
+
+		r.Recipients[rcpt] = rs
+	}
+
+	for rcpt, rs := range r.Recipients {
+		if _, ok := results[rcpt]; !ok && !rs.Status.final() {
+			rs.Status, rs.UpdatedAt = st, now
+		}
+	}
+}
+
+// recipient returns the key of the recipient addr of r, told apart
+// regardless of case.
+func (r *Record) recipient(addr string) (string, bool) {
+	if _, ok := r.Recipients[addr]; ok {
+		return addr, true
+	}
+
+	for k := range r.Recipients {
+		if strings.EqualFold(k, addr) {
+			return k, true
+		}
+	}
+
+	return "", false
+}
+
+// HasRecipient tells whether addr is a recipient of r, regardless of
+// case.
+func (r *Record) HasRecipient(addr string) bool {
+	_, ok := r.recipient(addr)
+	return ok
+}
+
+// Fail moves the recipient rcpt to failed with reason once its mail
+// bounced or was complained about after being sent, and the notification
+// with it when none of its recipients is left. It tells whether the
+// notification moved to failed, rcpt not being one of its recipients
+// changes nothing.
+func (r *Record) Fail(rcpt, reason string, now time.Time) bool {
+	key, ok := r.recipient(rcpt)
+	if !ok {
+		return false
+	}
+
+	r.Recipients[key] = &Recipient{Status: Failed, Error: reason, UpdatedAt: now}
+	r.UpdatedAt = now
+
+	if r.Status == Failed {
+		return false
+	}
+
+	for _, rs := range r.Recipients {
+		if rs.Status != Failed {
+			return false
+		}
+	}
+
+	r.Status, r.Error = Failed, reason
+
+	return true
+}
@@ -0,0 +1,73 @@
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSet(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRecord("id", "email", []string{"a@example.com", "b@example.com", "c@example.com"}, Queued, now)
+
+	r.Set(Processing, nil, nil, now)
+	require.Equal(t, Processing, r.Status)
+	require.Equal(t, Processing, r.Recipients["c@example.com"].Status)
+
+	later := errors.New("421 try later")
+	r.Set(Retrying, later, map[string]error{
+		"a@example.com": nil,
+		"b@example.com": channel.Permanent(errors.New("550 no such user")),
+		"c@example.com": later,
+	}, now.Add(time.Minute))
+
+	require.Equal(t, Retrying, r.Status)
+	require.Equal(t, "421 try later", r.Error)
+	require.Equal(t, &Recipient{Status: Sent, UpdatedAt: now.Add(time.Minute)}, r.Recipients["a@example.com"])
+	require.Equal(t, &Recipient{Status: Failed, Error: "550 no such user", UpdatedAt: now.Add(time.Minute)}, r.Recipients["b@example.com"])
+	require.Equal(t, Retrying, r.Recipients["c@example.com"].Status)
+
+	// the recipients done with keep their status
+	r.Set(Processing, nil, nil, now.Add(2*time.Minute))
+	require.Equal(t, Sent, r.Recipients["a@example.com"].Status)
+	require.Equal(t, Failed, r.Recipients["b@example.com"].Status)
+	require.Equal(t, Processing, r.Recipients["c@example.com"].Status)
+
+	r.Set(DeadLettered, later, nil, now.Add(3*time.Minute))
+	require.Equal(t, DeadLettered, r.Status)
+	require.Equal(t, DeadLettered, r.Recipients["c@example.com"].Status)
+	require.Equal(t, now.Add(time.Minute), r.Recipients["a@example.com"].UpdatedAt)
+
+	// unregistered device tokens are told apart from the failed ones
+	r = NewRecord("id", "push", []string{"token"}, Processing, now)
+	r.Set(Failed, nil, map[string]error{
+		"token": channel.Permanent(&channel.UnregisteredError{Err: errors.New("410 Unregistered")}),
+	}, now)
+	require.Equal(t, &Recipient{Status: Unregistered, Error: "410 Unregistered", UpdatedAt: now}, r.Recipients["token"])
+}
+
+func TestRecordFail(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRecord("id", "email", []string{"A@example.com", "b@example.com"}, Sent, now)
+
+	require.False(t, r.Fail("a@example.com", "550 5.1.1 no such user", now.Add(time.Minute)))
+	require.Equal(t, Sent, r.Status)
+	require.Equal(t, &Recipient{Status: Failed, Error: "550 5.1.1 no such user", UpdatedAt: now.Add(time.Minute)},
+		r.Recipients["A@example.com"])
+	require.True(t, r.HasRecipient("a@EXAMPLE.com"))
+
+	// the bounces of other addresses are not the notification's
+	require.False(t, r.Fail("c@example.com", "550 5.1.1 no such user", now.Add(time.Minute)))
+	require.Len(t, r.Recipients, 2)
+
+	require.True(t, r.Fail("b@example.com", "complaint", now.Add(2*time.Minute)))
+	require.Equal(t, Failed, r.Status)
+	require.Equal(t, "complaint", r.Error)
+
+	// a bounce reported again changes nothing
+	require.False(t, r.Fail("b@example.com", "complaint", now.Add(3*time.Minute)))
+}
@@ -0,0 +1,159 @@
+// Package status keeps the delivery status of every notification, and of
+// each of its recipients, in the NOTIF_STATUS bucket.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	// Create records r, overwriting the record of its id.
+	Create(ctx context.Context, r Record) error
+	// Update applies change to the record of id, which is new when none
+	// was created yet, like for notifications published before the ids.
+	Update(ctx context.Context, id string, change func(r *Record)) (Record, error)
+	// Get returns the record of id.
+	Get(ctx context.Context, id string) (Record, error)
+}
+
+type service struct {
+	kv     nats.KeyValue
+	log    *zap.SugaredLogger
+	tracer trace.Tracer
+}
+
+// NewStatusService returns a Service over the records of kv.
+func NewStatusService(l *zap.SugaredLogger, kv nats.KeyValue, t trace.Tracer) Service {
+	return &service{
+		kv:     kv,
+		log:    l,
+		tracer: t,
+	}
+}
+
+func (s *service) Create(ctx context.Context, r Record) error {
+	_, span := s.tracer.Start(ctx, "status.svc-create")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("notif.id", r.ID),
+		attribute.String("notif.status", string(r.Status)),
+	)
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return s.fail(span, err)
+	}
+
+	if _, err = s.kv.Put(r.ID, data); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+func (s *service) Update(ctx context.Context, id string, change func(r *Record)) (Record, error) {
+	_, span := s.tracer.Start(ctx, "status.svc-update")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.id", id))
+
+	var err error
+
+	// the writes of other instances, like a cancel, are merged by
+	// applying change again over them
+	for i := 0; i < config.StatusUpdateAttempts; i++ {
+		var (
+			r   Record
+			rev uint64
+		)
+
+		if r, rev, err = s.get(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return Record{}, s.fail(span, err)
+		}
+
+		if rev == 0 {
+			r = Record{ID: id}
+		}
+
+		change(&r)
+
+		var data []byte
+		if data, err = json.Marshal(r); err != nil {
+			return Record{}, s.fail(span, err)
+		}
+
+		if rev == 0 {
+			_, err = s.kv.Create(id, data)
+		} else {
+			_, err = s.kv.Update(id, data, rev)
+		}
+
+		if err == nil {
+			span.SetAttributes(attribute.String("notif.status", string(r.Status)))
+			return r, nil
+		}
+	}
+
+	return Record{}, s.fail(span, err)
+}
+
+func (s *service) Get(ctx context.Context, id string) (Record, error) {
+	_, span := s.tracer.Start(ctx, "status.svc-get")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("notif.id", id))
+
+	r, _, err := s.get(id)
+	if errors.Is(err, ErrNotFound) {
+		return Record{}, s.fail(span, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		})
+	}
+
+	if err != nil {
+		return Record{}, s.fail(span, err)
+	}
+
+	return r, nil
+}
+
+// get returns the record of id with its revision.
+func (s *service) get(id string) (Record, uint64, error) {
+	kve, err := s.kv.Get(id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Record{}, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return Record{}, 0, err
+	}
+
+	var r Record
+	if err = json.Unmarshal(kve.Value(), &r); err != nil {
+		return Record{}, 0, err
+	}
+
+	return r, kve.Revision(), nil
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,70 @@
+package suppression
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("address is not suppressed")
+	ErrInvalidAddress = errors.New("address must be an email address")
+	ErrInvalidReason  = errors.New("reason must be bounce or complaint")
+)
+
+// Reason is why an address is suppressed.
+type Reason string
+
+const (
+	// Bounce addresses were rejected for good by their mail server.
+	Bounce Reason = "bounce"
+	// Complaint addresses reported a notification as spam.
+	Complaint Reason = "complaint"
+)
+
+// Entry is a suppressed address, kept in the NOTIF_SUPPRESSIONS bucket
+// under its key.
+type Entry struct {
+	Address string `json:"address"`
+	Reason  Reason `json:"reason"`
+	// Detail is what the mail server or the provider told, like the
+	// diagnostic of the bounce.
+	Detail string `json:"detail,omitempty"`
+	// NotifID is the notification which bounced or was complained about.
+	NotifID   string    `json:"notifId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Validation checks the address and the reason of e, lowering the case of
+// the address as mailboxes are told apart regardless of it.
+func (e *Entry) Validation() error {
+	addr, err := Normalize(e.Address)
+	if err != nil {
+		return err
+	}
+
+	if e.Reason != Bounce && e.Reason != Complaint {
+		return ErrInvalidReason
+	}
+
+	e.Address = addr
+
+	return nil
+}
+
+// Normalize returns the bare address of addr in lower case.
+func Normalize(addr string) (string, error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+
+	return strings.ToLower(a.Address), nil
+}
+
+// key is the bucket key of addr, encoded as keys cannot hold '@' or '+'.
+func key(addr string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.ToLower(addr)))
+}
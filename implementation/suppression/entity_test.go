@@ -0,0 +1,24 @@
+package suppression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidation(t *testing.T) {
+	e := Entry{Address: "Jane <Jane.Doe@Example.com>", Reason: Bounce}
+	require.NoError(t, e.Validation())
+	require.Equal(t, "jane.doe@example.com", e.Address)
+
+	e.Reason = "unsubscribe"
+	require.ErrorIs(t, e.Validation(), ErrInvalidReason)
+
+	e = Entry{Address: "jane", Reason: Complaint}
+	require.ErrorIs(t, e.Validation(), ErrInvalidAddress)
+}
+
+func TestKey(t *testing.T) {
+	require.Equal(t, key("jane+news@example.com"), key("Jane+News@Example.com"))
+	require.Regexp(t, `^[-_a-zA-Z0-9]+$`, key("jane+news@example.com"))
+}
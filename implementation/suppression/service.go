@@ -0,0 +1,215 @@
+// Package suppression keeps the addresses email is not sent to anymore,
+// the ones which hard-bounced or complained, in the NOTIF_SUPPRESSIONS
+// bucket.
+package suppression
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"notif/pkg"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	// Add suppresses the address of e, replacing the entry it had.
+	Add(ctx context.Context, e Entry) (Entry, error)
+	// Suppressed returns the suppressed addresses of addrs.
+	Suppressed(ctx context.Context, addrs []string) (map[string]bool, error)
+	// List returns the suppressed addresses, the oldest first.
+	List(ctx context.Context) ([]Entry, error)
+	// Get returns the entry of addr.
+	Get(ctx context.Context, addr string) (Entry, error)
+	// Delete lifts the suppression of addr.
+	Delete(ctx context.Context, addr string) error
+}
+
+type service struct {
+	kv     nats.KeyValue
+	log    *zap.SugaredLogger
+	tracer trace.Tracer
+}
+
+// NewSuppressionService returns a Service over the entries of kv.
+func NewSuppressionService(l *zap.SugaredLogger, kv nats.KeyValue, t trace.Tracer) Service {
+	return &service{
+		kv:     kv,
+		log:    l,
+		tracer: t,
+	}
+}
+
+func (s *service) Add(ctx context.Context, e Entry) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "suppression.svc-add")
+	defer span.End()
+
+	if err := e.Validation(); err != nil {
+		return Entry{}, s.fail(span, badRequest(err))
+	}
+
+	span.SetAttributes(attribute.String("notif.suppression_reason", string(e.Reason)))
+
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	if _, err = s.kv.Put(key(e.Address), data); err != nil {
+		return Entry{}, s.fail(span, err)
+	}
+
+	return e, nil
+}
+
+func (s *service) Suppressed(ctx context.Context, addrs []string) (map[string]bool, error) {
+	_, span := s.tracer.Start(ctx, "suppression.svc-suppressed")
+	defer span.End()
+
+	suppressed := make(map[string]bool)
+
+	for i := range addrs {
+		_, err := s.kv.Get(key(addrs[i]))
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, s.fail(span, err)
+		}
+
+		suppressed[addrs[i]] = true
+	}
+
+	span.SetAttributes(attribute.Int("notif.suppressed", len(suppressed)))
+
+	return suppressed, nil
+}
+
+func (s *service) List(ctx context.Context) ([]Entry, error) {
+	_, span := s.tracer.Start(ctx, "suppression.svc-list")
+	defer span.End()
+
+	keys, err := s.kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return []Entry{}, nil
+	}
+
+	if err != nil {
+		return nil, s.fail(span, err)
+	}
+
+	entries := make([]Entry, 0, len(keys))
+
+	for i := range keys {
+		e, err := s.get(keys[i])
+		if errors.Is(err, ErrNotFound) {
+			// deleted meanwhile
+			continue
+		}
+
+		if err != nil {
+			return nil, s.fail(span, err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+
+	return entries, nil
+}
+
+func (s *service) Get(ctx context.Context, addr string) (Entry, error) {
+	_, span := s.tracer.Start(ctx, "suppression.svc-get")
+	defer span.End()
+
+	addr, err := Normalize(addr)
+	if err != nil {
+		return Entry{}, s.fail(span, badRequest(err))
+	}
+
+	e, err := s.get(key(addr))
+	if err != nil {
+		return Entry{}, s.fail(span, notFound(err))
+	}
+
+	return e, nil
+}
+
+func (s *service) Delete(ctx context.Context, addr string) error {
+	_, span := s.tracer.Start(ctx, "suppression.svc-delete")
+	defer span.End()
+
+	addr, err := Normalize(addr)
+	if err != nil {
+		return s.fail(span, badRequest(err))
+	}
+
+	if _, err = s.get(key(addr)); err != nil {
+		return s.fail(span, notFound(err))
+	}
+
+	if err = s.kv.Delete(key(addr)); err != nil {
+		return s.fail(span, err)
+	}
+
+	return nil
+}
+
+// get returns the entry kept under k.
+func (s *service) get(k string) (Entry, error) {
+	kve, err := s.kv.Get(k)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Entry{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(kve.Value(), &e); err != nil {
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+func badRequest(err error) error {
+	return pkg.NotifErr{
+		Code: http.StatusBadRequest,
+		Err:  err,
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		}
+	}
+
+	return err
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", span.SpanContext().TraceID().String()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
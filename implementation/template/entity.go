@@ -0,0 +1,62 @@
+package template
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+var ErrTemplateExists = errors.New("template already exists")
+var ErrVersionConflict = errors.New("template version already exists")
+var ErrInvalidID = errors.New("template id may only contain letters, digits, '-' and '_'")
+
+// Engine selects how a template is rendered.
+type Engine string
+
+const (
+	// HTML renders the subject and text with text/template and the html
+	// body with html/template.
+	HTML Engine = "html"
+	// Text renders a plain text only email with text/template.
+	Text Engine = "text"
+	// Hermes renders the text as markdown inside a hermes themed email.
+	Hermes Engine = "hermes"
+)
+
+// Template is a named and versioned notification template. Versions are
+// immutable, updating a template registers the next version.
+type Template struct {
+	ID        string         `json:"id" validate:"required,max=64"`
+	Version   int            `json:"version"`
+	Engine    Engine         `json:"engine" validate:"required,oneof=html text hermes"`
+	Subject   string         `json:"subject" validate:"required"`
+	HTML      string         `json:"html,omitempty" validate:"required_if=Engine html"`
+	Text      string         `json:"text,omitempty" validate:"required_unless=Engine html"`
+	Hermes    *HermesOptions `json:"hermes,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// HermesOptions picks the hermes theme and the product shown in the
+// header and footer of the email.
+type HermesOptions struct {
+	Theme     string `json:"theme" validate:"omitempty,oneof=default flat"`
+	Name      string `json:"name"`
+	Link      string `json:"link"`
+	Logo      string `json:"logo"`
+	Copyright string `json:"copyright"`
+}
+
+// Data is what a template is executed with. Data holds the notification
+// variables overridden by the ones of the recipient.
+type Data struct {
+	UserName  string                 `json:"userName"`
+	EmailAddr string                 `json:"emailAddr"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Rendered is the output of a template for a single recipient.
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html,omitempty"`
+	Text    string `json:"text,omitempty"`
+}
@@ -0,0 +1,164 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsStore struct {
+	kv nats.KeyValue
+}
+
+// NewNatsStore returns a Store backed by a JetStream key-value bucket, so
+// every instance of notif shares the same templates. Every version is
+// kept under its own "<id>.<version>" key.
+func NewNatsStore(kv nats.KeyValue) Store {
+	return &natsStore{kv: kv}
+}
+
+func key(id string, version int) string {
+	return id + "." + strconv.Itoa(version)
+}
+
+func (n *natsStore) Create(_ context.Context, t Template) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	if _, err = n.kv.Create(key(t.ID, t.Version), data); err != nil {
+		// the server rejects the write when the key exists
+		if _, gErr := n.kv.Get(key(t.ID, t.Version)); gErr == nil {
+			return ErrVersionConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (n *natsStore) Get(_ context.Context, id string, version int) (Template, error) {
+	if version == 0 {
+		versions, err := n.versions(id)
+		if err != nil {
+			return Template{}, err
+		}
+
+		version = versions[len(versions)-1]
+	}
+
+	entry, err := n.kv.Get(key(id, version))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return Template{}, ErrTemplateNotFound
+	}
+
+	if err != nil {
+		return Template{}, err
+	}
+
+	var t Template
+	err = json.Unmarshal(entry.Value(), &t)
+
+	return t, err
+}
+
+func (n *natsStore) List(ctx context.Context) ([]Template, error) {
+	keys, err := n.kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return []Template{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]int)
+
+	for i := range keys {
+		id, version, ok := parseKey(keys[i])
+		if ok && version > latest[id] {
+			latest[id] = version
+		}
+	}
+
+	templates := make([]Template, 0, len(latest))
+
+	for id, version := range latest {
+		t, err := n.Get(ctx, id, version)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+
+	return templates, nil
+}
+
+func (n *natsStore) Delete(_ context.Context, id string) error {
+	versions, err := n.versions(id)
+	if err != nil {
+		return err
+	}
+
+	for i := range versions {
+		if err = n.kv.Purge(key(id, versions[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// versions returns the stored versions of a template in ascending order.
+func (n *natsStore) versions(id string) ([]int, error) {
+	w, err := n.kv.Watch(id+".*", nats.IgnoreDeletes(), nats.MetaOnly())
+	if err != nil {
+		return nil, err
+	}
+	defer w.Stop() // nolint:errcheck // nothing to do when stopping fails
+
+	var versions []int
+
+	for entry := range w.Updates() {
+		// a nil entry marks the end of the current values
+		if entry == nil {
+			break
+		}
+
+		if _, version, ok := parseKey(entry.Key()); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrTemplateNotFound
+	}
+
+	sort.Ints(versions)
+
+	return versions, nil
+}
+
+func parseKey(k string) (string, int, bool) {
+	i := strings.LastIndex(k, ".")
+	if i < 0 {
+		return "", 0, false
+	}
+
+	version, err := strconv.Atoi(k[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return k[:i], version, true
+}
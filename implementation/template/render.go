@@ -0,0 +1,140 @@
+package template
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"net/http"
+	texttemplate "text/template"
+
+	"notif/pkg"
+
+	"github.com/matcornic/hermes/v2"
+)
+
+// missingKey makes a template fail on variables the data does not have
+// instead of silently rendering "<no value>".
+const missingKey = "missingkey=error"
+
+// compiled is a parsed template version ready to be executed.
+type compiled struct {
+	engine  Engine
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+	hermes  *hermes.Hermes
+}
+
+func compile(t Template) (*compiled, error) {
+	var err error
+
+	c := &compiled{engine: t.Engine}
+
+	if c.subject, err = texttemplate.New("subject").Option(missingKey).Parse(t.Subject); err != nil {
+		return nil, invalid(err)
+	}
+
+	if t.HTML != "" {
+		if c.html, err = htmltemplate.New("html").Option(missingKey).Parse(t.HTML); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	if t.Text != "" {
+		if c.text, err = texttemplate.New("text").Option(missingKey).Parse(t.Text); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	if t.Engine == Hermes {
+		c.hermes = newHermes(t.Hermes)
+	}
+
+	return c, nil
+}
+
+func newHermes(o *HermesOptions) *hermes.Hermes {
+	h := &hermes.Hermes{Theme: new(hermes.Default)}
+	if o == nil {
+		return h
+	}
+
+	if o.Theme == "flat" {
+		h.Theme = new(hermes.Flat)
+	}
+
+	h.Product = hermes.Product{
+		Name:      o.Name,
+		Link:      o.Link,
+		Logo:      o.Logo,
+		Copyright: o.Copyright,
+	}
+
+	return h
+}
+
+func (c *compiled) render(d Data) (Rendered, error) {
+	var (
+		r   Rendered
+		err error
+	)
+
+	if r.Subject, err = execute(c.subject, d); err != nil {
+		return Rendered{}, invalid(err)
+	}
+
+	if c.html != nil {
+		var buf bytes.Buffer
+		if err = c.html.Execute(&buf, d); err != nil {
+			return Rendered{}, invalid(err)
+		}
+
+		r.HTML = buf.String()
+	}
+
+	if c.text != nil {
+		if r.Text, err = execute(c.text, d); err != nil {
+			return Rendered{}, invalid(err)
+		}
+	}
+
+	if c.engine == Hermes {
+		return c.renderHermes(r, d)
+	}
+
+	return r, nil
+}
+
+// renderHermes wraps the rendered markdown text in the hermes theme.
+func (c *compiled) renderHermes(r Rendered, d Data) (Rendered, error) {
+	e := hermes.Email{Body: hermes.Body{
+		Name:         d.UserName,
+		FreeMarkdown: hermes.Markdown(r.Text),
+	}}
+
+	var err error
+	if r.HTML, err = c.hermes.GenerateHTML(e); err != nil {
+		return Rendered{}, err
+	}
+
+	if r.Text, err = c.hermes.GeneratePlainText(e); err != nil {
+		return Rendered{}, err
+	}
+
+	return r, nil
+}
+
+func execute(t *texttemplate.Template, d Data) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func invalid(err error) error {
+	return pkg.NotifErr{
+		Code: http.StatusBadRequest,
+		Err:  err,
+	}
+}
@@ -0,0 +1,232 @@
+// Package template stores versioned notification templates and renders
+// them per recipient.
+package template
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxUpdateAttempts bounds the retries when another instance stores
+// a version of the same template concurrently.
+const maxUpdateAttempts = 3
+
+// validID keeps template ids usable as key-value keys.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type Service interface {
+	// Create validates t and stores it as the first version of t.ID.
+	Create(ctx context.Context, t Template) (Template, error)
+	// Update validates t and stores it as the next version of t.ID.
+	Update(ctx context.Context, t Template) (Template, error)
+	// Get returns a version of a template, version 0 is the latest.
+	Get(ctx context.Context, id string, version int) (Template, error)
+	// List returns the latest version of every template.
+	List(ctx context.Context) ([]Template, error)
+	// Delete removes every version of a template.
+	Delete(ctx context.Context, id string) error
+	// Render executes a version of a template with the recipient data.
+	Render(ctx context.Context, id string, version int, d Data) (Rendered, error)
+}
+
+type service struct {
+	log    *zap.SugaredLogger
+	store  Store
+	tracer trace.Tracer
+
+	// versions are immutable so their compiled form is cached for good
+	mu    sync.RWMutex
+	cache map[string]*compiled
+}
+
+func NewTemplateService(logger *zap.SugaredLogger, s Store, t trace.Tracer) Service {
+	return &service{
+		log:    logger,
+		store:  s,
+		tracer: t,
+		cache:  make(map[string]*compiled),
+	}
+}
+
+func (s *service) Create(ctx context.Context, t Template) (Template, error) {
+	ctx, span := s.tracer.Start(ctx, "template.svc-create")
+	defer span.End()
+
+	if err := s.validate(t); err != nil {
+		return Template{}, s.fail(span, err)
+	}
+
+	t.Version = 1
+	t.CreatedAt = time.Now()
+
+	err := s.store.Create(ctx, t)
+	if err == ErrVersionConflict {
+		err = pkg.NotifErr{
+			Code: http.StatusConflict,
+			Err:  ErrTemplateExists,
+		}
+	}
+
+	if err != nil {
+		return Template{}, s.fail(span, err)
+	}
+
+	s.stored(span, t)
+
+	return t, nil
+}
+
+func (s *service) Update(ctx context.Context, t Template) (Template, error) {
+	ctx, span := s.tracer.Start(ctx, "template.svc-update")
+	defer span.End()
+
+	if err := s.validate(t); err != nil {
+		return Template{}, s.fail(span, err)
+	}
+
+	var err error
+
+	// another instance may store the same version concurrently, in which
+	// case the next one is tried
+	for i := 0; i < maxUpdateAttempts; i++ {
+		latest, gErr := s.Get(ctx, t.ID, 0)
+		if gErr != nil {
+			return Template{}, s.fail(span, gErr)
+		}
+
+		t.Version = latest.Version + 1
+		t.CreatedAt = time.Now()
+
+		if err = s.store.Create(ctx, t); err != ErrVersionConflict {
+			break
+		}
+	}
+
+	if err != nil {
+		return Template{}, s.fail(span, err)
+	}
+
+	s.stored(span, t)
+
+	return t, nil
+}
+
+// validate checks the fields of t and that its templates parse.
+func (s *service) validate(t Template) error {
+	if err := validator.New().Struct(t); err != nil {
+		return invalid(err)
+	}
+
+	if !validID.MatchString(t.ID) {
+		return invalid(ErrInvalidID)
+	}
+
+	_, err := compile(t)
+
+	return err
+}
+
+func (s *service) stored(span trace.Span, t Template) {
+	span.SetAttributes(attribute.String("template.id", t.ID), attribute.Int("template.version", t.Version))
+	s.log.Infof("stored template %s version %d", t.ID, t.Version)
+}
+
+func (s *service) Get(ctx context.Context, id string, version int) (Template, error) {
+	t, err := s.store.Get(ctx, id, version)
+	if err == ErrTemplateNotFound {
+		return Template{}, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		}
+	}
+
+	return t, err
+}
+
+func (s *service) List(ctx context.Context) ([]Template, error) {
+	return s.store.List(ctx)
+}
+
+func (s *service) Delete(ctx context.Context, id string) error {
+	err := s.store.Delete(ctx, id)
+	if err == ErrTemplateNotFound {
+		return pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
+		}
+	}
+
+	if err == nil {
+		s.log.Infof("deleted template %s", id)
+	}
+
+	return err
+}
+
+func (s *service) Render(ctx context.Context, id string, version int, d Data) (Rendered, error) {
+	ctx, span := s.tracer.Start(ctx, "template.svc-render")
+	defer span.End()
+
+	t, err := s.Get(ctx, id, version)
+	if err != nil {
+		return Rendered{}, s.fail(span, err)
+	}
+
+	span.SetAttributes(attribute.String("template.id", t.ID), attribute.Int("template.version", t.Version))
+
+	c, err := s.compiled(t)
+	if err != nil {
+		return Rendered{}, s.fail(span, err)
+	}
+
+	r, err := c.render(d)
+	if err != nil {
+		return Rendered{}, s.fail(span, err)
+	}
+
+	return r, nil
+}
+
+func (s *service) compiled(t Template) (*compiled, error) {
+	// a deleted template can be created again with the same versions, the
+	// creation time tells them apart
+	key := t.ID + "@" + strconv.Itoa(t.Version) + "@" + strconv.FormatInt(t.CreatedAt.UnixNano(), 10)
+
+	s.mu.RLock()
+	c, ok := s.cache[key]
+	s.mu.RUnlock()
+
+	if ok {
+		return c, nil
+	}
+
+	c, err := compile(t)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = c
+	s.mu.Unlock()
+
+	return c, nil
+}
+
+func (s *service) fail(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
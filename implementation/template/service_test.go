@@ -0,0 +1,120 @@
+package template
+
+import (
+	"context"
+	"testing"
+
+	"notif/pkg"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func newTestService() Service {
+	return NewTemplateService(zap.NewNop().Sugar(), NewMemoryStore(), trace.NewNoopTracerProvider().Tracer(""))
+}
+
+func TestRegisterVersions(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	tmpl := Template{ID: "welcome", Engine: HTML, Subject: "Hi {{.UserName}}", HTML: "<p>v1</p>"}
+
+	v1, err := svc.Create(ctx, tmpl)
+	require.NoError(t, err)
+	require.Equal(t, 1, v1.Version)
+
+	_, err = svc.Create(ctx, tmpl)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrTemplateExists)
+
+	tmpl.HTML = "<p>v2</p>"
+	v2, err := svc.Update(ctx, tmpl)
+	require.NoError(t, err)
+	require.Equal(t, 2, v2.Version)
+
+	latest, err := svc.Get(ctx, "welcome", 0)
+	require.NoError(t, err)
+	require.Equal(t, "<p>v2</p>", latest.HTML)
+
+	first, err := svc.Get(ctx, "welcome", 1)
+	require.NoError(t, err)
+	require.Equal(t, "<p>v1</p>", first.HTML)
+
+	_, err = svc.Get(ctx, "welcome", 3)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrTemplateNotFound)
+
+	_, err = svc.Update(ctx, Template{ID: "missing", Engine: Text, Subject: "s", Text: "t"})
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrTemplateNotFound)
+
+	list, err := svc.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, 2, list[0].Version)
+
+	require.NoError(t, svc.Delete(ctx, "welcome"))
+	_, err = svc.Get(ctx, "welcome", 0)
+	require.ErrorIs(t, err.(pkg.NotifErr).Err, ErrTemplateNotFound)
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	svc := newTestService()
+
+	testCases := []struct {
+		desc string
+		t    Template
+	}{
+		{desc: "missing engine", t: Template{ID: "a", Subject: "s", HTML: "h"}},
+		{desc: "html engine without html", t: Template{ID: "a", Engine: HTML, Subject: "s"}},
+		{desc: "text engine without text", t: Template{ID: "a", Engine: Text, Subject: "s"}},
+		{desc: "id not usable as key", t: Template{ID: "a.b", Engine: Text, Subject: "s", Text: "t"}},
+		{desc: "unparsable subject", t: Template{ID: "a", Engine: Text, Subject: "{{.Broken", Text: "t"}},
+	}
+
+	for i := range testCases {
+		t.Run(testCases[i].desc, func(t *testing.T) {
+			_, err := svc.Create(context.Background(), testCases[i].t)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	svc := newTestService()
+	ctx := context.Background()
+
+	_, err := svc.Create(ctx, Template{
+		ID:      "order",
+		Engine:  HTML,
+		Subject: "Order {{.Data.orderId}} for {{.UserName}}",
+		HTML:    "<p>Hello {{.UserName}}, {{.Data.note}}</p>",
+		Text:    "Hello {{.UserName}}",
+	})
+	require.NoError(t, err)
+
+	r, err := svc.Render(ctx, "order", 0, Data{
+		UserName: "Ann",
+		Data:     map[string]interface{}{"orderId": 42, "note": "<b>thanks</b>"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Order 42 for Ann", r.Subject)
+	require.Equal(t, "<p>Hello Ann, &lt;b&gt;thanks&lt;/b&gt;</p>", r.HTML)
+	require.Equal(t, "Hello Ann", r.Text)
+
+	_, err = svc.Render(ctx, "order", 0, Data{UserName: "Ann", Data: map[string]interface{}{}})
+	require.Error(t, err, "missing variables must fail the render")
+
+	_, err = svc.Create(ctx, Template{
+		ID:      "hermes",
+		Engine:  Hermes,
+		Subject: "Welcome",
+		Text:    "Your code is **{{.Data.code}}**",
+		Hermes:  &HermesOptions{Theme: "flat", Name: "Notif"},
+	})
+	require.NoError(t, err)
+
+	r, err = svc.Render(ctx, "hermes", 0, Data{UserName: "Ann", Data: map[string]interface{}{"code": "1234"}})
+	require.NoError(t, err)
+	require.Contains(t, r.HTML, "<strong>1234</strong>")
+	require.Contains(t, r.Text, "1234")
+}
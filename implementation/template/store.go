@@ -0,0 +1,98 @@
+package template
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store persists the versions of every template.
+type Store interface {
+	// Create saves a new version and fails with ErrVersionConflict if
+	// the version is already stored.
+	Create(ctx context.Context, t Template) error
+	// Get returns a version of a template, version 0 is the latest.
+	Get(ctx context.Context, id string, version int) (Template, error)
+	// List returns the latest version of every template.
+	List(ctx context.Context) ([]Template, error)
+	// Delete removes every version of a template.
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryStore struct {
+	mu        sync.RWMutex
+	templates map[string][]Template
+}
+
+// NewMemoryStore returns a Store which keeps templates in memory, so they
+// are not shared between instances.
+func NewMemoryStore() Store {
+	return &memoryStore{templates: make(map[string][]Template)}
+}
+
+func (m *memoryStore) Create(_ context.Context, t Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := m.templates[t.ID]
+	for i := range versions {
+		if versions[i].Version == t.Version {
+			return ErrVersionConflict
+		}
+	}
+
+	versions = append(versions, t)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	m.templates[t.ID] = versions
+
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, id string, version int) (Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	versions := m.templates[id]
+	if len(versions) == 0 {
+		return Template{}, ErrTemplateNotFound
+	}
+
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+
+	for i := range versions {
+		if versions[i].Version == version {
+			return versions[i], nil
+		}
+	}
+
+	return Template{}, ErrTemplateNotFound
+}
+
+func (m *memoryStore) List(_ context.Context) ([]Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	templates := make([]Template, 0, len(m.templates))
+	for _, versions := range m.templates {
+		templates = append(templates, versions[len(versions)-1])
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+
+	return templates, nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.templates[id]; !ok {
+		return ErrTemplateNotFound
+	}
+
+	delete(m.templates, id)
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notif/implementation/channel"
+	"notif/pkg"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ChannelName is the channel token of webhook notifications.
+const ChannelName = "webhook"
+
+var ErrNotAnEntity = errors.New("notification is not a webhook entity")
+
+type webhookChannel struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+// NewChannel returns the webhook notification channel sending through svc.
+func NewChannel(svc Service) channel.Channel {
+	return &webhookChannel{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+func (c *webhookChannel) Name() string {
+	return ChannelName
+}
+
+func (c *webhookChannel) Decode(data []byte) (interface{}, error) {
+	var e Entity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return e, nil
+}
+
+func (c *webhookChannel) Validate(n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return ErrNotAnEntity
+	}
+
+	if err := c.validate.Struct(e); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	if err := e.PayloadValidation(); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	// only the endpoints with a secret can be notified
+	if !c.svc.Known(e) {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  ErrUnknownEndpoint,
+		}
+	}
+
+	return nil
+}
+
+func (c *webhookChannel) Render(_ context.Context, n interface{}) ([]interface{}, error) {
+	return []interface{}{n}, nil
+}
+
+// Send POSTs the payload. Errors other than 5xx, 408, 429, timeouts and
+// network failures are permanent.
+func (c *webhookChannel) Send(ctx context.Context, n interface{}) error {
+	e, ok := n.(Entity)
+	if !ok {
+		return channel.Permanent(ErrNotAnEntity)
+	}
+
+	err := c.svc.Send(ctx, e)
+
+	var sErr *StatusError
+	if (errors.As(err, &sErr) && !sErr.Retryable()) || errors.Is(err, ErrUnknownEndpoint) {
+		return channel.Permanent(err)
+	}
+
+	return err
+}
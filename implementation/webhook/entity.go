@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidPayload = errors.New("payload must be valid json")
+var ErrUnknownEndpoint = errors.New("no secret is configured for the webhook endpoint")
+var ErrInvalidSecrets = errors.New("webhook secrets must be a ';' separated list of origin=secret")
+
+// Entity is a json payload to POST to a partner endpoint.
+type Entity struct {
+	URL     string            `json:"url" validate:"required,url"`
+	Payload json.RawMessage   `json:"payload" validate:"required"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Origin returns the scheme and host of the url, which identifies the
+// endpoint and its secret.
+func (e *Entity) Origin() (string, error) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// PayloadValidation checks the payload is json.
+func (e *Entity) PayloadValidation() error {
+	if !json.Valid(e.Payload) {
+		return ErrInvalidPayload
+	}
+
+	return nil
+}
+
+// ParseSecrets parses the per-endpoint secrets configured as
+// "https://a.example.com=secret;https://b.example.com:8443=other".
+func ParseSecrets(s string) (map[string]string, error) {
+	secrets := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, ErrInvalidSecrets
+		}
+
+		secrets[strings.TrimSuffix(pair[:i], "/")] = pair[i+1:]
+	}
+
+	return secrets, nil
+}
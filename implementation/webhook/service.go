@@ -0,0 +1,139 @@
+// Package webhook notifies partner systems with signed http POSTs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"notif/pkg/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxErrBody bounds how much of an error response is kept for the logs.
+const maxErrBody = 1 << 10
+
+type Service interface {
+	// Send POSTs the signed payload and fails with a *StatusError when the
+	// endpoint does not answer with a 2xx.
+	Send(ctx context.Context, e Entity) error
+	// Known tells whether a secret is configured for the endpoint of e.
+	Known(e Entity) bool
+}
+
+// StatusError is returned when the endpoint answers with a non 2xx status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook endpoint responded with status %d: %s", e.Code, e.Body)
+}
+
+// Retryable tells whether the endpoint may accept the payload later.
+func (e *StatusError) Retryable() bool {
+	return e.Code >= http.StatusInternalServerError ||
+		e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests
+}
+
+type service struct {
+	log     *zap.SugaredLogger
+	secrets map[string]string
+	client  *http.Client
+	tracer  trace.Tracer
+}
+
+// NewWebhookService returns a Service signing payloads with the secret of
+// their endpoint origin, as parsed by ParseSecrets.
+func NewWebhookService(logger *zap.SugaredLogger, secrets map[string]string, t trace.Tracer) Service {
+	return &service{
+		log:     logger,
+		secrets: secrets,
+		client:  &http.Client{Timeout: config.WebhookTimeOut},
+		tracer:  t,
+	}
+}
+
+func (s *service) Known(e Entity) bool {
+	_, err := s.secret(e)
+	return err == nil
+}
+
+func (s *service) secret(e Entity) (string, error) {
+	origin, err := e.Origin()
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := s.secrets[origin]
+	if !ok {
+		return "", ErrUnknownEndpoint
+	}
+
+	return secret, nil
+}
+
+func (s *service) Send(ctx context.Context, e Entity) error {
+	ctx, span := s.tracer.Start(ctx, "sendWebhook-func")
+	defer span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	span.SetAttributes(attribute.String("http.url", e.URL))
+
+	secret, err := s.secret(e)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(e.Payload))
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// set after the custom headers so they cannot be overridden
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(SignatureHeader, Sign(secret, now, e.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return s.fail(span, traceID, err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrBody))
+		return s.fail(span, traceID, &StatusError{Code: resp.StatusCode, Body: string(body)})
+	}
+
+	// draining the body lets the connection be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	s.log.Debugw("webhook delivered", "url", e.URL, "status", resp.StatusCode, "traceID", traceID)
+
+	return nil
+}
+
+func (s *service) fail(span trace.Span, traceID string, err error) error {
+	s.log.Errorf(err.Error(), zap.String("traceID", traceID))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"notif/implementation/channel"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestParseSecrets(t *testing.T) {
+	secrets, err := ParseSecrets("https://a.example.com/=s1; http://b.example.com:8080=s=2")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"https://a.example.com":     "s1",
+		"http://b.example.com:8080": "s=2",
+	}, secrets)
+
+	_, err = ParseSecrets("https://a.example.com")
+	require.ErrorIs(t, err, ErrInvalidSecrets)
+}
+
+func TestSendSigned(t *testing.T) {
+	status := http.StatusNoContent
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		sec, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		require.True(t, Verify("s3cr3t", time.Unix(sec, 0), body, r.Header.Get(SignatureHeader)))
+		require.Equal(t, "partner", r.Header.Get("X-Tenant"))
+		require.JSONEq(t, `{"event":"paid"}`, string(body))
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	svc := NewWebhookService(zap.NewNop().Sugar(), map[string]string{srv.URL: "s3cr3t"},
+		trace.NewNoopTracerProvider().Tracer(""))
+	ch := NewChannel(svc)
+
+	e := Entity{
+		URL:     srv.URL + "/hooks",
+		Payload: json.RawMessage(`{"event":"paid"}`),
+		Headers: map[string]string{"X-Tenant": "partner", SignatureHeader: "forged"},
+	}
+
+	require.NoError(t, ch.Validate(e))
+	require.NoError(t, ch.Send(context.Background(), e))
+
+	status = http.StatusServiceUnavailable
+	err := ch.Send(context.Background(), e)
+	require.Error(t, err)
+	require.False(t, channel.IsPermanent(err), "5xx must be retried")
+
+	status = http.StatusBadRequest
+	err = ch.Send(context.Background(), e)
+	require.True(t, channel.IsPermanent(err), "4xx must not be retried")
+
+	unknown := Entity{URL: "https://unknown.example.com", Payload: json.RawMessage(`{}`)}
+	require.Error(t, ch.Validate(unknown))
+}
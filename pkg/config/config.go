@@ -18,13 +18,104 @@ type NotifConfig struct {
 	EmailSmtpHost     string `mapstructure:"EMAIL_SMTP_HOST"`
 	EmailSmtpPORT     string `mapstructure:"EMAIL_SMTP_PORT"`
 	Emailtest         string `mapstructure:"EMAIL_TO_SEND"`
+	TemplateStore     string `mapstructure:"TEMPLATE_STORE"`
+	WebhookSecrets    string `mapstructure:"WEBHOOK_SECRETS"`
+	WorkerConcurrency int    `mapstructure:"WORKER_CONCURRENCY"`
+
+	// NatsDuplicateWindow is how long jetstream drops the notifications
+	// created again with an idempotency key, at most a day.
+	NatsDuplicateWindow time.Duration `mapstructure:"NATS_DUPLICATE_WINDOW"`
+
+	EmailSmtpTLS      string `mapstructure:"EMAIL_SMTP_TLS"`
+	EmailSmtpCAFile   string `mapstructure:"EMAIL_SMTP_CA_FILE"`
+	EmailSmtpPoolSize int    `mapstructure:"EMAIL_SMTP_POOL_SIZE"`
+	// EmailSmtpInsecureSkipVerify is only meant for local test servers.
+	EmailSmtpInsecureSkipVerify bool `mapstructure:"EMAIL_SMTP_INSECURE_SKIP_VERIFY"`
+
+	EmailSmtpAuth              string `mapstructure:"EMAIL_SMTP_AUTH"`
+	EmailSmtpOAuthTokenURL     string `mapstructure:"EMAIL_SMTP_OAUTH_TOKEN_URL"`
+	EmailSmtpOAuthClientID     string `mapstructure:"EMAIL_SMTP_OAUTH_CLIENT_ID"`
+	EmailSmtpOAuthClientSecret string `mapstructure:"EMAIL_SMTP_OAUTH_CLIENT_SECRET"`
+	EmailSmtpOAuthRefreshToken string `mapstructure:"EMAIL_SMTP_OAUTH_REFRESH_TOKEN"`
+
+	// EmailSmtpTransports is a json array of named relays replacing the
+	// EMAIL_SMTP_* one.
+	EmailSmtpTransports string `mapstructure:"EMAIL_SMTP_TRANSPORTS"`
+
+	// EmailFrom is the sender address, EMAIL_SMTP_USERNAME when not set.
+	EmailFrom               string `mapstructure:"EMAIL_FROM"`
+	EmailProvider           string `mapstructure:"EMAIL_PROVIDER"`
+	EmailSendGridBaseURL    string `mapstructure:"EMAIL_SENDGRID_BASE_URL"`
+	EmailSendGridAPIKey     string `mapstructure:"EMAIL_SENDGRID_API_KEY"`
+	EmailMailgunBaseURL     string `mapstructure:"EMAIL_MAILGUN_BASE_URL"`
+	EmailMailgunDomain      string `mapstructure:"EMAIL_MAILGUN_DOMAIN"`
+	EmailMailgunAPIKey      string `mapstructure:"EMAIL_MAILGUN_API_KEY"`
+	EmailSesBaseURL         string `mapstructure:"EMAIL_SES_BASE_URL"`
+	EmailSesRegion          string `mapstructure:"EMAIL_SES_REGION"`
+	EmailSesAccessKeyID     string `mapstructure:"EMAIL_SES_ACCESS_KEY_ID"`
+	EmailSesSecretAccessKey string `mapstructure:"EMAIL_SES_SECRET_ACCESS_KEY"`
+	EmailSesSessionToken    string `mapstructure:"EMAIL_SES_SESSION_TOKEN"`
+
+	// The keys the bounce and complaint webhooks of the providers are
+	// verified with, a webhook is disabled without its key.
+	EmailSendGridWebhookKey string `mapstructure:"EMAIL_SENDGRID_WEBHOOK_KEY"`
+	EmailMailgunWebhookKey  string `mapstructure:"EMAIL_MAILGUN_WEBHOOK_KEY"`
+	EmailSesTopicARN        string `mapstructure:"EMAIL_SES_TOPIC_ARN"`
+
+	// BounceSmtpAddr is the address the bounces are received on over smtp,
+	// not listened on when empty.
+	BounceSmtpAddr string `mapstructure:"BOUNCE_SMTP_ADDR"`
+	// BouncePop3Addr is the pop3 mailbox the bounces are polled from, not
+	// polled when empty.
+	BouncePop3Addr     string `mapstructure:"BOUNCE_POP3_ADDR"`
+	BouncePop3Username string `mapstructure:"BOUNCE_POP3_USERNAME"`
+	BouncePop3Password string `mapstructure:"BOUNCE_POP3_PASSWORD"`
+	BouncePop3TLS      bool   `mapstructure:"BOUNCE_POP3_TLS"`
+
+	// EmailDkimKeys is a json array of the dkim selector and key of every
+	// sender domain.
+	EmailDkimKeys string `mapstructure:"EMAIL_DKIM_KEYS"`
+
+	SmsProvider         string `mapstructure:"SMS_PROVIDER"`
+	SmsFrom             string `mapstructure:"SMS_FROM"`
+	SmsTwilioBaseURL    string `mapstructure:"SMS_TWILIO_BASE_URL"`
+	SmsTwilioAccountSID string `mapstructure:"SMS_TWILIO_ACCOUNT_SID"`
+	SmsTwilioAuthToken  string `mapstructure:"SMS_TWILIO_AUTH_TOKEN"`
+	SmsHTTPURL          string `mapstructure:"SMS_HTTP_URL"`
+	SmsHTTPToken        string `mapstructure:"SMS_HTTP_TOKEN"`
+
+	ChatAllowedHosts string `mapstructure:"CHAT_ALLOWED_HOSTS"`
+
+	PushFcmCredentialsFile string `mapstructure:"PUSH_FCM_CREDENTIALS_FILE"`
+	PushFcmBaseURL         string `mapstructure:"PUSH_FCM_BASE_URL"`
+	PushApnsKeyFile        string `mapstructure:"PUSH_APNS_KEY_FILE"`
+	PushApnsKeyID          string `mapstructure:"PUSH_APNS_KEY_ID"`
+	PushApnsTeamID         string `mapstructure:"PUSH_APNS_TEAM_ID"`
+	PushApnsTopic          string `mapstructure:"PUSH_APNS_TOPIC"`
+	PushApnsBaseURL        string `mapstructure:"PUSH_APNS_BASE_URL"`
 }
 
 var defaultsValue = map[string]string{
-	"PORT":            "6969",
-	"MODE":            Development,
-	"EMAIL_SMTP_HOST": "smtp.gmail.com",
-	"EMAIL_SMTP_PORT": "587",
+	"PORT":                 "6969",
+	"MODE":                 Development,
+	"EMAIL_SMTP_HOST":      "smtp.gmail.com",
+	"EMAIL_SMTP_PORT":      "587",
+	"EMAIL_SMTP_POOL_SIZE": "4",
+	"TEMPLATE_STORE":       NatsStore,
+	"WORKER_CONCURRENCY":   "4",
+
+	"NATS_DUPLICATE_WINDOW": "2m",
+
+	"EMAIL_PROVIDER":          "smtp",
+	"EMAIL_SENDGRID_BASE_URL": "https://api.sendgrid.com",
+	"EMAIL_MAILGUN_BASE_URL":  "https://api.mailgun.net",
+
+	"BOUNCE_POP3_TLS": "true",
+
+	"SMS_TWILIO_BASE_URL": "https://api.twilio.com",
+	"CHAT_ALLOWED_HOSTS":  "hooks.slack.com,webhook.office.com,outlook.office.com",
+	"PUSH_FCM_BASE_URL":   "https://fcm.googleapis.com",
+	"PUSH_APNS_BASE_URL":  "https://api.push.apple.com",
 }
 
 func LoadConfig(path string) (*NotifConfig, error) {
@@ -53,7 +144,14 @@ func LoadConfig(path string) (*NotifConfig, error) {
 
 	err = viper.Unmarshal(&cfg)
 
-	if cfg.EmailSmtpPassword == "" || cfg.EmailSmtpUserName == "" {
+	// relays without auth and xoauth2 with a refresh token need no password,
+	// nor does the default sender when named transports or an email api
+	// provider are set
+	passwordless := cfg.EmailSmtpAuth == "none" ||
+		cfg.EmailSmtpAuth == "xoauth2" && cfg.EmailSmtpOAuthTokenURL != "" ||
+		cfg.EmailSmtpTransports != "" || cfg.EmailProvider != "smtp"
+
+	if cfg.EmailFrom == "" && cfg.EmailSmtpUserName == "" || cfg.EmailSmtpPassword == "" && !passwordless {
 		return nil, errors.New("smtp config are not setup")
 	}
 
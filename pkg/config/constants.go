@@ -6,6 +6,18 @@ const (
 	Development string = "dev"
 	Production  string = "prod"
 	StreamName  string = "NOTIFS"
+	MemoryStore string = "memory"
+	NatsStore   string = "nats"
+
+	TemplateBucket       string = "NOTIF_TEMPLATES"
+	DeadLetterStreamName string = "NOTIFS_DLQ"
+	ScheduleStreamName   string = "NOTIFS_SCHEDULED"
+	ScheduleBucket       string = "NOTIF_SCHEDULES"
+	CronBucket           string = "NOTIF_JOBS"
+	LockBucket           string = "NOTIF_LOCKS"
+	StatusBucket         string = "NOTIF_STATUS"
+	CallbackBucket       string = "NOTIF_CALLBACKS"
+	SuppressionBucket    string = "NOTIF_SUPPRESSIONS"
 )
 
 var (
@@ -13,8 +25,49 @@ var (
 	NatsReconnectDelay          = 2 * time.Second
 	NatsBatchSize               = 5
 	NatsSubMaxWait              = 15 * time.Second
+	NatsAckWait                 = 30 * time.Second
+	NatsMaxDeliver              = 5
+	NatsNakDelay                = 5 * time.Second
+	NatsNakMaxDelay             = 5 * time.Minute
+	DeadLetterMaxAge            = 7 * 24 * time.Hour
+	DeadLetterListLimit         = 100
+	ScheduleMaxAhead            = 30 * 24 * time.Hour
+	ScheduleBatchSize           = 50
+	ScheduleRetryDelay          = 5 * time.Second
+	ScheduleRecordAttempts uint = 3
+	ScheduleRecordDelay         = 100 * time.Millisecond
+	CronTick                    = 5 * time.Second
+	CronLeaseTTL                = 30 * time.Second
+	StatusMaxAge                = 7 * 24 * time.Hour
+	StatusUpdateAttempts        = 3
+	BatchMaxItems               = 5000
+	BatchConcurrency            = 32
+	BatchTimeOut                = HttpTimeOut - time.Second
+	NatsAsyncMaxPending         = 4 * BatchMaxItems
+	BouncePollInterval          = time.Minute
+	BounceLeaseTTL              = 3 * time.Minute
+	BounceTimeOut               = 5 * time.Minute
+	BounceMaxSize               = 32 << 20
+	BounceWebhookMaxSize        = 5 << 20
+	BounceWebhookTolerance      = 5 * time.Minute
 	SmtpRetryAttempts      uint = 3
 	SmtpRetryDelay              = 2 * time.Second
+	SmtpDialTimeOut             = 10 * time.Second
+	SmtpTimeOut                 = 30 * time.Second
+	SmtpIdleTimeOut             = 30 * time.Second
+	SmtpBreakerThreshold        = 3
+	SmtpBreakerCooldown         = time.Minute
 	HttpTimeOut                 = 5 * time.Second
+	WebhookTimeOut              = 10 * time.Second
+	EmailApiTimeOut             = 10 * time.Second
+	SmsTimeOut                  = 10 * time.Second
+	ChatTimeOut                 = 10 * time.Second
+	PushTimeOut                 = 10 * time.Second
+	MaxRetryAfter               = time.Minute
 	ServerShutdownTimeOut       = 10 * time.Second
+	MaxAttachmentSize           = 10 << 20
+	MaxAttachmentsSize          = 20 << 20
+	// NatsMaxPayload is the max_payload of the nats server, set once
+	// connected.
+	NatsMaxPayload int64 = 1 << 20
 )
@@ -1,8 +1,10 @@
 package natshelper
 
 import (
+	"errors"
 	"fmt"
 	"notif/pkg/config"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,10 +32,30 @@ func SetupConnOptions(log *zap.SugaredLogger, wg *sync.WaitGroup) []nats.Option
 	return opts
 }
 
-func CreateStream(js nats.JetStreamContext, log *zap.SugaredLogger) (err error) {
+// CreateStream creates the NOTIFS stream, dropping the msgs published
+// again with the same Nats-Msg-Id within the duplicates window.
+func CreateStream(js nats.JetStreamContext, duplicates time.Duration, log *zap.SugaredLogger) (err error) {
+	// every channel publishes on its own NOTIFS.<channel>.send subject
+	subj := fmt.Sprintf("%s.>", config.StreamName)
+
 	stream, _ := js.StreamInfo(config.StreamName)
+	if stream != nil && (len(stream.Config.Subjects) != 1 || stream.Config.Subjects[0] != subj ||
+		duplicates > 0 && stream.Config.Duplicates != duplicates) {
+		log.Debugf("updating stream %q to subjects %q and duplicates window %v", config.StreamName, subj, duplicates)
+
+		cfg := stream.Config
+		cfg.Subjects = []string{subj}
+
+		if duplicates > 0 {
+			cfg.Duplicates = duplicates
+		}
+
+		_, err = js.UpdateStream(&cfg)
+
+		return err
+	}
+
 	if stream == nil {
-		subj := fmt.Sprintf("%s.*", config.StreamName)
 		log.Debugf("creating stream %q and subjects %q", config.StreamName, subj)
 
 		if _, err = js.AddStream(&nats.StreamConfig{
@@ -44,6 +66,7 @@ func CreateStream(js nats.JetStreamContext, log *zap.SugaredLogger) (err error)
 			Discard:     nats.DiscardOld,
 			MaxAge:      24 * time.Hour,
 			Storage:     nats.FileStorage,
+			Duplicates:  duplicates,
 		}); err != nil {
 			return
 		}
@@ -51,3 +74,167 @@ func CreateStream(js nats.JetStreamContext, log *zap.SugaredLogger) (err error)
 
 	return nil
 }
+
+// CreateDeadLetterStream creates the stream keeping the notifications
+// which could not be delivered, on a NOTIFS_DLQ.<channel> subject each.
+func CreateDeadLetterStream(js nats.JetStreamContext, log *zap.SugaredLogger) error {
+	if stream, _ := js.StreamInfo(config.DeadLetterStreamName); stream != nil {
+		return nil
+	}
+
+	subj := fmt.Sprintf("%s.>", config.DeadLetterStreamName)
+	log.Debugf("creating stream %q and subjects %q", config.DeadLetterStreamName, subj)
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:        config.DeadLetterStreamName,
+		Description: "dead-lettered notifications",
+		Subjects:    []string{subj},
+		Retention:   nats.LimitsPolicy,
+		Discard:     nats.DiscardOld,
+		MaxAge:      config.DeadLetterMaxAge,
+		Storage:     nats.FileStorage,
+	})
+
+	return err
+}
+
+// CreateScheduleStream creates the stream holding the notifications to
+// send later, on a NOTIFS_SCHEDULED.<channel>.<id> subject each. It is
+// not part of NOTIFS so held msgs never wait in front of the ones due.
+func CreateScheduleStream(js nats.JetStreamContext, log *zap.SugaredLogger) error {
+	if stream, _ := js.StreamInfo(config.ScheduleStreamName); stream != nil {
+		return nil
+	}
+
+	subj := fmt.Sprintf("%s.>", config.ScheduleStreamName)
+	log.Debugf("creating stream %q and subjects %q", config.ScheduleStreamName, subj)
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:        config.ScheduleStreamName,
+		Description: "scheduled notifications",
+		Subjects:    []string{subj},
+		Retention:   nats.WorkQueuePolicy,
+		Discard:     nats.DiscardOld,
+		MaxAge:      config.ScheduleMaxAhead + 24*time.Hour,
+		Storage:     nats.FileStorage,
+	})
+
+	return err
+}
+
+// CreateKeyValue binds to the key-value bucket and creates it when it does
+// not exist yet, its keys expire after ttl unless it is 0.
+func CreateKeyValue(js nats.JetStreamContext, bucket, description string, ttl time.Duration,
+	log *zap.SugaredLogger) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(bucket)
+	if err == nil {
+		return kv, nil
+	}
+
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, err
+	}
+
+	log.Debugf("creating key-value bucket %q", bucket)
+
+	return js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:      bucket,
+		Description: description,
+		TTL:         ttl,
+		Storage:     nats.FileStorage,
+	})
+}
+
+// MigrateConsumer deletes the durable consumer of want when it filters on
+// another subject or does not have the ack wait and max deliver of want,
+// so that it gets created again with the new config. Messages of a work
+// queue stream are kept until acked, the ones on a subject the new filter
+// misses have to be moved with MoveMsgs.
+func MigrateConsumer(js nats.JetStreamContext, stream string, want *nats.ConsumerConfig, log *zap.SugaredLogger) error {
+	info, err := js.ConsumerInfo(stream, want.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Config.FilterSubject == want.FilterSubject &&
+		info.Config.AckWait == want.AckWait && info.Config.MaxDeliver == want.MaxDeliver {
+		return nil
+	}
+
+	log.Infof("recreating consumer %q with filter %q, ack wait %v and max deliver %d",
+		want.Durable, want.FilterSubject, want.AckWait, want.MaxDeliver)
+
+	return js.DeleteConsumer(stream, want.Durable)
+}
+
+// MoveMsgs republishes the msgs of stream on subject from to subject to,
+// acking each one once it is, so the msgs published before a change of
+// subjects are consumed by the new filter. The msg id header is dropped
+// for jetstream not to take a moved msg for a duplicate of itself.
+func MoveMsgs(js nats.JetStreamContext, stream, from, to string, log *zap.SugaredLogger) error {
+	durable := strings.ReplaceAll(from, ".", "_") + "_move"
+
+	sub, err := js.PullSubscribe(from, durable, nats.AckExplicit())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			log.Warnf("deleting consumer %q failed: %v", durable, err)
+		}
+	}()
+
+	moved := 0
+
+	for {
+		info, err := sub.ConsumerInfo()
+		if err != nil {
+			return err
+		}
+
+		if info.NumPending == 0 && info.NumAckPending == 0 {
+			break
+		}
+
+		msgs, err := sub.Fetch(config.NatsBatchSize, nats.MaxWait(time.Second))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			out := nats.NewMsg(to)
+			out.Data = msg.Data
+
+			for k, vs := range msg.Header {
+				if k != nats.MsgIdHdr {
+					out.Header[k] = vs
+				}
+			}
+
+			if _, err = js.PublishMsg(out); err != nil {
+				return err
+			}
+
+			if err = msg.AckSync(); err != nil {
+				return err
+			}
+
+			moved++
+		}
+	}
+
+	if moved > 0 {
+		log.Infof("moved %d msgs of %q from %q to %q", moved, stream, from, to)
+	}
+
+	return nil
+}
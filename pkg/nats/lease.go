@@ -0,0 +1,97 @@
+package natshelper
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Lease is a lock on a key of a key-value bucket held by a single owner
+// till it expires, so only one instance of notif runs a task at a time.
+// The holder renews it before it expires, another owner takes it over
+// once it expired.
+type Lease struct {
+	kv    nats.KeyValue
+	key   string
+	owner string
+	ttl   time.Duration
+	// rev is the revision of the lease last written by owner
+	rev uint64
+}
+
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewLease returns the lease of key for owner, held for ttl once
+// acquired.
+func NewLease(kv nats.KeyValue, key, owner string, ttl time.Duration) *Lease {
+	return &Lease{
+		kv:    kv,
+		key:   key,
+		owner: owner,
+		ttl:   ttl,
+	}
+}
+
+// Acquire takes the lease or renews it when it is held already, and tells
+// whether the owner holds it till now plus its ttl.
+func (l *Lease) Acquire(now time.Time) (bool, error) {
+	data, err := json.Marshal(lease{Owner: l.owner, ExpiresAt: now.Add(l.ttl)})
+	if err != nil {
+		return false, err
+	}
+
+	entry, err := l.kv.Get(l.key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		if l.rev, err = l.kv.Create(l.key, data); err != nil {
+			// another owner created it first, losing the race is no failure
+			return false, nil
+		}
+
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var held lease
+	if err = json.Unmarshal(entry.Value(), &held); err != nil {
+		return false, err
+	}
+
+	if held.Owner != l.owner && now.Before(held.ExpiresAt) {
+		return false, nil
+	}
+
+	// writing over the revision read keeps two owners from taking an
+	// expired lease at once
+	if l.rev, err = l.kv.Update(l.key, data, entry.Revision()); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Release gives the lease up when the owner holds it, so another owner
+// does not wait for it to expire.
+func (l *Lease) Release() error {
+	entry, err := l.kv.Get(l.key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if entry.Revision() != l.rev {
+		return nil
+	}
+
+	return l.kv.Delete(l.key)
+}
@@ -0,0 +1,48 @@
+// Package natstest runs an embedded jetstream enabled nats server for the
+// tests of the services backed by streams and buckets.
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// RunJetStream starts a jetstream server storing in a temporary directory
+// and returns a connection to it, both shut down once t is done.
+func RunJetStream(t *testing.T) (*nats.Conn, nats.JetStreamContext) {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	go srv.Start()
+
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		nc.Close()
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+
+	return nc, js
+}
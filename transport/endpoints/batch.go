@@ -0,0 +1,222 @@
+package endpoints
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"notif/implementation/channel"
+	"notif/implementation/message"
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errEmptyBatch      = errors.New("batch has no notification")
+	errBatchTooLarge   = errors.New("batch has more than " + strconv.Itoa(config.BatchMaxItems) + " notifications")
+	errBatchKeyTooLong = errors.New("idempotency key is too long to be followed by the index of every notification")
+)
+
+// BatchResult is the result of a notification of a batch, its receipt or
+// the error it failed with.
+type BatchResult struct {
+	Index int `json:"index"`
+	*message.Receipt
+	Error   bool   `json:"error,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BatchResponse tells how many notifications of a batch were accepted and
+// the result of each one, in the order of the batch.
+type BatchResponse struct {
+	Accepted int           `json:"accepted"`
+	Failed   int           `json:"failed"`
+	Results  []BatchResult `json:"results"`
+}
+
+// createBatchHandler to recv notifications from http as a json array or
+// one json object per line, validate each one with its channel and publish
+// the valid ones at once. A notification failing does not fail the others,
+// its result tells why. Given an idempotency key, every notification gets
+// the key followed by its index.
+func createBatchHandler(svc message.Service, channels *channel.Registry, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "create-batch-handler")
+		defer span.End()
+
+		req := request.(NotifRequest)
+
+		ch, err := notifChannel(channels, req.Channel)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		items, err := batchItems(req.Body)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		span.SetAttributes(
+			attribute.String("notif.channel", ch.Name()),
+			attribute.Int("notif.batch_size", len(items)),
+		)
+
+		// the key of every notification is the one of the batch followed
+		// by its index, the longest one must still be a valid key
+		if req.Key != "" && message.ValidKey(req.Key) && !message.ValidKey(req.Key+"-"+strconv.Itoa(len(items)-1)) {
+			return nil, recordErr(span, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  errBatchKeyTooLong,
+			})
+		}
+
+		results := make([]BatchResult, len(items))
+		ns := make([]message.Notification, 0, len(items))
+		// index of every notification of ns in the batch
+		index := make([]int, 0, len(items))
+
+		for i := range items {
+			results[i].Index = i
+
+			n, err := notification(channels, ch, items[i])
+			if err != nil {
+				results[i].fail(err)
+				continue
+			}
+
+			if req.Key != "" {
+				n.Key = req.Key + "-" + strconv.Itoa(i)
+			}
+
+			ns = append(ns, n)
+			index = append(index, i)
+		}
+
+		sent := svc.SendBatch(ctx, ns)
+
+		for i := range sent {
+			if sent[i].Err != nil {
+				results[index[i]].fail(sent[i].Err)
+				continue
+			}
+
+			results[index[i]].Receipt = sent[i].Receipt
+		}
+
+		resp := BatchResponse{Results: results}
+
+		for i := range results {
+			if results[i].Error {
+				resp.Failed++
+			} else {
+				resp.Accepted++
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// fail sets the error of the result as the error response of a single
+// notification would be.
+func (r *BatchResult) fail(err error) {
+	r.Error, r.Code, r.Message = true, http.StatusInternalServerError, err.Error()
+
+	var pErr pkg.Error
+	if errors.As(err, &pErr) {
+		r.Code = pErr.Status()
+	}
+}
+
+// batchItems reads the notifications of a batch, a json array of them or
+// one json object per line.
+func batchItems(r io.Reader) ([]json.RawMessage, error) {
+	br := bufio.NewReader(r)
+
+	array, err := isArray(br)
+	if err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	dec := json.NewDecoder(br)
+
+	if array {
+		// the opening bracket
+		if _, err = dec.Token(); err != nil {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  err,
+			}
+		}
+	}
+
+	var items []json.RawMessage
+
+	for array && dec.More() || !array {
+		var item json.RawMessage
+
+		err = dec.Decode(&item)
+		if !array && errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  err,
+			}
+		}
+
+		if len(items) == config.BatchMaxItems {
+			return nil, pkg.NotifErr{
+				Code: http.StatusRequestEntityTooLarge,
+				Err:  errBatchTooLarge,
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  errEmptyBatch,
+		}
+	}
+
+	return items, nil
+}
+
+// isArray tells whether the batch read from br is a json array, skipping
+// the leading white space.
+func isArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+
+		default:
+			return b[0] == '[', nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"notif/implementation/bounce"
+	"notif/implementation/suppression"
+	"notif/pkg"
+	"notif/pkg/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errWebhookTooLarge = errors.New("bounce webhook is larger than " + strconv.Itoa(config.BounceWebhookMaxSize) + " bytes")
+
+// BounceRequest is a post of the bounce webhook of Provider, its headers
+// carry the signature of the body.
+type BounceRequest struct {
+	Provider string
+	Header   http.Header
+	Body     io.Reader
+}
+
+// SuppressionRequest addresses a suppressed address.
+type SuppressionRequest struct {
+	Address string
+}
+
+// bounceWebhookHandler processes the bounces and complaints posted by the
+// webhook of an email provider. A failure answers with an error status
+// for the provider to post them again.
+func bounceWebhookHandler(svc bounce.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "bounce-webhook-handler")
+		defer span.End()
+
+		req := request.(BounceRequest)
+		span.SetAttributes(attribute.String("notif.email_provider", req.Provider))
+
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(config.BounceWebhookMaxSize)+1))
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		if len(body) > config.BounceWebhookMaxSize {
+			return nil, recordErr(span, pkg.NotifErr{
+				Code: http.StatusRequestEntityTooLarge,
+				Err:  errWebhookTooLarge,
+			})
+		}
+
+		if err = svc.Webhook(ctx, req.Provider, req.Header, body); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
+
+// listSuppressionsHandler returns the suppressed addresses.
+func listSuppressionsHandler(svc suppression.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "list-suppressions-handler")
+		defer span.End()
+
+		entries, err := svc.List(ctx)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return entries, nil
+	}
+}
+
+// getSuppressionHandler returns why an address is suppressed.
+func getSuppressionHandler(svc suppression.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-suppression-handler")
+		defer span.End()
+
+		req := request.(SuppressionRequest)
+
+		e, err := svc.Get(ctx, req.Address)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return e, nil
+	}
+}
+
+// deleteSuppressionHandler lifts the suppression of an address, for it to
+// be sent to again.
+func deleteSuppressionHandler(svc suppression.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "delete-suppression-handler")
+		defer span.End()
+
+		req := request.(SuppressionRequest)
+
+		if err := svc.Delete(ctx, req.Address); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
@@ -0,0 +1,102 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"notif/implementation/callback"
+	"notif/implementation/channel"
+	"notif/implementation/webhook"
+	"notif/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CallbackRequest addresses the callback of a tenant, Body is the
+// callback to register.
+type CallbackRequest struct {
+	Tenant string
+	Body   io.Reader
+}
+
+// registerCallbackHandler saves the url the status changes of the
+// notifications of a tenant are pushed to.
+func registerCallbackHandler(svc callback.Service, channels *channel.Registry, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "register-callback-handler")
+		defer span.End()
+
+		req := request.(CallbackRequest)
+		span.SetAttributes(attribute.String("notif.tenant", req.Tenant))
+
+		var c callback.Callback
+		if err := decodeJSON(req.Body, &c); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		c.Tenant = req.Tenant
+
+		if err := callbackValidation(channels, c.URL); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		c, err := svc.Register(ctx, c)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return c, nil
+	}
+}
+
+// getCallbackHandler returns the callback of a tenant.
+func getCallbackHandler(svc callback.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-callback-handler")
+		defer span.End()
+
+		req := request.(CallbackRequest)
+		span.SetAttributes(attribute.String("notif.tenant", req.Tenant))
+
+		c, err := svc.Get(ctx, req.Tenant)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return c, nil
+	}
+}
+
+// deleteCallbackHandler removes the callback of a tenant.
+func deleteCallbackHandler(svc callback.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "delete-callback-handler")
+		defer span.End()
+
+		req := request.(CallbackRequest)
+		span.SetAttributes(attribute.String("notif.tenant", req.Tenant))
+
+		if err := svc.Delete(ctx, req.Tenant); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
+
+// callbackValidation checks the callback url can be posted to by the
+// webhook channel, which signs the callbacks with the secret of its origin.
+func callbackValidation(channels *channel.Registry, url string) error {
+	ch, err := channels.Get(webhook.ChannelName)
+	if err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return ch.Validate(webhook.Entity{URL: url, Payload: json.RawMessage(`{}`)})
+}
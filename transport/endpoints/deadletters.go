@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"context"
+
+	"notif/implementation/deadletter"
+	"notif/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeadLetterRequest addresses a dead letter by its sequence, From and
+// Limit page through the list.
+type DeadLetterRequest struct {
+	Seq   uint64
+	From  uint64
+	Limit int
+}
+
+// listDeadLettersHandler returns a page of dead letters, without their
+// notification.
+func listDeadLettersHandler(svc deadletter.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "list-dead-letters-handler")
+		defer span.End()
+
+		req := request.(DeadLetterRequest)
+
+		entries, err := svc.List(ctx, req.From, req.Limit)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return entries, nil
+	}
+}
+
+// getDeadLetterHandler returns a dead letter with its notification.
+func getDeadLetterHandler(svc deadletter.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-dead-letter-handler")
+		defer span.End()
+
+		req := request.(DeadLetterRequest)
+		span.SetAttributes(attribute.Int64("deadletter.seq", int64(req.Seq)))
+
+		e, err := svc.Get(ctx, req.Seq)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return e, nil
+	}
+}
+
+// replayDeadLetterHandler publishes a dead letter again and sends the
+// pubAck.
+func replayDeadLetterHandler(svc deadletter.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "replay-dead-letter-handler")
+		defer span.End()
+
+		req := request.(DeadLetterRequest)
+		span.SetAttributes(attribute.Int64("deadletter.seq", int64(req.Seq)))
+
+		pubAck, err := svc.Replay(ctx, req.Seq)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return pubAck, nil
+	}
+}
+
+// deleteDeadLetterHandler removes a dead letter.
+func deleteDeadLetterHandler(svc deadletter.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "delete-dead-letter-handler")
+		defer span.End()
+
+		req := request.(DeadLetterRequest)
+		span.SetAttributes(attribute.Int64("deadletter.seq", int64(req.Seq)))
+
+		if err := svc.Delete(ctx, req.Seq); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
+
+// purgeDeadLettersHandler removes every dead letter.
+func purgeDeadLettersHandler(svc deadletter.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "purge-dead-letters-handler")
+		defer span.End()
+
+		if err := svc.Purge(ctx); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
@@ -0,0 +1,153 @@
+package endpoints
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"notif/implementation/channel"
+	"notif/implementation/cron"
+	"notif/implementation/email"
+	"notif/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// JobRequest addresses a recurring job by its id, Body is the job to
+// create.
+type JobRequest struct {
+	ID   string
+	Body io.Reader
+}
+
+// createJobHandler validates the notification of a job with its channel
+// and saves the job.
+func createJobHandler(svc cron.Service, channels *channel.Registry, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "create-job-handler")
+		defer span.End()
+
+		var j cron.Job
+		if err := decodeJSON(request.(JobRequest).Body, &j); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		if j.Channel == "" {
+			j.Channel = email.ChannelName
+		}
+
+		span.SetAttributes(attribute.String("notif.channel", j.Channel))
+
+		ch, err := channels.Get(j.Channel)
+		if err != nil {
+			return nil, recordErr(span, pkg.NotifErr{
+				Code: http.StatusNotFound,
+				Err:  err,
+			})
+		}
+
+		// the notification is checked now rather than on every run
+		n, err := ch.Decode(j.Notification)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		if err = ch.Validate(n); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		j, err = svc.Create(ctx, j)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return j, nil
+	}
+}
+
+// listJobsHandler returns every job.
+func listJobsHandler(svc cron.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "list-jobs-handler")
+		defer span.End()
+
+		jobs, err := svc.List(ctx)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return jobs, nil
+	}
+}
+
+// getJobHandler returns a job.
+func getJobHandler(svc cron.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-job-handler")
+		defer span.End()
+
+		req := request.(JobRequest)
+		span.SetAttributes(attribute.String("cron.job_id", req.ID))
+
+		j, err := svc.Get(ctx, req.ID)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return j, nil
+	}
+}
+
+// pauseJobHandler stops running a job till resumed.
+func pauseJobHandler(svc cron.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "pause-job-handler")
+		defer span.End()
+
+		req := request.(JobRequest)
+		span.SetAttributes(attribute.String("cron.job_id", req.ID))
+
+		j, err := svc.Pause(ctx, req.ID)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return j, nil
+	}
+}
+
+// resumeJobHandler runs a paused job again.
+func resumeJobHandler(svc cron.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "resume-job-handler")
+		defer span.End()
+
+		req := request.(JobRequest)
+		span.SetAttributes(attribute.String("cron.job_id", req.ID))
+
+		j, err := svc.Resume(ctx, req.ID)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return j, nil
+	}
+}
+
+// deleteJobHandler removes a job.
+func deleteJobHandler(svc cron.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "delete-job-handler")
+		defer span.End()
+
+		req := request.(JobRequest)
+		span.SetAttributes(attribute.String("cron.job_id", req.ID))
+
+		if err := svc.Delete(ctx, req.ID); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
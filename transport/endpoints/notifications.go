@@ -0,0 +1,108 @@
+package endpoints
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"notif/implementation/schedule"
+	"notif/implementation/status"
+	"notif/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NotificationRequest addresses a notification by its id, Body gives the new
+// due time of a reschedule.
+type NotificationRequest struct {
+	ID   string
+	Body io.Reader
+}
+
+// getNotifHandler returns the delivery status of a notification and of
+// its recipients.
+func getNotifHandler(svc status.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-notif-handler")
+		defer span.End()
+
+		req := request.(NotificationRequest)
+		span.SetAttributes(attribute.String("notif.id", req.ID))
+
+		r, err := svc.Get(ctx, req.ID)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return r, nil
+	}
+}
+
+// cancelNotifHandler drops a held notification and sends its schedule.
+func cancelNotifHandler(svc schedule.Service, statusSvc status.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "cancel-notif-handler")
+		defer span.End()
+
+		req := request.(NotificationRequest)
+		span.SetAttributes(attribute.String("notif.id", req.ID))
+
+		e, err := svc.Cancel(ctx, req.ID)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		// the notification is cancelled whether its status follows or not
+		if _, err = statusSvc.Update(ctx, req.ID, func(r *status.Record) {
+			r.Set(status.Cancelled, nil, nil, time.Now())
+		}); err != nil {
+			span.RecordError(err)
+		}
+
+		return e, nil
+	}
+}
+
+// rescheduleNotifHandler moves a held notification to the sendAt or
+// delay of the body and sends its schedule.
+func rescheduleNotifHandler(svc schedule.Service, statusSvc status.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "reschedule-notif-handler")
+		defer span.End()
+
+		req := request.(NotificationRequest)
+		span.SetAttributes(attribute.String("notif.id", req.ID))
+
+		var when schedule.When
+		if err := decodeJSON(req.Body, &when); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		sendAt, err := when.Time(time.Now())
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		if sendAt.IsZero() {
+			return nil, recordErr(span, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  schedule.ErrMissingSchedule,
+			})
+		}
+
+		e, err := svc.Reschedule(ctx, req.ID, sendAt)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		if _, err = statusSvc.Update(ctx, req.ID, func(r *status.Record) {
+			r.SendAt, r.UpdatedAt = &e.SendAt, time.Now()
+		}); err != nil {
+			span.RecordError(err)
+		}
+
+		return e, nil
+	}
+}
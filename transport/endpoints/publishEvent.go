@@ -6,84 +6,223 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"notif/implementation/bounce"
+	"notif/implementation/callback"
+	"notif/implementation/channel"
+	"notif/implementation/cron"
+	"notif/implementation/deadletter"
 	"notif/implementation/email"
 	"notif/implementation/message"
+	"notif/implementation/schedule"
+	"notif/implementation/status"
+	"notif/implementation/suppression"
+	"notif/implementation/template"
 	"notif/pkg"
+	"time"
 
-	"github.com/go-playground/validator/v10"
-	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // Endpoints exposes all endpoints.
 type Endpoints struct {
 	CreateNotif pkg.Endpoint
+	CreateBatch pkg.Endpoint
+
+	CreateTemplate  pkg.Endpoint
+	UpdateTemplate  pkg.Endpoint
+	GetTemplate     pkg.Endpoint
+	ListTemplates   pkg.Endpoint
+	DeleteTemplate  pkg.Endpoint
+	PreviewTemplate pkg.Endpoint
+
+	ListDeadLetters  pkg.Endpoint
+	GetDeadLetter    pkg.Endpoint
+	ReplayDeadLetter pkg.Endpoint
+	DeleteDeadLetter pkg.Endpoint
+	PurgeDeadLetters pkg.Endpoint
+
+	GetNotif        pkg.Endpoint
+	CancelNotif     pkg.Endpoint
+	RescheduleNotif pkg.Endpoint
+
+	RegisterCallback pkg.Endpoint
+	GetCallback      pkg.Endpoint
+	DeleteCallback   pkg.Endpoint
+
+	BounceWebhook     pkg.Endpoint
+	ListSuppressions  pkg.Endpoint
+	GetSuppression    pkg.Endpoint
+	DeleteSuppression pkg.Endpoint
+
+	CreateJob pkg.Endpoint
+	ListJobs  pkg.Endpoint
+	GetJob    pkg.Endpoint
+	PauseJob  pkg.Endpoint
+	ResumeJob pkg.Endpoint
+	DeleteJob pkg.Endpoint
 }
 
-// MakeEndpoints takes service and returns Endpoints
-func MakeEndpoints(svc message.Service, tracer trace.Tracer) Endpoints {
+// MakeEndpoints takes services and returns Endpoints
+func MakeEndpoints(svc message.Service, channels *channel.Registry,
+	tmplSvc template.Service, dlqSvc deadletter.Service, schedSvc schedule.Service,
+	statusSvc status.Service, cronSvc cron.Service, callbackSvc callback.Service, bounceSvc bounce.Service,
+	suppressionSvc suppression.Service, tracer trace.Tracer) Endpoints {
 	return Endpoints{
-		CreateNotif: createNotifHandler(svc, tracer),
+		CreateNotif: createNotifHandler(svc, channels, tracer),
+		CreateBatch: createBatchHandler(svc, channels, tracer),
+
+		CreateTemplate:  createTemplateHandler(tmplSvc, tracer),
+		UpdateTemplate:  updateTemplateHandler(tmplSvc, tracer),
+		GetTemplate:     getTemplateHandler(tmplSvc, tracer),
+		ListTemplates:   listTemplatesHandler(tmplSvc, tracer),
+		DeleteTemplate:  deleteTemplateHandler(tmplSvc, tracer),
+		PreviewTemplate: previewTemplateHandler(tmplSvc, tracer),
+
+		ListDeadLetters:  listDeadLettersHandler(dlqSvc, tracer),
+		GetDeadLetter:    getDeadLetterHandler(dlqSvc, tracer),
+		ReplayDeadLetter: replayDeadLetterHandler(dlqSvc, tracer),
+		DeleteDeadLetter: deleteDeadLetterHandler(dlqSvc, tracer),
+		PurgeDeadLetters: purgeDeadLettersHandler(dlqSvc, tracer),
+
+		GetNotif:        getNotifHandler(statusSvc, tracer),
+		CancelNotif:     cancelNotifHandler(schedSvc, statusSvc, tracer),
+		RescheduleNotif: rescheduleNotifHandler(schedSvc, statusSvc, tracer),
+
+		RegisterCallback: registerCallbackHandler(callbackSvc, channels, tracer),
+		GetCallback:      getCallbackHandler(callbackSvc, tracer),
+		DeleteCallback:   deleteCallbackHandler(callbackSvc, tracer),
+
+		BounceWebhook:     bounceWebhookHandler(bounceSvc, tracer),
+		ListSuppressions:  listSuppressionsHandler(suppressionSvc, tracer),
+		GetSuppression:    getSuppressionHandler(suppressionSvc, tracer),
+		DeleteSuppression: deleteSuppressionHandler(suppressionSvc, tracer),
+
+		CreateJob: createJobHandler(cronSvc, channels, tracer),
+		ListJobs:  listJobsHandler(cronSvc, tracer),
+		GetJob:    getJobHandler(cronSvc, tracer),
+		PauseJob:  pauseJobHandler(cronSvc, tracer),
+		ResumeJob: resumeJobHandler(cronSvc, tracer),
+		DeleteJob: deleteJobHandler(cronSvc, tracer),
 	}
 }
 
-// createNotifHandler to recv email from http as json send the pubAck
-func createNotifHandler(svc message.Service, tracer trace.Tracer) pkg.Endpoint {
+// NotifRequest is a notification of Channel to create, the original
+// /create route leaves Channel empty for email.
+type NotifRequest struct {
+	Channel string
+	// Key is the Idempotency-Key of the request.
+	Key  string
+	Body io.Reader
+}
+
+// createNotifHandler to recv a notification from http as json, validate
+// it with its channel and send the pubAck, a notification given a sendAt
+// or delay is held till due. A request sent again with its idempotency
+// key is answered with the id and pubAck of the first one
+func createNotifHandler(svc message.Service, channels *channel.Registry, tracer trace.Tracer) pkg.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		ctx, span := tracer.Start(ctx, "create-notif-handler")
 		defer span.End()
 
-		var body email.Entity
+		req := request.(NotifRequest)
 
-		data, err := ioutil.ReadAll(request.(io.Reader))
+		ch, err := notifChannel(channels, req.Channel)
 		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
+			return nil, recordErr(span, err)
+		}
+
+		span.SetAttributes(attribute.String("notif.channel", ch.Name()))
+
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
 
-			return nil, err
+		n, err := notification(channels, ch, data)
+		if err != nil {
+			return nil, recordErr(span, err)
 		}
 
-		if err = json.Unmarshal(data, &body); err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
+		n.Key = req.Key
 
-			return nil, pkg.NotifErr{
-				Code: http.StatusBadRequest,
-				Err:  err,
-			}
+		// publish notif event
+		receipt, err := svc.SendRequest(ctx, n)
+		if err != nil {
+			return nil, recordErr(span, err)
 		}
 
-		// validation of resquest body
-		v := validator.New()
-		if err := v.Struct(body); err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
+		return receipt, nil
+	}
+}
+
+// notifChannel returns the channel of a create request, email when not
+// given.
+func notifChannel(channels *channel.Registry, name string) (channel.Channel, error) {
+	if name == "" {
+		name = email.ChannelName
+	}
 
-			return nil, pkg.NotifErr{
-				Code: http.StatusBadRequest,
-				Err:  err,
-			}
+	ch, err := channels.Get(name)
+	if err != nil {
+		return nil, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  err,
 		}
+	}
+
+	return ch, nil
+}
 
-		if err := body.ToListValidation(); err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
+// notification decodes and validates the notification data of ch, with
+// the due time and the callback of its status changes sitting next to the
+// fields of the channel.
+func notification(channels *channel.Registry, ch channel.Channel, data []byte) (message.Notification, error) {
+	body, err := ch.Decode(data)
+	if err != nil {
+		return message.Notification{}, err
+	}
 
-			return nil, pkg.NotifErr{
-				Code: http.StatusBadRequest,
-				Err:  err,
-			}
+	// validation of resquest body
+	if err = ch.Validate(body); err != nil {
+		return message.Notification{}, err
+	}
+
+	var opts struct {
+		schedule.When
+		Tenant      string `json:"tenant"`
+		CallbackURL string `json:"callbackUrl"`
+	}
+	if err = json.Unmarshal(data, &opts); err != nil {
+		return message.Notification{}, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
 		}
+	}
 
-		// publish notif event
-		pubAck, err := svc.SendEmailRequest(ctx, body)
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
+	sendAt, err := opts.When.Time(time.Now())
+	if err != nil {
+		return message.Notification{}, err
+	}
 
-			return nil, err
+	if opts.Tenant != "" && !callback.ValidTenant(opts.Tenant) {
+		return message.Notification{}, pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  callback.ErrInvalidTenant,
 		}
+	}
 
-		return pubAck, nil
+	if opts.CallbackURL != "" {
+		if err = callbackValidation(channels, opts.CallbackURL); err != nil {
+			return message.Notification{}, err
+		}
 	}
+
+	return message.Notification{
+		Channel:     ch.Name(),
+		Body:        body,
+		SendAt:      sendAt,
+		Tenant:      opts.Tenant,
+		CallbackURL: opts.CallbackURL,
+	}, nil
 }
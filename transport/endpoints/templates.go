@@ -0,0 +1,164 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"notif/implementation/template"
+	"notif/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TemplateRequest addresses a template by id and version, version 0 being
+// the latest one, along with the request body if any.
+type TemplateRequest struct {
+	ID      string
+	Version int
+	Body    io.Reader
+}
+
+// createTemplateHandler stores the first version of a template.
+func createTemplateHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "create-template-handler")
+		defer span.End()
+
+		var t template.Template
+		if err := decodeJSON(request.(TemplateRequest).Body, &t); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		t, err := svc.Create(ctx, t)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return t, nil
+	}
+}
+
+// updateTemplateHandler stores the request body as the next version.
+func updateTemplateHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "update-template-handler")
+		defer span.End()
+
+		req := request.(TemplateRequest)
+
+		var t template.Template
+		if err := decodeJSON(req.Body, &t); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		// the id of the path wins over the one of the body
+		t.ID = req.ID
+
+		t, err := svc.Update(ctx, t)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return t, nil
+	}
+}
+
+// getTemplateHandler returns a version of a template.
+func getTemplateHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "get-template-handler")
+		defer span.End()
+
+		req := request.(TemplateRequest)
+		span.SetAttributes(attribute.String("template.id", req.ID), attribute.Int("template.version", req.Version))
+
+		t, err := svc.Get(ctx, req.ID, req.Version)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return t, nil
+	}
+}
+
+// listTemplatesHandler returns the latest version of every template.
+func listTemplatesHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "list-templates-handler")
+		defer span.End()
+
+		templates, err := svc.List(ctx)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return templates, nil
+	}
+}
+
+// deleteTemplateHandler removes every version of a template.
+func deleteTemplateHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "delete-template-handler")
+		defer span.End()
+
+		req := request.(TemplateRequest)
+		if err := svc.Delete(ctx, req.ID); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return struct{}{}, nil
+	}
+}
+
+// previewTemplateHandler renders a template with the sample data of the
+// request body.
+func previewTemplateHandler(svc template.Service, tracer trace.Tracer) pkg.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "preview-template-handler")
+		defer span.End()
+
+		req := request.(TemplateRequest)
+
+		var d template.Data
+		if err := decodeJSON(req.Body, &d); err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		r, err := svc.Render(ctx, req.ID, req.Version, d)
+		if err != nil {
+			return nil, recordErr(span, err)
+		}
+
+		return r, nil
+	}
+}
+
+// decodeJSON reads the body into v, failing with a bad request.
+func decodeJSON(body io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return pkg.NotifErr{
+			Code: http.StatusBadRequest,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
+
+func recordErr(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
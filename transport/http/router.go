@@ -1,9 +1,12 @@
 package http
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"notif/pkg"
+	"notif/pkg/config"
 	"notif/transport/endpoints"
 
 	ginzap "github.com/gin-contrib/zap"
@@ -13,6 +16,16 @@ import (
 	"go.uber.org/zap"
 )
 
+// idempotencyKeyHeader carries the idempotency key of a create request.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	errInvalidVersion = errors.New("template version must be a positive integer")
+	errInvalidSeq     = errors.New("dead letter sequence must be a positive integer")
+	errInvalidPage    = errors.New("from and limit must be positive integers")
+	errUnknownAction  = errors.New("unknown create action")
+)
+
 // NewHTTPService takes all the endpoints and returns handler.
 func NewHTTPService(endpoints endpoints.Endpoints, log *zap.SugaredLogger, t trace.Tracer) http.Handler {
 
@@ -24,22 +37,225 @@ func NewHTTPService(endpoints endpoints.Endpoints, log *zap.SugaredLogger, t tra
 
 	notif := r.Group("/notif-svc/v1")
 	{
-		notif.POST("/create", endpointRequestEncoder(endpoints.CreateNotif, t))
+		notif.POST("/create", endpointRequestDecoder(endpoints.CreateNotif, decodeNotifRequest, t))
+		notif.POST("/channels/:channel/create", endpointRequestDecoder(endpoints.CreateNotif, decodeNotifRequest, t))
+		// the router reads the :batch suffix as a param
+		notif.POST("/create:action", endpointRequestDecoder(endpoints.CreateBatch, decodeBatchRequest, t))
+		notif.POST("/channels/:channel/create:action", endpointRequestDecoder(endpoints.CreateBatch, decodeBatchRequest, t))
+
+		templates := notif.Group("/templates")
+		templates.POST("", endpointRequestDecoder(endpoints.CreateTemplate, decodeTemplateRequest, t))
+		templates.GET("", endpointRequestEncoder(endpoints.ListTemplates, t))
+		templates.GET("/:id", endpointRequestDecoder(endpoints.GetTemplate, decodeTemplateRequest, t))
+		templates.GET("/:id/versions/:version", endpointRequestDecoder(endpoints.GetTemplate, decodeTemplateRequest, t))
+		templates.PUT("/:id", endpointRequestDecoder(endpoints.UpdateTemplate, decodeTemplateRequest, t))
+		templates.DELETE("/:id", endpointRequestDecoder(endpoints.DeleteTemplate, decodeTemplateRequest, t))
+		templates.POST("/:id/preview", endpointRequestDecoder(endpoints.PreviewTemplate, decodeTemplateRequest, t))
+
+		deadLetters := notif.Group("/dead-letters")
+		deadLetters.GET("", endpointRequestDecoder(endpoints.ListDeadLetters, decodeDeadLetterRequest, t))
+		deadLetters.DELETE("", endpointRequestEncoder(endpoints.PurgeDeadLetters, t))
+		deadLetters.GET("/:seq", endpointRequestDecoder(endpoints.GetDeadLetter, decodeDeadLetterRequest, t))
+		deadLetters.DELETE("/:seq", endpointRequestDecoder(endpoints.DeleteDeadLetter, decodeDeadLetterRequest, t))
+		deadLetters.POST("/:seq/replay", endpointRequestDecoder(endpoints.ReplayDeadLetter, decodeDeadLetterRequest, t))
+
+		notifications := notif.Group("/notifications")
+		notifications.GET("/:id", endpointRequestDecoder(endpoints.GetNotif, decodeNotificationRequest, t))
+		notifications.POST("/:id/cancel", endpointRequestDecoder(endpoints.CancelNotif, decodeNotificationRequest, t))
+		notifications.POST("/:id/reschedule", endpointRequestDecoder(endpoints.RescheduleNotif, decodeNotificationRequest, t))
+
+		tenants := notif.Group("/tenants")
+		tenants.PUT("/:tenant/callback", endpointRequestDecoder(endpoints.RegisterCallback, decodeCallbackRequest, t))
+		tenants.GET("/:tenant/callback", endpointRequestDecoder(endpoints.GetCallback, decodeCallbackRequest, t))
+		tenants.DELETE("/:tenant/callback", endpointRequestDecoder(endpoints.DeleteCallback, decodeCallbackRequest, t))
+
+		notif.POST("/bounces/:provider", endpointRequestDecoder(endpoints.BounceWebhook, decodeBounceRequest, t))
+
+		suppressions := notif.Group("/suppressions")
+		suppressions.GET("", endpointRequestEncoder(endpoints.ListSuppressions, t))
+		suppressions.GET("/:address", endpointRequestDecoder(endpoints.GetSuppression, decodeSuppressionRequest, t))
+		suppressions.DELETE("/:address", endpointRequestDecoder(endpoints.DeleteSuppression, decodeSuppressionRequest, t))
+
+		jobs := notif.Group("/jobs")
+		jobs.POST("", endpointRequestDecoder(endpoints.CreateJob, decodeJobRequest, t))
+		jobs.GET("", endpointRequestEncoder(endpoints.ListJobs, t))
+		jobs.GET("/:id", endpointRequestDecoder(endpoints.GetJob, decodeJobRequest, t))
+		jobs.DELETE("/:id", endpointRequestDecoder(endpoints.DeleteJob, decodeJobRequest, t))
+		jobs.POST("/:id/pause", endpointRequestDecoder(endpoints.PauseJob, decodeJobRequest, t))
+		jobs.POST("/:id/resume", endpointRequestDecoder(endpoints.ResumeJob, decodeJobRequest, t))
 	}
 
 	return r
 }
 
+// requestDecoder extracts the endpoint request from the gin context.
+type requestDecoder func(c *gin.Context) (interface{}, error)
+
 // endpointRequestEncoder encodes request and does error handling
 // and send response.
 func endpointRequestEncoder(endpoint pkg.Endpoint, t trace.Tracer) gin.HandlerFunc {
+	return endpointRequestDecoder(endpoint, decodeBody, t)
+}
+
+// decodeBody passes the request body as is to the endpoint.
+func decodeBody(c *gin.Context) (interface{}, error) {
+	return c.Request.Body, nil
+}
+
+// decodeNotifRequest reads the channel from the path, it is empty for the
+// original email only route, and the Idempotency-Key header.
+func decodeNotifRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.NotifRequest{
+		Channel: c.Param("channel"),
+		Key:     c.GetHeader(idempotencyKeyHeader),
+		Body:    c.Request.Body,
+	}, nil
+}
+
+// decodeBatchRequest reads a create request of a batch, the path only
+// ending with :batch.
+func decodeBatchRequest(c *gin.Context) (interface{}, error) {
+	if c.Param("action") != ":batch" {
+		return nil, pkg.NotifErr{
+			Code: http.StatusNotFound,
+			Err:  errUnknownAction,
+		}
+	}
+
+	return decodeNotifRequest(c)
+}
+
+// decodeTemplateRequest reads the template id and version from the path,
+// the version may also be given as query param.
+func decodeTemplateRequest(c *gin.Context) (interface{}, error) {
+	req := endpoints.TemplateRequest{
+		ID:   c.Param("id"),
+		Body: c.Request.Body,
+	}
+
+	version := c.Param("version")
+	if version == "" {
+		version = c.Query("version")
+	}
+
+	if version != "" {
+		v, err := strconv.Atoi(version)
+		if err != nil || v < 1 {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  errInvalidVersion,
+			}
+		}
+
+		req.Version = v
+	}
+
+	return req, nil
+}
+
+// decodeNotificationRequest reads the notification id from the path.
+func decodeNotificationRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.NotificationRequest{
+		ID:   c.Param("id"),
+		Body: c.Request.Body,
+	}, nil
+}
+
+// decodeCallbackRequest reads the tenant from the path.
+func decodeCallbackRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.CallbackRequest{
+		Tenant: c.Param("tenant"),
+		Body:   c.Request.Body,
+	}, nil
+}
+
+// decodeBounceRequest reads the provider from the path, with the headers
+// the webhook signature is in.
+func decodeBounceRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.BounceRequest{
+		Provider: c.Param("provider"),
+		Header:   c.Request.Header,
+		Body:     c.Request.Body,
+	}, nil
+}
+
+// decodeSuppressionRequest reads the address from the path.
+func decodeSuppressionRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.SuppressionRequest{
+		Address: c.Param("address"),
+	}, nil
+}
+
+// decodeJobRequest reads the job id from the path.
+func decodeJobRequest(c *gin.Context) (interface{}, error) {
+	return endpoints.JobRequest{
+		ID:   c.Param("id"),
+		Body: c.Request.Body,
+	}, nil
+}
+
+// decodeDeadLetterRequest reads the sequence from the path and the page
+// from the from and limit query params.
+func decodeDeadLetterRequest(c *gin.Context) (interface{}, error) {
+	req := endpoints.DeadLetterRequest{Limit: config.DeadLetterListLimit}
+
+	if seq := c.Param("seq"); seq != "" {
+		v, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil || v == 0 {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  errInvalidSeq,
+			}
+		}
+
+		req.Seq = v
+	}
+
+	if from := c.Query("from"); from != "" {
+		v, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  errInvalidPage,
+			}
+		}
+
+		req.From = v
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil || v < 1 {
+			return nil, pkg.NotifErr{
+				Code: http.StatusBadRequest,
+				Err:  errInvalidPage,
+			}
+		}
+
+		if v < req.Limit {
+			req.Limit = v
+		}
+	}
+
+	return req, nil
+}
+
+// endpointRequestDecoder decodes the request with decode, does error
+// handling and send response.
+func endpointRequestDecoder(endpoint pkg.Endpoint, decode requestDecoder, t trace.Tracer) gin.HandlerFunc {
 	fn := func(c *gin.Context) {
 		var statusCode int
 		ctx, span := t.Start(c, "endpoint-Req-Encoder")
 		defer span.End()
 
-		// process the request with its handler
-		response, err := endpoint(ctx, c.Request.Body)
+		// decode and process the request with its handler
+		var response interface{}
+
+		request, err := decode(c)
+		if err == nil {
+			response, err = endpoint(ctx, request)
+		}
+
 		if err != nil {
 			// if statusCode is not send then return InternalServerErr
 			switch e := err.(type) {